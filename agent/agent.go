@@ -1,11 +1,13 @@
 package agent
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -14,8 +16,13 @@ type Agent struct {
 	kb        *KnowledgeBase
 	codeGen   *CodeGenerator
 	options   AgentConfig
-	executor  *AndroidExecutor
+	pool      *DevicePool
+	validator *ScriptValidator
 	reportDir string
+	history   *ReportHistory
+	memory    *MemoryStore
+	cache     *ArtifactCache
+	toolchain string // ToolchainKey，参与编译缓存键
 }
 
 // NewAgent 创建Agent（兼容旧接口）
@@ -26,53 +33,110 @@ func NewAgent(kbPath, workspaceDir string) (*Agent, error) {
 }
 
 // NewAgentWithOptions 使用配置创建Agent
-func NewAgentWithOptions(kbPath string, cfg AgentConfig, ollama *OllamaClient) (*Agent, error) {
+// llm为nil时仅使用模板生成
+func NewAgentWithOptions(kbPath string, cfg AgentConfig, llm LLMBackend) (*Agent, error) {
 	cfg.normalize()
 	kb, err := NewKnowledgeBase(kbPath)
 	if err != nil {
 		return nil, err
 	}
 
-	if ollama != nil {
-		kb.SetEmbedder(ollama)
+	if llm != nil {
+		kb.SetEmbedder(llm)
 	}
 
-	// 初始化知识库
-	docs, _ := kb.Search("click", 1)
-	if len(docs) == 0 {
-		if err := BuildDefaultKnowledgeBase(kb); err != nil {
-			return nil, fmt.Errorf("构建知识库失败: %v", err)
-		}
+	// 初始化知识库，默认条目有更新时同步到已有的知识库
+	if err := kb.EnsureDefaults(); err != nil {
+		return nil, fmt.Errorf("构建知识库失败: %v", err)
+	}
+
+	moduleRoot := findModuleRoot(cfg.WorkspaceDir)
+	build, err := cfg.Build.resolve(moduleRoot)
+	if err != nil {
+		return nil, fmt.Errorf("编译配置无效: %v", err)
+	}
+	cfg.Build = build
+
+	if cfg.HistoryPath == "" {
+		cfg.HistoryPath = DefaultHistoryPath(kbPath)
+	}
+	history, err := OpenReportHistory(cfg.HistoryPath)
+	if err != nil {
+		kb.Close()
+		return nil, fmt.Errorf("打开报告历史库失败: %v", err)
+	}
+
+	if cfg.MemoryPath == "" {
+		cfg.MemoryPath = DefaultMemoryPath(kbPath)
+	}
+	memory, err := OpenMemoryStore(cfg.MemoryPath)
+	if err != nil {
+		history.Close()
+		kb.Close()
+		return nil, fmt.Errorf("打开对话记忆库失败: %v", err)
+	}
+
+	var cache *ArtifactCache
+	if !cfg.DisableCache {
+		cache = NewArtifactCache(cfg.CacheDir)
 	}
 
 	codeGen := NewCodeGenerator(kb)
-	if cfg.UseLLM && ollama != nil {
-		codeGen.EnableLLM(ollama)
+	codeGen.SetPrompts(NewPromptStore(cfg.PromptDir))
+	if cfg.UseLLM && llm != nil {
+		codeGen.EnableLLM(llm)
 	}
 
-	var executor *AndroidExecutor
+	var pool *DevicePool
 	if cfg.AutoExecute {
-		executor = NewAndroidExecutor(cfg.ADBPath, cfg.RemoteDir)
+		executor, err := cfg.executor()
+		if err != nil {
+			memory.Close()
+			history.Close()
+			kb.Close()
+			return nil, err
+		}
+		pool = NewDevicePool(executor, nil)
 	}
 
-	return &Agent{
+	ag := &Agent{
 		kb:        kb,
 		codeGen:   codeGen,
 		options:   cfg,
-		executor:  executor,
+		pool:      pool,
+		validator: NewScriptValidator(kb, moduleRoot),
 		reportDir: cfg.ReportDir,
-	}, nil
+		history:   history,
+		memory:    memory,
+		cache:     cache,
+		toolchain: ToolchainKey(moduleRoot),
+	}
+	// 每次启动都会创建新的会话，清理不再使用的对话记忆
+	if n, err := ag.PruneMemory(); err != nil {
+		fmt.Printf("[Agent] 清理对话记忆失败: %v\n", err)
+	} else if n > 0 {
+		fmt.Printf("[Agent] 已清理 %d 个过期会话的对话记忆\n", n)
+	}
+	return ag, nil
 }
 
 // TestResult 测试结果
 type TestResult struct {
-	Success   bool          `json:"success"`
-	Code      string        `json:"code"`
-	Output    string        `json:"output"`
-	Error     string        `json:"error,omitempty"`
-	Duration  time.Duration `json:"duration"`
-	Timestamp time.Time     `json:"timestamp"`
-	ReportPath string       `json:"report_path,omitempty"`
+	Success    bool          `json:"success"`
+	Code       string        `json:"code"`
+	Output     string        `json:"output"`
+	Error      string        `json:"error,omitempty"`
+	Duration   time.Duration `json:"duration"`
+	Timestamp  time.Time     `json:"timestamp"`
+	ReportPath string        `json:"report_path,omitempty"`
+	// Diagnostics 最后一次编译前的静态检查结果
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"`
+	// DeviceResults 在多台设备上执行时每台设备的结果
+	DeviceResults []DeviceResult `json:"device_results,omitempty"`
+	// Steps 脚本通过steps包上报的步骤结果
+	Steps []StepResult `json:"steps,omitempty"`
+	// GenerationFallback LLM生成失败、改用模板生成的原因
+	GenerationFallback string `json:"generation_fallback,omitempty"`
 }
 
 // ProcessQuery 处理用户查询
@@ -82,76 +146,215 @@ func (a *Agent) ProcessQuery(userQuery string) (*TestResult, error) {
 
 // ProcessQueryWithContext 带上下文处理
 func (a *Agent) ProcessQueryWithContext(userQuery, memoryContext string) (*TestResult, error) {
+	return a.Run(context.Background(), userQuery, memoryContext)
+}
+
+// Run 执行完整流水线：检索、生成、编译、推送和设备端执行。
+// 每个阶段有独立的超时时间，超时返回*TimeoutError，ctx取消时立即停止；
+// 其余失败记录在TestResult中，error为nil。
+func (a *Agent) Run(ctx context.Context, userQuery, memoryContext string) (*TestResult, error) {
 	startTime := time.Now()
+	fail := func(code, message string, err error) (*TestResult, error) {
+		return failedResult(startTime, code, message, err)
+	}
 
-	// 1. 生成测试代码
+	// 1. 检索相关API文档
 	fmt.Println("[Agent] 正在分析用户需求...")
-	code, err := a.codeGen.GenerateTestScript(userQuery, memoryContext)
+	var docs []APIDoc
+	err := runPhase(ctx, a.options.Timeouts, PhaseEmbed, func(ctx context.Context) error {
+		var err error
+		docs, err = a.kb.RetrieveDocs(ctx, userQuery)
+		return err
+	})
 	if err != nil {
-		return &TestResult{
-			Success:   false,
-			Code:      "",
-			Error:     fmt.Sprintf("代码生成失败: %v", err),
-			Duration:  time.Since(startTime),
-			Timestamp: time.Now(),
-		}, nil
+		return fail("", "知识库检索失败", err)
+	}
+
+	// 2. 生成测试代码，命中缓存时跳过LLM
+	cacheInfo := &CacheInfo{CodeKey: a.codeGen.CacheKey(userQuery, docs, memoryContext)}
+	gen := &Generation{}
+	if code, hit := a.cache.LoadCode(cacheInfo.CodeKey); hit {
+		gen.Code, gen.Source = code, CodeSourceLLM
+		cacheInfo.CodeHit = true
+		fmt.Println("[Agent] 命中代码缓存，跳过LLM生成")
+	} else {
+		err = runPhase(ctx, a.options.Timeouts, PhaseGenerate, func(ctx context.Context) error {
+			var err error
+			gen, err = a.codeGen.Generate(ctx, userQuery, docs, memoryContext)
+			return err
+		})
+		if err != nil {
+			return fail("", "代码生成失败", err)
+		}
 	}
 
 	fmt.Println("[Agent] 代码生成完成")
 	fmt.Println("生成的代码:")
 	fmt.Println("---")
-	fmt.Println(code)
+	fmt.Println(gen.Code)
 	fmt.Println("---")
 
-	// 2. 保存代码到文件
-	filename := fmt.Sprintf("generated_%d.go", time.Now().UnixNano())
-	testFile := filepath.Join(a.options.WorkspaceDir, filename)
-	if err := os.MkdirAll(a.options.WorkspaceDir, 0755); err != nil {
-		return &TestResult{
-			Success:   false,
-			Code:      code,
-			Error:     fmt.Sprintf("创建工作目录失败: %v", err),
-			Duration:  time.Since(startTime),
-			Timestamp: time.Now(),
-		}, nil
+	return a.runCode(ctx, startTime, userQuery, docs, gen, cacheInfo)
+}
+
+// RunScript 跳过检索和生成，直接编译并执行已有的脚本，用于重新执行之前生成或保存的代码。
+// 相同代码命中编译缓存时不会重新编译
+func (a *Agent) RunScript(ctx context.Context, userQuery, code string) (*TestResult, error) {
+	return a.runCode(ctx, time.Now(), userQuery, nil, &Generation{Code: code}, &CacheInfo{})
+}
+
+// failedResult 构造编译前失败的结果，中断导致的失败同时返回错误
+func failedResult(startTime time.Time, code, message string, err error) (*TestResult, error) {
+	result := &TestResult{
+		Success:   false,
+		Code:      code,
+		Error:     fmt.Sprintf("%s: %v", message, err),
+		Duration:  time.Since(startTime),
+		Timestamp: time.Now(),
 	}
+	if isInterrupted(err) {
+		return result, err
+	}
+	return result, nil
+}
+
+// runCode 保存、编译并执行生成的代码，生成报告
+func (a *Agent) runCode(ctx context.Context, startTime time.Time, userQuery string, docs []APIDoc, gen *Generation, cacheInfo *CacheInfo) (*TestResult, error) {
+	fail := func(code, message string, err error) (*TestResult, error) {
+		result, err := failedResult(startTime, code, message, err)
+		result.GenerationFallback = gen.FallbackReason
+		return result, err
+	}
+	code := gen.Code
+
+	// 3. 保存代码到本次执行的独立目录
+	runDir, err := newRunDir(a.options.WorkspaceDir, startTime)
+	if err != nil {
+		return fail(code, "创建执行目录失败", err)
+	}
+	testFile := filepath.Join(runDir, runSourceFile)
 	if err := os.WriteFile(testFile, []byte(code), 0644); err != nil {
-		return &TestResult{
-			Success:   false,
-			Code:      code,
-			Error:     fmt.Sprintf("保存代码失败: %v", err),
-			Duration:  time.Since(startTime),
-			Timestamp: time.Now(),
-		}, nil
+		return fail(code, "保存代码失败", err)
 	}
 
-	// 3. 编译代码
-	fmt.Println("[Agent] 正在编译代码...")
-	binaryPath := filepath.Join(a.options.WorkspaceDir, fmt.Sprintf("test_binary_%d", time.Now().UnixNano()))
-	buildCmd := exec.Command("go", "build", "-o", binaryPath, testFile)
-	buildOutput, err := buildCmd.CombinedOutput()
+	// 4. 编译代码，失败时将编译错误交给LLM修复后重新编译
+	binaryPath := runBinaryPath(runDir)
+	var attempts []BuildAttempt
+	var buildOutput []byte
+	for attempt := 1; ; attempt++ {
+		var diags []Diagnostic
+		cacheInfo.BinaryKey = BinaryKey(code, a.options.Build, a.toolchain)
+		if a.cache.LoadBinary(cacheInfo.BinaryKey, binaryPath) {
+			fmt.Println("[Agent] 命中编译缓存，跳过编译")
+			cacheInfo.BinaryHit = true
+			buildOutput, err = nil, nil
+		} else {
+			err = runPhase(ctx, a.options.Timeouts, PhaseBuild, func(ctx context.Context) error {
+				var err error
+				buildOutput, diags, err = a.checkAndBuild(ctx, code, testFile, binaryPath)
+				return err
+			})
+			if err == nil {
+				if cacheErr := a.cache.StoreBinary(cacheInfo.BinaryKey, binaryPath); cacheErr != nil {
+					fmt.Printf("[Agent] 写入编译缓存失败: %v\n", cacheErr)
+				}
+			}
+		}
+		attempts = append(attempts, BuildAttempt{
+			Attempt:               attempt,
+			Code:                  code,
+			Diagnostics:           string(buildOutput),
+			ValidationDiagnostics: diags,
+			Success:               err == nil,
+		})
+		if err == nil || isInterrupted(err) || attempt > *a.options.MaxRepairAttempts || !a.codeGen.CanRepair() {
+			break
+		}
+
+		fmt.Printf("[Agent] 编译失败，正在请求LLM修复（第%d次）...\n", attempt)
+		var fixed string
+		repairErr := runPhase(ctx, a.options.Timeouts, PhaseGenerate, func(ctx context.Context) error {
+			var err error
+			fixed, err = a.codeGen.RepairTestScript(ctx, userQuery, docs, code, string(buildOutput))
+			return err
+		})
+		if repairErr != nil {
+			attempts[len(attempts)-1].RepairError = repairErr.Error()
+			if isInterrupted(repairErr) {
+				err = repairErr
+			}
+			break
+		}
+		code = fixed
+		if writeErr := os.WriteFile(testFile, []byte(code), 0644); writeErr != nil {
+			attempts[len(attempts)-1].RepairError = writeErr.Error()
+			break
+		}
+	}
 	if err != nil {
-		return &TestResult{
-			Success:   false,
-			Code:      code,
-			Error:     fmt.Sprintf("编译失败: %v\n输出: %s", err, string(buildOutput)),
-			Duration:  time.Since(startTime),
-			Timestamp: time.Now(),
-		}, nil
+		buildErr := fmt.Sprintf("编译失败: %v\n输出: %s", err, string(buildOutput))
+		report := &TestReport{
+			Query:              userQuery,
+			CodePath:           testFile,
+			CompileOutput:      string(buildOutput),
+			Success:            false,
+			Duration:           time.Since(startTime),
+			Timestamp:          time.Now(),
+			AutoExecuted:       false,
+			BuildAttempts:      attempts,
+			BuildEnv:           a.options.Build.Env(),
+			BuildCommand:       a.options.Build.CommandLine(binaryPath, testFile),
+			Cache:              cacheInfo,
+			GenerationFallback: gen.FallbackReason,
+		}
+		reportPath, _ := a.saveReport(report, runDir)
+		result := &TestResult{
+			Success:            false,
+			Code:               code,
+			Error:              buildErr,
+			Diagnostics:        attempts[len(attempts)-1].ValidationDiagnostics,
+			Duration:           time.Since(startTime),
+			Timestamp:          report.Timestamp,
+			ReportPath:         reportPath,
+			GenerationFallback: gen.FallbackReason,
+		}
+		if isInterrupted(err) {
+			return result, err
+		}
+		return result, nil
 	}
 
 	fmt.Println("[Agent] 编译成功")
+	// 模板生成的代码不写入缓存，否则LLM一次失败后相同查询将一直命中模板代码
+	if gen.Source == CodeSourceLLM {
+		if cacheErr := a.cache.StoreCode(cacheInfo.CodeKey, code); cacheErr != nil {
+			fmt.Printf("[Agent] 写入代码缓存失败: %v\n", cacheErr)
+		}
+	}
 
-	// 4. 执行测试（可选，在实际Android设备上运行）
+	// 5. 执行测试（可选，在实际Android设备上运行）
 	// 这里我们只返回生成的代码，实际执行需要部署到设备
 	execOutput := "代码生成并编译成功。"
 	var execErr error
 
-	if a.executor != nil && a.options.AutoExecute {
+	var deviceResults []DeviceResult
+	if a.pool != nil && a.options.AutoExecute {
 		fmt.Println("[Agent] 正在推送到设备执行...")
-		output, runErr := a.executor.Execute(binaryPath)
-		execOutput = output
-		execErr = runErr
+		execOutput, deviceResults, execErr = a.execute(ctx, runDir)
+	}
+	deviceLog, screenshots, uiDumps := collectedEvidence(deviceResults)
+	var exitCode *int
+	var stepResults []StepResult
+	if len(deviceResults) == 1 {
+		exitCode = deviceResults[0].ExitCode
+		stepResults = deviceResults[0].Steps
+	}
+	if failed := FailedStep(stepResults); failed != nil && execErr != nil {
+		execErr = fmt.Errorf("步骤 %d「%s」失败: %w", failed.Index, failed.Name, execErr)
+	}
+	if !a.options.AllDevices {
+		// 单台设备执行时结果已体现在报告的执行输出中
+		deviceResults = nil
 	}
 
 	success := execErr == nil
@@ -160,33 +363,199 @@ func (a *Agent) ProcessQueryWithContext(userQuery, memoryContext string) (*TestR
 	}
 
 	report := &TestReport{
-		Query:           userQuery,
-		CodePath:        testFile,
-		BinaryPath:      binaryPath,
-		CompileOutput:   string(buildOutput),
-		ExecutionOutput: execOutput,
-		ExecutionError:  errString(execErr),
-		Success:         success,
-		Duration:        time.Since(startTime),
-		Timestamp:       time.Now(),
-		AutoExecuted:    a.options.AutoExecute,
+		Query:              userQuery,
+		CodePath:           testFile,
+		BinaryPath:         binaryPath,
+		CompileOutput:      string(buildOutput),
+		ExecutionOutput:    execOutput,
+		ExecutionError:     errString(execErr),
+		Success:            success,
+		Duration:           time.Since(startTime),
+		Timestamp:          time.Now(),
+		AutoExecuted:       a.options.AutoExecute,
+		BuildAttempts:      attempts,
+		BuildEnv:           a.options.Build.Env(),
+		BuildCommand:       a.options.Build.CommandLine(binaryPath, testFile),
+		Cache:              cacheInfo,
+		DeviceResults:      deviceResults,
+		AndroidDeviceLog:   deviceLog,
+		Screenshots:        screenshots,
+		UIDumps:            uiDumps,
+		ExitCode:           exitCode,
+		Steps:              stepResults,
+		GenerationFallback: gen.FallbackReason,
+	}
+	if exitCode != nil {
+		report.ExitReason = DescribeExitCode(*exitCode)
 	}
 
-	reportPath, _ := report.Save(a.reportDir)
+	reportPath, _ := a.saveReport(report, runDir)
 
 	result := &TestResult{
-		Success:    success,
-		Code:       code,
-		Output:     execOutput,
-		Error:      errString(execErr),
-		Duration:   time.Since(startTime),
-		Timestamp:  report.Timestamp,
-		ReportPath: reportPath,
+		Success:            success,
+		Code:               code,
+		Output:             execOutput,
+		Error:              errString(execErr),
+		Duration:           time.Since(startTime),
+		Timestamp:          report.Timestamp,
+		ReportPath:         reportPath,
+		DeviceResults:      deviceResults,
+		Steps:              stepResults,
+		GenerationFallback: gen.FallbackReason,
 	}
 
+	if isInterrupted(execErr) {
+		return result, execErr
+	}
 	return result, nil
 }
 
+// execute 在设备上执行二进制：AllDevices时在所有匹配的设备上并行执行，否则租借一台空闲设备。
+// 每台设备的执行结果都附带采集到的现场证据。
+func (a *Agent) execute(ctx context.Context, runDir string) (string, []DeviceResult, error) {
+	filter := a.options.Devices
+	if filter.ABI == "" {
+		filter.ABI = a.options.Build.ABI
+	}
+	if err := a.pool.Refresh(ctx); err != nil {
+		return "", nil, err
+	}
+
+	binaryPath := runBinaryPath(runDir)
+	evidenceDir := filepath.Join(runDir, runScreenshots)
+	var mu sync.Mutex
+	evidence := make(map[string]*Evidence)
+
+	run := func(ctx context.Context, lease *DeviceLease) (string, error) {
+		fmt.Printf("[Agent] 使用设备 %s\n", lease.Device)
+		output, err := a.runOnDevice(ctx, lease.Executor, binaryPath, evidenceDir, func(e *Evidence) {
+			mu.Lock()
+			evidence[lease.Device.Serial] = e
+			mu.Unlock()
+		})
+		return output, err
+	}
+	attach := func(results []DeviceResult) []DeviceResult {
+		for i := range results {
+			results[i].Evidence = evidence[results[i].Device.Serial]
+			results[i].Output, results[i].Steps = ParseStepEvents(results[i].Output)
+		}
+		return results
+	}
+
+	if !a.options.AllDevices {
+		lease, err := a.pool.Acquire(ctx, filter)
+		if err != nil {
+			return "", nil, err
+		}
+		defer lease.Release()
+		start := time.Now()
+		output, err := run(ctx, lease)
+		result := DeviceResult{
+			Device:   lease.Device,
+			Success:  err == nil,
+			Output:   output,
+			Error:    errString(err),
+			Duration: time.Since(start),
+		}
+		if code, ok := ExitCodeOf(err); ok {
+			result.ExitCode = &code
+		}
+		results := attach([]DeviceResult{result})
+		return results[0].Output, results, err
+	}
+
+	results, err := a.pool.RunOnAll(ctx, filter, run)
+	if err != nil {
+		return "", nil, err
+	}
+	results = attach(results)
+	var output strings.Builder
+	failed := 0
+	for _, r := range results {
+		output.WriteString(fmt.Sprintf("=== %s ===\n%s\n", r.Device, r.Output))
+		if !r.Success {
+			failed++
+		}
+	}
+	if ctx.Err() != nil {
+		return output.String(), results, ctx.Err()
+	}
+	if failed > 0 {
+		return output.String(), results, fmt.Errorf("%d/%d 台设备执行失败", failed, len(results))
+	}
+	return output.String(), results, nil
+}
+
+// runOnDevice 推送并执行二进制，执行前清空logcat，执行后按EvidenceMode采集证据并交给collect
+func (a *Agent) runOnDevice(ctx context.Context, executor Executor, binaryPath, evidenceDir string, collect func(*Evidence)) (string, error) {
+	// 只有能采集证据的执行后端（如adb）才采集
+	collector, _ := executor.(EvidenceCollector)
+	mode := a.options.Evidence
+	if collector == nil {
+		mode = EvidenceNever
+	}
+	var since string
+	if mode != EvidenceNever {
+		var err error
+		if since, err = collector.StartLogcat(ctx); err != nil {
+			fmt.Printf("[Agent] %v\n", err)
+		}
+	}
+
+	var remoteBinary, output string
+	err := runPhase(ctx, a.options.Timeouts, PhasePush, func(ctx context.Context) error {
+		var err error
+		remoteBinary, output, err = executor.Push(ctx, binaryPath)
+		return err
+	})
+	if err == nil {
+		err = runPhase(ctx, a.options.Timeouts, PhaseRun, func(ctx context.Context) error {
+			var err error
+			output, err = executor.Run(ctx, remoteBinary)
+			return err
+		})
+		// 证据采集完成后再结束残留进程、删除二进制
+		defer func() {
+			if cleanupErr := executor.Cleanup(ctx, remoteBinary); cleanupErr != nil {
+				fmt.Printf("[Agent] 清理设备失败: %v\n", cleanupErr)
+			}
+		}()
+	}
+
+	if mode != EvidenceNever {
+		capture := mode == EvidenceAlways || err != nil
+		if capture {
+			fmt.Println("[Agent] 正在采集设备日志、截图和界面控件树...")
+		}
+		evidence := collector.CollectEvidence(ctx, evidenceDir, since, capture)
+		for _, collectErr := range evidence.Errors {
+			fmt.Printf("[Agent] 采集证据失败: %s\n", collectErr)
+		}
+		collect(evidence)
+	}
+	return output, err
+}
+
+// checkAndBuild 先对照知识库做静态检查，通过后再调用go build
+func (a *Agent) checkAndBuild(ctx context.Context, code, testFile, binaryPath string) ([]byte, []Diagnostic, error) {
+	fmt.Println("[Agent] 正在检查代码...")
+	diags, err := a.validator.Validate(code)
+	if err != nil {
+		return []byte(err.Error()), nil, fmt.Errorf("静态检查失败: %w", err)
+	}
+	if HasErrors(diags) {
+		return []byte(FormatDiagnostics(diags)), diags, fmt.Errorf("静态检查未通过")
+	}
+
+	fmt.Println("[Agent] 正在编译代码...")
+	buildCmd := exec.CommandContext(ctx, "go", a.options.Build.BuildArgs(binaryPath, testFile)...)
+	buildCmd.Env = append(os.Environ(), a.options.Build.Env()...)
+	buildCmd.WaitDelay = 5 * time.Second
+	output, err := buildCmd.CombinedOutput()
+	return output, diags, err
+}
+
 // ProcessQueryWithExecution 处理查询并执行（如果可能）
 func (a *Agent) ProcessQueryWithExecution(userQuery string) (*TestResult, error) {
 	return a.ProcessQueryWithContext(userQuery, "")
@@ -199,9 +568,114 @@ func (a *Agent) GetAPIInfo(query string) ([]APIDoc, error) {
 
 // Close 关闭Agent
 func (a *Agent) Close() error {
+	a.memory.Close()
+	a.history.Close()
 	return a.kb.Close()
 }
 
+// Options 返回当前配置
+func (a *Agent) Options() AgentConfig {
+	return a.options
+}
+
+// SetDevices 切换目标设备，对之后的执行生效。不能与Run并发调用
+func (a *Agent) SetDevices(filter DeviceFilter) {
+	a.options.Devices = filter
+}
+
+// SetAutoExecute 开关自动执行，首次开启时创建执行后端。不能与Run并发调用
+func (a *Agent) SetAutoExecute(enabled bool) error {
+	if enabled && a.pool == nil {
+		executor, err := a.options.executor()
+		if err != nil {
+			return err
+		}
+		a.pool = NewDevicePool(executor, nil)
+	}
+	a.options.AutoExecute = enabled
+	return nil
+}
+
+// ModelName 返回当前使用的推理模型，未启用LLM时为空
+func (a *Agent) ModelName() string {
+	llm := a.codeGen.activeLLM()
+	if llm == nil {
+		return ""
+	}
+	return llm.ModelName()
+}
+
+// SetModel 切换推理模型，对之后的生成生效。不能与Run并发调用
+func (a *Agent) SetModel(model string) error {
+	llm := a.codeGen.activeLLM()
+	if llm == nil {
+		return fmt.Errorf("未启用LLM，无法切换模型")
+	}
+	switcher, ok := llm.(ModelSwitcher)
+	if !ok {
+		return fmt.Errorf("当前LLM后端不支持切换模型")
+	}
+	switcher.SetModel(model)
+	return nil
+}
+
+// NewMemory 打开会话的对话记忆，之前保存的记忆会被恢复；启用LLM时超出预算的对话通过LLM总结
+func (a *Agent) NewMemory(sessionID string) (*ConversationMemory, error) {
+	memory, err := OpenConversationMemory(a.memory, sessionID, a.options.MemoryBudget)
+	if err != nil {
+		return nil, err
+	}
+	memory.SetSummarizer(a.summarize)
+	return memory, nil
+}
+
+// PruneMemory 删除超过MemoryMaxAge未更新的对话记忆，工作目录中保存的会话（包括自动保存）
+// 引用的记忆保留，返回删除的会话数
+func (a *Agent) PruneMemory() (int, error) {
+	if a.options.MemoryMaxAge < 0 {
+		return 0, nil
+	}
+	store := NewSessionStore(a.options.WorkspaceDir)
+	names, err := store.Sessions()
+	if err != nil {
+		return 0, err
+	}
+	keep := make(map[string]bool)
+	for _, name := range names {
+		session, err := store.Load(name)
+		if err != nil {
+			return 0, err
+		}
+		if session.ID != "" {
+			keep[session.ID] = true
+		}
+	}
+	return a.memory.Prune(time.Now().Add(-a.options.MemoryMaxAge), keep)
+}
+
+// summarize 通过LLM总结较早的对话，未启用LLM时返回错误，由记忆退回到摘录
+func (a *Agent) summarize(ctx context.Context, summary string, messages []Message) (string, error) {
+	if a.codeGen.activeLLM() == nil {
+		return "", fmt.Errorf("LLM未配置")
+	}
+	fmt.Println("[Agent] 对话记忆超出预算，正在总结较早的对话...")
+	var result string
+	err := runPhase(ctx, a.options.Timeouts, PhaseGenerate, func(ctx context.Context) error {
+		var err error
+		result, err = a.codeGen.Summarize(ctx, summary, messages, a.options.MemoryBudget/4)
+		return err
+	})
+	if err != nil {
+		fmt.Printf("[Agent] 总结对话失败，只保留较早查询的摘录: %v\n", err)
+	}
+	return result, err
+}
+
+// History 返回报告历史库
+func (a *Agent) History() *ReportHistory {
+	return a.history
+}
+
 // FormatResult 格式化测试结果
 func (a *Agent) FormatResult(result *TestResult) string {
 	var output strings.Builder
@@ -250,3 +724,66 @@ func errString(err error) string {
 	return err.Error()
 }
 
+// saveReport 按配置的格式保存报告并写入历史库，同时将编译日志、设备输出和报告副本
+// 写入执行目录，返回JSON报告路径
+func (a *Agent) saveReport(report *TestReport, runDir string) (string, error) {
+	report.RunDir = runDir
+	paths, err := report.SaveFormats(a.reportDir, a.options.ReportFormats)
+	if err != nil {
+		fmt.Printf("[Agent] 保存报告失败: %v\n", err)
+	}
+	var reportPath string
+	if len(paths) > 0 {
+		reportPath = paths[0]
+	}
+	if _, histErr := a.history.Record(report, reportPath); histErr != nil {
+		fmt.Printf("[Agent] 记录报告历史失败: %v\n", histErr)
+	}
+
+	if runDir != "" {
+		if runErr := a.saveRunArtifacts(report, runDir); runErr != nil {
+			fmt.Printf("[Agent] 保存执行产物失败: %v\n", runErr)
+		}
+	}
+	if a.options.Retention != nil {
+		if _, gcErr := CollectGarbage(a.options.WorkspaceDir, *a.options.Retention, false); gcErr != nil {
+			fmt.Printf("[Agent] 清理工作目录失败: %v\n", gcErr)
+		}
+	}
+	return reportPath, err
+}
+
+// saveRunArtifacts 写入执行目录中的编译日志、设备输出、报告副本和run.json
+func (a *Agent) saveRunArtifacts(report *TestReport, runDir string) error {
+	var buildLog strings.Builder
+	for _, attempt := range report.BuildAttempts {
+		buildLog.WriteString(fmt.Sprintf("=== 第%d次编译 (成功: %v) ===\n", attempt.Attempt, attempt.Success))
+		buildLog.WriteString(attempt.Diagnostics)
+		if attempt.RepairError != "" {
+			buildLog.WriteString("\n修复失败: " + attempt.RepairError)
+		}
+		buildLog.WriteString("\n")
+	}
+	if err := os.WriteFile(filepath.Join(runDir, runBuildLogFile), []byte(buildLog.String()), 0644); err != nil {
+		return err
+	}
+	if report.ExecutionOutput != "" || report.AndroidDeviceLog != "" {
+		deviceLog := report.ExecutionOutput
+		if report.AndroidDeviceLog != "" {
+			deviceLog += "\n=== logcat ===\n" + report.AndroidDeviceLog
+		}
+		if err := os.WriteFile(filepath.Join(runDir, runDeviceLog), []byte(deviceLog), 0644); err != nil {
+			return err
+		}
+	}
+	if _, err := report.SaveFormats(runDir, a.options.ReportFormats); err != nil {
+		return err
+	}
+	return writeRunMeta(runDir, RunMeta{
+		ID:        filepath.Base(runDir),
+		Query:     report.Query,
+		Success:   report.Success,
+		StartedAt: report.Timestamp.Add(-report.Duration),
+		Duration:  report.Duration,
+	})
+}
@@ -0,0 +1,281 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pipelineResponse fakeLLM 返回的测试脚本
+const pipelineResponse = "```go\npackage main\n\nfunc main() {}\n```"
+
+// repairs 返回MaxRepairAttempts的取值
+func repairs(n int) *int {
+	return &n
+}
+
+// newPipelineAgent 创建使用fakeLLM和FakeExecutor的代理，并预先写入编译缓存以跳过go build
+func newPipelineAgent(t *testing.T, executor Executor, configure func(*AgentConfig)) *Agent {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := AgentConfig{
+		UseLLM:            true,
+		AutoExecute:       true,
+		WorkspaceDir:      filepath.Join(dir, "workspace"),
+		ReportDir:         filepath.Join(dir, "reports"),
+		MaxRepairAttempts: repairs(0),
+		CustomExecutor:    executor,
+	}
+	if configure != nil {
+		configure(&cfg)
+	}
+	ag, err := NewAgentWithOptions(filepath.Join(dir, "kb.db"), cfg, &fakeLLM{model: "fake", response: pipelineResponse})
+	if err != nil {
+		t.Fatalf("NewAgentWithOptions: %v", err)
+	}
+	t.Cleanup(func() { ag.Close() })
+
+	code, err := ExtractGoCode(pipelineResponse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary := filepath.Join(dir, "prebuilt")
+	os.WriteFile(binary, []byte("fake binary"), 0755)
+	if err := ag.cache.StoreBinary(BinaryKey(code, ag.options.Build, ag.toolchain), binary); err != nil {
+		t.Fatal(err)
+	}
+	return ag
+}
+
+func runPipeline(t *testing.T, ag *Agent) (*TestResult, *TestReport, error) {
+	t.Helper()
+	result, err := ag.Run(context.Background(), "点击登录按钮", "")
+	if result == nil {
+		t.Fatalf("Run returned nil result: %v", err)
+	}
+	if result.ReportPath == "" {
+		t.Fatalf("Run did not save a report: %+v", result)
+	}
+	report, loadErr := LoadReport(result.ReportPath)
+	if loadErr != nil {
+		t.Fatalf("LoadReport: %v", loadErr)
+	}
+	return result, report, err
+}
+
+func fakeMethods(calls []FakeCall) string {
+	var methods []string
+	for _, call := range calls {
+		methods = append(methods, call.Method)
+	}
+	return strings.Join(methods, ",")
+}
+
+func TestPipelineSuccess(t *testing.T) {
+	fake := NewFakeExecutor(nil, FakeRun{Output: "登录成功\n", Logcat: "I/App: ok"})
+	result, report, err := runPipeline(t, newPipelineAgent(t, fake, nil))
+	if err != nil || !result.Success {
+		t.Fatalf("Run = %+v, %v", result, err)
+	}
+	if result.Output != "登录成功\n" || report.ExecutionOutput != "登录成功\n" {
+		t.Errorf("output = %q, report %q", result.Output, report.ExecutionOutput)
+	}
+	if report.ExitCode == nil || *report.ExitCode != 0 {
+		t.Errorf("report exit code = %v, want 0", report.ExitCode)
+	}
+	if !report.Cache.BinaryHit {
+		t.Error("pipeline test should reuse the prebuilt binary")
+	}
+	if got := fakeMethods(fake.Calls()); got != "devices,logcat,push,run,evidence,cleanup" {
+		t.Errorf("executor calls = %s", got)
+	}
+	// 成功时默认只采集日志，不截图
+	if report.AndroidDeviceLog != "I/App: ok" || len(report.Screenshots) != 0 {
+		t.Errorf("evidence = %q %v", report.AndroidDeviceLog, report.Screenshots)
+	}
+}
+
+func TestPipelineExitCode(t *testing.T) {
+	fake := NewFakeExecutor(nil, FakeRun{Output: "restarting", ExitCode: ExitCodeRestart, Logcat: "E/App: crash"})
+	result, report, err := runPipeline(t, newPipelineAgent(t, fake, nil))
+	if err != nil || result.Success {
+		t.Fatalf("Run = %+v, %v, want failure without error", result, err)
+	}
+	if report.ExitCode == nil || *report.ExitCode != ExitCodeRestart || !strings.Contains(report.ExitReason, "RestartSelf") {
+		t.Errorf("report exit = %v %q", report.ExitCode, report.ExitReason)
+	}
+	if report.AndroidDeviceLog != "E/App: crash" {
+		t.Errorf("AndroidDeviceLog = %q", report.AndroidDeviceLog)
+	}
+	if len(report.Screenshots) != 1 || !strings.HasPrefix(report.Screenshots[0], report.RunDir) {
+		t.Errorf("failure should capture a screenshot into the run dir, got %v", report.Screenshots)
+	}
+}
+
+func TestPipelinePushFailure(t *testing.T) {
+	fake := NewFakeExecutor(nil, FakeRun{PushErr: errors.New("adb push失败: device offline")})
+	result, report, err := runPipeline(t, newPipelineAgent(t, fake, nil))
+	if err != nil || result.Success || !strings.Contains(result.Error, "device offline") {
+		t.Fatalf("Run = %+v, %v", result, err)
+	}
+	if report.ExitCode != nil {
+		t.Errorf("push failure should not report an exit code, got %d", *report.ExitCode)
+	}
+	if strings.Contains(fakeMethods(fake.Calls()), "run") {
+		t.Error("Run should not be called after a failed push")
+	}
+}
+
+func TestPipelineRunTimeout(t *testing.T) {
+	fake := NewFakeExecutor(nil, FakeRun{Delay: time.Minute})
+	ag := newPipelineAgent(t, fake, func(cfg *AgentConfig) {
+		cfg.Timeouts.Run = 50 * time.Millisecond
+	})
+	result, _, err := runPipeline(t, ag)
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.Phase != PhaseRun {
+		t.Fatalf("Run error = %v, want run phase timeout", err)
+	}
+	if result.Success {
+		t.Error("timed out run reported success")
+	}
+	if !strings.HasSuffix(fakeMethods(fake.Calls()), "cleanup") {
+		t.Errorf("timed out run should still be cleaned up, calls %s", fakeMethods(fake.Calls()))
+	}
+}
+
+func TestPipelineAllDevices(t *testing.T) {
+	fake := NewFakeExecutor([]Device{
+		{Serial: "a", State: "device", Model: "Pixel_6"},
+		{Serial: "b", State: "device", Model: "Pixel_7"},
+	}, FakeRun{Serial: "a", Output: "ok"}, FakeRun{Serial: "b", ExitCode: 1})
+	ag := newPipelineAgent(t, fake, func(cfg *AgentConfig) {
+		cfg.AllDevices = true
+	})
+	result, report, err := runPipeline(t, ag)
+	if err != nil || result.Success || !strings.Contains(result.Error, "1/2") {
+		t.Fatalf("Run = %+v, %v", result, err)
+	}
+	if len(report.DeviceResults) != 2 {
+		t.Fatalf("DeviceResults = %+v", report.DeviceResults)
+	}
+	a, b := report.DeviceResults[0], report.DeviceResults[1]
+	if !a.Success || a.Output != "ok" || b.Success || b.ExitCode == nil || *b.ExitCode != 1 {
+		t.Errorf("device results = %+v, %+v", a, b)
+	}
+	if len(report.Screenshots) != 1 || filepath.Base(report.Screenshots[0]) != "b.png" {
+		t.Errorf("only the failed device should be captured, got %v", report.Screenshots)
+	}
+}
+
+func TestNewExecutor(t *testing.T) {
+	for _, backend := range []string{"", ExecutorADB, ExecutorHost} {
+		if _, err := NewExecutor(ExecutorConfig{Backend: backend}); err != nil {
+			t.Errorf("NewExecutor(%q): %v", backend, err)
+		}
+	}
+	if _, err := NewExecutor(ExecutorConfig{Backend: ExecutorSSH}); err == nil {
+		t.Error("ssh backend without a target should fail")
+	}
+	// 未指定目录时各后端使用自己的默认目录
+	adb, _ := NewExecutor(ExecutorConfig{})
+	if dir := adb.(*AndroidExecutor).RemoteDir; dir != "/data/local/tmp" {
+		t.Errorf("adb remote dir = %q", dir)
+	}
+	ssh, _ := NewExecutor(ExecutorConfig{Backend: ExecutorSSH, SSH: SSHConfig{Target: "pi@host"}})
+	if dir := ssh.(*SSHExecutor).RemoteDir; dir != "/tmp" {
+		t.Errorf("ssh remote dir = %q", dir)
+	}
+	if _, err := NewExecutor(ExecutorConfig{Backend: "usb"}); err == nil {
+		t.Error("unknown backend should fail")
+	}
+}
+
+// scriptedLLM 依次返回预设的响应，并记录收到的提示词
+type scriptedLLM struct {
+	fakeLLM
+	responses []string
+	prompts   []string
+}
+
+func (s *scriptedLLM) GenerateContext(ctx context.Context, prompt string) (string, error) {
+	s.prompts = append(s.prompts, prompt)
+	response := s.responses[0]
+	if len(s.responses) > 1 {
+		s.responses = s.responses[1:]
+	}
+	return response, nil
+}
+
+// brokenResponse 调用不存在的AutoGo包，静态检查即失败，不会运行go build
+const brokenResponse = "```go\npackage main\n\nimport \"github.com/xiaocainiao633/Genie1.0--/nosuchpkg\"\n\nfunc main() { nosuchpkg.Run() }\n```"
+
+func TestRepairLoop(t *testing.T) {
+	cases := []struct {
+		name      string
+		attempts  int
+		responses []string
+		success   bool
+		builds    int
+	}{
+		{"fixed on second repair", 2, []string{brokenResponse, brokenResponse, pipelineResponse}, true, 3},
+		{"gives up after max attempts", 1, []string{brokenResponse}, false, 2},
+		{"repair 0", 0, []string{brokenResponse}, false, 1},
+		{"repair disabled", -1, []string{brokenResponse}, false, 1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			llm := &scriptedLLM{fakeLLM: fakeLLM{model: "fake"}, responses: tc.responses}
+			ag := newPipelineAgent(t, NewFakeExecutor(nil, FakeRun{Output: "ok"}), func(cfg *AgentConfig) {
+				cfg.MaxRepairAttempts = repairs(tc.attempts)
+				cfg.AutoExecute = false
+			})
+			ag.codeGen.EnableLLM(llm)
+
+			result, report, err := runPipeline(t, ag)
+			if err != nil || result.Success != tc.success {
+				t.Fatalf("Run = %+v, %v, want success=%v", result, err, tc.success)
+			}
+			if len(report.BuildAttempts) != tc.builds {
+				t.Fatalf("got %d build attempts, want %d", len(report.BuildAttempts), tc.builds)
+			}
+			// 生成1次，之后每次编译失败修复1次
+			if len(llm.prompts) != tc.builds {
+				t.Fatalf("LLM called %d times, want %d", len(llm.prompts), tc.builds)
+			}
+			for i, prompt := range llm.prompts[1:] {
+				diagnostics := report.BuildAttempts[i].Diagnostics
+				if !strings.Contains(diagnostics, "nosuchpkg") || !strings.Contains(prompt, strings.TrimSpace(diagnostics)) {
+					t.Errorf("repair prompt %d lacks the diagnostics %q:\n%s", i+1, diagnostics, prompt)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerationFallbackReported(t *testing.T) {
+	ag := newPipelineAgent(t, NewFakeExecutor(nil), func(cfg *AgentConfig) {
+		cfg.AutoExecute = false
+	})
+	ag.codeGen.EnableLLM(&fakeLLM{model: "fake", response: "抱歉，我无法完成这个请求。"})
+
+	result, report, err := runPipeline(t, ag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(result.Code, "steps.RunAll") {
+		t.Errorf("expected template code, got:\n%s", result.Code)
+	}
+	for _, got := range []string{result.GenerationFallback, report.GenerationFallback} {
+		if !strings.Contains(got, "未找到Go代码块") {
+			t.Errorf("fallback reason = %q", got)
+		}
+	}
+	if !strings.Contains(report.Markdown(), "**模板生成**: LLM生成失败") {
+		t.Errorf("markdown report does not explain the fallback:\n%s", report.Markdown())
+	}
+}
@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BuildProfile 编译配置，零值表示按宿主机环境直接编译
+type BuildProfile struct {
+	GOOS       string `json:"goos,omitempty"`
+	GOARCH     string `json:"goarch,omitempty"`
+	CGOEnabled bool   `json:"cgo_enabled"`
+	CC         string `json:"cc,omitempty"`       // NDK clang路径，如 aarch64-linux-android21-clang
+	ABI        string `json:"abi,omitempty"`      // 安卓ABI: arm64-v8a, x86_64, x86
+	LibsDir    string `json:"libs_dir,omitempty"` // 预编译库根目录，默认<模块根目录>/libs
+	LDFlags    string `json:"ldflags,omitempty"`  // 额外的链接参数，传给 -ldflags
+}
+
+// abiArch 安卓ABI与GOARCH的对应关系，同时对应libs下的目录名
+var abiArch = map[string]string{
+	"arm64-v8a": "arm64",
+	"x86_64":    "amd64",
+	"x86":       "386",
+}
+
+// AndroidBuildProfile 返回在指定ABI设备上运行的cgo编译配置
+func AndroidBuildProfile(abi, ndkClang string) BuildProfile {
+	return BuildProfile{
+		GOOS:       "android",
+		GOARCH:     abiArch[abi],
+		CGOEnabled: true,
+		CC:         ndkClang,
+		ABI:        abi,
+	}
+}
+
+// IsHost 是否按宿主机环境编译
+func (p BuildProfile) IsHost() bool {
+	return p.GOOS == "" && p.GOARCH == "" && p.ABI == "" && !p.CGOEnabled && p.CC == ""
+}
+
+// resolve 根据ABI补全GOOS/GOARCH和库目录，并检查配置是否自洽
+func (p BuildProfile) resolve(moduleRoot string) (BuildProfile, error) {
+	if p.ABI != "" {
+		arch, ok := abiArch[p.ABI]
+		if !ok {
+			return p, fmt.Errorf("不支持的ABI: %s（可选 arm64-v8a, x86_64, x86）", p.ABI)
+		}
+		if p.GOARCH == "" {
+			p.GOARCH = arch
+		} else if p.GOARCH != arch {
+			return p, fmt.Errorf("ABI %s 与 GOARCH=%s 不匹配", p.ABI, p.GOARCH)
+		}
+		if p.GOOS == "" {
+			p.GOOS = "android"
+		}
+	}
+	if p.LibsDir == "" && moduleRoot != "" {
+		p.LibsDir = filepath.Join(moduleRoot, "libs")
+	}
+	if p.GOOS == "android" && p.CGOEnabled && p.CC == "" {
+		return p, fmt.Errorf("安卓cgo编译需要指定NDK clang路径")
+	}
+	return p, nil
+}
+
+// Env 返回编译时追加的环境变量
+func (p BuildProfile) Env() []string {
+	if p.IsHost() {
+		return nil
+	}
+
+	var env []string
+	if p.GOOS != "" {
+		env = append(env, "GOOS="+p.GOOS)
+	}
+	if p.GOARCH != "" {
+		env = append(env, "GOARCH="+p.GOARCH)
+	}
+	if p.CGOEnabled {
+		env = append(env, "CGO_ENABLED=1")
+	} else {
+		env = append(env, "CGO_ENABLED=0")
+	}
+	if p.CC != "" {
+		env = append(env, "CC="+p.CC)
+	}
+	if p.CGOEnabled && p.ABI != "" && p.LibsDir != "" {
+		// 追加到环境中已有的CGO_LDFLAGS之后，避免覆盖用户的链接参数
+		ldflags := "-L" + filepath.Join(p.LibsDir, p.ABI)
+		if existing := os.Getenv("CGO_LDFLAGS"); existing != "" {
+			ldflags = existing + " " + ldflags
+		}
+		env = append(env, "CGO_LDFLAGS="+ldflags)
+	}
+	return env
+}
+
+// BuildArgs 返回go build的参数
+func (p BuildProfile) BuildArgs(binaryPath, sourcePath string) []string {
+	args := []string{"build"}
+	if p.LDFlags != "" {
+		args = append(args, "-ldflags", p.LDFlags)
+	}
+	return append(args, "-o", binaryPath, sourcePath)
+}
+
+// CommandLine 返回完整的编译命令，用于记录到报告
+func (p BuildProfile) CommandLine(binaryPath, sourcePath string) string {
+	parts := append(p.Env(), "go")
+	for _, arg := range p.BuildArgs(binaryPath, sourcePath) {
+		if strings.ContainsAny(arg, " \t\"'") {
+			arg = fmt.Sprintf("%q", arg)
+		}
+		parts = append(parts, arg)
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestBuildProfileResolve(t *testing.T) {
+	t.Setenv("CGO_LDFLAGS", "")
+	profile, err := AndroidBuildProfile("arm64-v8a", "/ndk/aarch64-linux-android21-clang").resolve("/repo")
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	want := []string{
+		"GOOS=android",
+		"GOARCH=arm64",
+		"CGO_ENABLED=1",
+		"CC=/ndk/aarch64-linux-android21-clang",
+		"CGO_LDFLAGS=-L/repo/libs/arm64-v8a",
+	}
+	if got := profile.Env(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Env() = %q, want %q", got, want)
+	}
+
+	// 已有的CGO_LDFLAGS保留在前面
+	t.Setenv("CGO_LDFLAGS", "-L/opt/lib -lfoo")
+	if got := profile.Env(); got[len(got)-1] != "CGO_LDFLAGS=-L/opt/lib -lfoo -L/repo/libs/arm64-v8a" {
+		t.Errorf("Env() with CGO_LDFLAGS set = %q", got)
+	}
+
+	if env := (BuildProfile{}).Env(); env != nil {
+		t.Errorf("host profile Env() = %q, want nil", env)
+	}
+
+	invalid := []BuildProfile{
+		{ABI: "mips"},
+		{ABI: "x86", GOARCH: "arm64"},
+		{ABI: "x86_64", CGOEnabled: true},
+	}
+	for _, p := range invalid {
+		if _, err := p.resolve("/repo"); err == nil {
+			t.Errorf("resolve(%+v) succeeded, want error", p)
+		}
+	}
+}
+
+func TestHostExecutorBuildProfile(t *testing.T) {
+	cfg := AgentConfig{Executor: ExecutorHost}
+	cfg.normalize()
+	if cfg.Build.GOOS != runtime.GOOS || cfg.Build.GOARCH != runtime.GOARCH {
+		t.Errorf("host build profile = %+v, want %s/%s", cfg.Build, runtime.GOOS, runtime.GOARCH)
+	}
+	// 依赖cgo的包在本机也必须能编译
+	for _, kv := range cfg.Build.Env() {
+		if kv == "CGO_ENABLED=0" {
+			t.Errorf("host build env %q disables cgo", cfg.Build.Env())
+		}
+	}
+
+	// 显式指定的目标平台和其他后端保持不变
+	cfg = AgentConfig{Executor: ExecutorHost, Build: BuildProfile{ABI: "x86_64"}}
+	cfg.normalize()
+	if cfg.Build.GOOS != "" {
+		t.Errorf("explicit ABI overridden: %+v", cfg.Build)
+	}
+	cfg = AgentConfig{Executor: ExecutorADB}
+	cfg.normalize()
+	if !cfg.Build.IsHost() {
+		t.Errorf("adb build profile = %+v", cfg.Build)
+	}
+}
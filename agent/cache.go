@@ -0,0 +1,171 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// ArtifactCache 内容寻址的产物缓存：生成的代码按(查询, 检索上下文, 模型, 提示词版本)的哈希缓存，
+// 编译产物按(代码, 编译配置)的哈希缓存
+type ArtifactCache struct {
+	dir string
+}
+
+// CacheInfo 报告中记录的缓存命中情况
+type CacheInfo struct {
+	CodeKey   string `json:"code_key,omitempty"`
+	CodeHit   bool   `json:"code_hit"`
+	BinaryKey string `json:"binary_key,omitempty"`
+	BinaryHit bool   `json:"binary_hit"`
+}
+
+// String 返回命中情况的简要描述
+func (ci *CacheInfo) String() string {
+	hit := map[bool]string{true: "命中", false: "未命中"}
+	return fmt.Sprintf("代码%s，编译%s", hit[ci.CodeHit], hit[ci.BinaryHit])
+}
+
+// NewArtifactCache 创建缓存
+func NewArtifactCache(dir string) *ArtifactCache {
+	return &ArtifactCache{dir: dir}
+}
+
+// hashParts 计算各部分内容的哈希，部分之间以长度分隔避免拼接歧义
+func hashParts(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		var size [8]byte
+		binary.LittleEndian.PutUint64(size[:], uint64(len(part)))
+		h.Write(size[:])
+		io.WriteString(h, part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ToolchainKey 返回Go版本和模块依赖（go.mod、go.sum）的摘要，工具链或依赖升级后编译缓存随之失效。
+// moduleRoot为空时只包含Go版本
+func ToolchainKey(moduleRoot string) string {
+	parts := []string{"toolchain", runtime.Version()}
+	if moduleRoot != "" {
+		for _, name := range []string{"go.mod", "go.sum"} {
+			data, _ := os.ReadFile(filepath.Join(moduleRoot, name))
+			parts = append(parts, string(data))
+		}
+	}
+	return hashParts(parts...)
+}
+
+// BinaryKey 计算编译产物的缓存键，由代码、编译配置和ToolchainKey决定
+func BinaryKey(code string, profile BuildProfile, toolchain string) string {
+	data, _ := json.Marshal(profile)
+	target := runtime.GOOS + "/" + runtime.GOARCH
+	if !profile.IsHost() {
+		target = profile.GOOS + "/" + profile.GOARCH
+	}
+	return hashParts("binary", code, string(data), target, toolchain)
+}
+
+func (c *ArtifactCache) codePath(key string) string {
+	return filepath.Join(c.dir, "code", key+".go")
+}
+
+func (c *ArtifactCache) binaryPath(key string) string {
+	return filepath.Join(c.dir, "bin", key)
+}
+
+// LoadCode 读取缓存的代码，c为nil或未命中时返回false
+func (c *ArtifactCache) LoadCode(key string) (string, bool) {
+	if c == nil || key == "" {
+		return "", false
+	}
+	data, err := os.ReadFile(c.codePath(key))
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+// StoreCode 缓存代码
+func (c *ArtifactCache) StoreCode(key, code string) error {
+	if c == nil || key == "" {
+		return nil
+	}
+	return writeFileAtomic(c.codePath(key), []byte(code), 0644)
+}
+
+// LoadBinary 将缓存的编译产物复制到dst，c为nil或未命中时返回false
+func (c *ArtifactCache) LoadBinary(key, dst string) bool {
+	if c == nil || key == "" {
+		return false
+	}
+	return copyFile(c.binaryPath(key), dst, 0755) == nil
+}
+
+// StoreBinary 缓存编译产物
+func (c *ArtifactCache) StoreBinary(key, src string) error {
+	if c == nil || key == "" {
+		return nil
+	}
+	return copyFile(src, c.binaryPath(key), 0755)
+}
+
+// copyFile 复制文件，先写临时文件再重命名，避免并发读到不完整的文件
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// writeFileAtomic 原子写入文件
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,153 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeLLM 测试用的LLM后端
+type fakeLLM struct {
+	model    string
+	response string
+}
+
+func (f *fakeLLM) ModelName() string { return f.model }
+func (f *fakeLLM) GenerateContext(ctx context.Context, prompt string) (string, error) {
+	return f.response, nil
+}
+func (f *fakeLLM) GenerateStream(ctx context.Context, prompt string, onToken TokenFunc) (string, error) {
+	onToken(f.response)
+	return f.response, nil
+}
+func (f *fakeLLM) Chat(ctx context.Context, messages []ChatMessage, onToken TokenFunc) (string, error) {
+	return f.response, nil
+}
+func (f *fakeLLM) Embed(text string) ([]float32, error) { return []float32{1}, nil }
+func (f *fakeLLM) EmbedContext(ctx context.Context, text string) ([]float32, error) {
+	return []float32{1}, nil
+}
+
+func TestArtifactCache(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewArtifactCache(filepath.Join(dir, "cache"))
+
+	if _, ok := cache.LoadCode("missing"); ok {
+		t.Error("LoadCode hit on an empty cache")
+	}
+	if err := cache.StoreCode("k1", "package main\n"); err != nil {
+		t.Fatal(err)
+	}
+	if code, ok := cache.LoadCode("k1"); !ok || code != "package main\n" {
+		t.Errorf("LoadCode = %q, %v", code, ok)
+	}
+
+	src := filepath.Join(dir, "binary")
+	os.WriteFile(src, []byte("ELF"), 0755)
+	key := BinaryKey("package main\n", BuildProfile{}, ToolchainKey(""))
+	if err := cache.StoreBinary(key, src); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(dir, "out", "test_binary")
+	if !cache.LoadBinary(key, dst) {
+		t.Fatal("LoadBinary missed a stored binary")
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "ELF" {
+		t.Errorf("LoadBinary copied %q", data)
+	}
+
+	android := AndroidBuildProfile("arm64-v8a", "clang")
+	if BinaryKey("package main\n", android, ToolchainKey("")) == key {
+		t.Error("BinaryKey ignores the build profile")
+	}
+
+	var disabled *ArtifactCache
+	if disabled.LoadBinary(key, dst) || disabled.StoreCode("k", "x") != nil {
+		t.Error("nil cache should always miss")
+	}
+}
+
+func TestToolchainKey(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "go.mod"), []byte("module example.com/demo\n"), 0644)
+	os.WriteFile(filepath.Join(root, "go.sum"), []byte("example.com/dep v1.0.0 h1:a=\n"), 0644)
+	before := ToolchainKey(root)
+	if before == ToolchainKey("") {
+		t.Error("ToolchainKey ignores the module dependencies")
+	}
+
+	// 依赖升级后编译缓存键改变
+	os.WriteFile(filepath.Join(root, "go.sum"), []byte("example.com/dep v1.1.0 h1:b=\n"), 0644)
+	after := ToolchainKey(root)
+	if after == before {
+		t.Error("ToolchainKey ignores go.sum")
+	}
+	if BinaryKey("package main\n", BuildProfile{}, before) == BinaryKey("package main\n", BuildProfile{}, after) {
+		t.Error("BinaryKey ignores the toolchain key")
+	}
+}
+
+func TestCodeGeneratorCacheKey(t *testing.T) {
+	kb := newTestKnowledgeBase(t)
+	cg := NewCodeGenerator(kb)
+	if cg.CacheKey("点击登录按钮", nil, "") != "" {
+		t.Error("template generation should not be cached")
+	}
+
+	dir := t.TempDir()
+	cg.EnableLLM(&fakeLLM{model: "llama3.2:latest"})
+	cg.SetPrompts(NewPromptStore(dir))
+	key := cg.CacheKey("点击登录按钮", nil, "")
+	if key == "" || key != cg.CacheKey(" 点击登录按钮 ", nil, "") {
+		t.Fatalf("CacheKey not stable: %q", key)
+	}
+
+	os.WriteFile(filepath.Join(dir, "generate.tmpl"), []byte("{{.Query}}"), 0644)
+	if cg.CacheKey("点击登录按钮", nil, "") == key {
+		t.Error("CacheKey ignores the prompt version")
+	}
+	cg.EnableLLM(&fakeLLM{model: "qwen2.5"})
+	if cg.CacheKey("点击登录按钮", nil, "") == key {
+		t.Error("CacheKey ignores the model")
+	}
+}
+
+func TestTemplateFallbackNotCached(t *testing.T) {
+	ag := newPipelineAgent(t, NewFakeExecutor(nil), func(cfg *AgentConfig) {
+		cfg.AutoExecute = false
+	})
+	llm := &scriptedLLM{fakeLLM: fakeLLM{model: "fake"}, responses: []string{"抱歉，我无法完成这个请求。", pipelineResponse}}
+	ag.codeGen.EnableLLM(llm)
+
+	// 预先缓存模板代码的编译产物，使回退后的编译成功
+	gen, err := ag.codeGen.Generate(context.Background(), "点击登录按钮", nil, "")
+	if err != nil || gen.Source != CodeSourceTemplate || gen.FallbackReason == "" {
+		t.Fatalf("Generate = %+v, %v, want a template fallback", gen, err)
+	}
+	binary := filepath.Join(t.TempDir(), "template")
+	os.WriteFile(binary, []byte("fake binary"), 0755)
+	ag.cache.StoreBinary(BinaryKey(gen.Code, ag.options.Build, ag.toolchain), binary)
+	llm.responses = []string{"抱歉，我无法完成这个请求。", pipelineResponse}
+	llm.prompts = nil
+
+	first, report, err := runPipeline(t, ag)
+	if err != nil || !first.Success || first.GenerationFallback == "" {
+		t.Fatalf("first run = %+v, %v, want a successful template fallback", first, err)
+	}
+	if _, hit := ag.cache.LoadCode(report.Cache.CodeKey); hit {
+		t.Fatal("template fallback was stored in the code cache")
+	}
+
+	// 下一次仍然调用LLM，成功后才写入缓存
+	second, report, err := runPipeline(t, ag)
+	if err != nil || !second.Success || second.GenerationFallback != "" || report.Cache.CodeHit {
+		t.Fatalf("second run = %+v, %v", second, err)
+	}
+	if len(llm.prompts) != 2 {
+		t.Errorf("LLM called %d times, want 2", len(llm.prompts))
+	}
+	if code, hit := ag.cache.LoadCode(report.Cache.CodeKey); !hit || code != second.Code {
+		t.Errorf("LLM code not cached: hit=%v", hit)
+	}
+}
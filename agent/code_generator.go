@@ -1,149 +1,105 @@
 package agent
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 )
 
 // CodeGenerator 代码生成器
 type CodeGenerator struct {
-	kb     *KnowledgeBase
-	ollama *OllamaClient
-	useLLM bool
+	kb      *KnowledgeBase
+	llm     LLMBackend
+	useLLM  bool
+	prompts *PromptStore
 }
 
 // NewCodeGenerator 创建代码生成器
 func NewCodeGenerator(kb *KnowledgeBase) *CodeGenerator {
-	return &CodeGenerator{kb: kb}
+	return &CodeGenerator{kb: kb, prompts: NewPromptStore("")}
+}
+
+// SetPrompts 设置提示词模板库
+func (cg *CodeGenerator) SetPrompts(prompts *PromptStore) {
+	cg.prompts = prompts
 }
 
 // EnableLLM 启用LLM生成
-func (cg *CodeGenerator) EnableLLM(client *OllamaClient) {
-	cg.ollama = client
-	cg.useLLM = client != nil
+func (cg *CodeGenerator) EnableLLM(backend LLMBackend) {
+	cg.llm = backend
+	cg.useLLM = backend != nil
 }
 
 // GenerateTestScript 根据用户输入生成测试脚本
 func (cg *CodeGenerator) GenerateTestScript(userQuery string, memoryContext string) (string, error) {
 	// 获取相关API文档
-	context, err := cg.kb.GetContext(userQuery)
+	docs, err := cg.kb.RetrieveDocs(context.Background(), userQuery)
 	if err != nil {
 		return "", err
 	}
 
-	// 解析用户意图
-	intent := cg.parseIntent(userQuery)
-	
-	// 生成代码
-	if cg.useLLM && cg.ollama != nil {
-		code, err := cg.generateCodeWithLLM(intent, context, memoryContext)
-		if err == nil && strings.TrimSpace(code) != "" {
-			return code, nil
-		}
+	gen, err := cg.Generate(context.Background(), userQuery, docs, memoryContext)
+	if err != nil {
+		return "", err
 	}
+	return gen.Code, nil
+}
 
-	code := cg.generateCode(intent, context)
+// 生成代码的来源
+const (
+	CodeSourceLLM      = "llm"
+	CodeSourceTemplate = "template"
+)
 
-	return code, nil
+// Generation 一次代码生成的结果
+type Generation struct {
+	Code string
+	// Source 代码来源: CodeSourceLLM 或 CodeSourceTemplate，只有LLM生成的代码可以写入代码缓存
+	Source string
+	// FallbackReason LLM生成失败、改用模板生成的原因，如无法从响应中提取代码的说明
+	FallbackReason string
 }
 
-// Intent 用户意图
-type Intent struct {
-	Action      string            // 操作类型: click, input, assert, wait, etc.
-	Target      string            // 目标: button, text, image, etc.
-	Value       string            // 值: 坐标、文本、图片路径等
-	Module      string            // 使用的模块
-	Parameters  map[string]string // 额外参数
-}
+// Generate 根据用户输入和已检索的API文档生成测试脚本，ctx取消时中断LLM请求
+func (cg *CodeGenerator) Generate(ctx context.Context, userQuery string, docs []APIDoc, memoryContext string) (*Generation, error) {
+	// 拆分测试步骤并解析每一步的意图
+	plan := cg.Plan(userQuery)
 
-func (i Intent) String() string {
-	var builder strings.Builder
-	builder.WriteString(fmt.Sprintf("Action: %s\n", i.Action))
-	builder.WriteString(fmt.Sprintf("Target: %s\n", i.Target))
-	if i.Value != "" {
-		builder.WriteString(fmt.Sprintf("Value: %s\n", i.Value))
-	}
-	if i.Module != "" {
-		builder.WriteString(fmt.Sprintf("Module: %s\n", i.Module))
-	}
-	if len(i.Parameters) > 0 {
-		builder.WriteString("Parameters:\n")
-		for k, v := range i.Parameters {
-			builder.WriteString(fmt.Sprintf(" - %s: %s\n", k, v))
+	// 生成代码
+	gen := &Generation{}
+	if cg.useLLM && cg.llm != nil {
+		code, err := cg.generateCodeWithLLM(ctx, plan, docs, memoryContext)
+		if err == nil {
+			gen.Code, gen.Source = code, CodeSourceLLM
+			return gen, nil
 		}
-	}
-	return builder.String()
-}
-
-// parseIntent 解析用户意图
-func (cg *CodeGenerator) parseIntent(query string) Intent {
-	queryLower := strings.ToLower(query)
-	intent := Intent{
-		Parameters: make(map[string]string),
-	}
-
-	// 检测操作类型
-	if strings.Contains(queryLower, "点击") || strings.Contains(queryLower, "click") {
-		intent.Action = "click"
-	} else if strings.Contains(queryLower, "输入") || strings.Contains(queryLower, "input") || strings.Contains(queryLower, "输入文本") {
-		intent.Action = "input"
-	} else if strings.Contains(queryLower, "验证") || strings.Contains(queryLower, "检查") || strings.Contains(queryLower, "assert") {
-		intent.Action = "assert"
-	} else if strings.Contains(queryLower, "等待") || strings.Contains(queryLower, "wait") {
-		intent.Action = "wait"
-	} else if strings.Contains(queryLower, "启动") || strings.Contains(queryLower, "launch") || strings.Contains(queryLower, "打开") {
-		intent.Action = "launch"
-	} else if strings.Contains(queryLower, "滑动") || strings.Contains(queryLower, "swipe") {
-		intent.Action = "swipe"
-	}
-
-	// 检测目标类型
-	if strings.Contains(queryLower, "按钮") || strings.Contains(queryLower, "button") {
-		intent.Target = "button"
-	} else if strings.Contains(queryLower, "输入框") || strings.Contains(queryLower, "input") || strings.Contains(queryLower, "文本框") {
-		intent.Target = "input"
-	} else if strings.Contains(queryLower, "图片") || strings.Contains(queryLower, "image") || strings.Contains(queryLower, "图像") {
-		intent.Target = "image"
-	} else if strings.Contains(queryLower, "文字") || strings.Contains(queryLower, "text") || strings.Contains(queryLower, "文本") {
-		intent.Target = "text"
-	}
-
-	// 提取文本内容（引号内的内容）
-	if idx := strings.Index(query, "\""); idx != -1 {
-		if idx2 := strings.Index(query[idx+1:], "\""); idx2 != -1 {
-			intent.Value = query[idx+1 : idx+idx2+1]
+		// 超时或取消时不再回退到模板，交由调用方处理
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
 		}
+		fmt.Printf("[Agent] LLM生成失败，使用模板生成: %v\n", err)
+		gen.FallbackReason = err.Error()
 	}
 
-	// 提取坐标
-	if strings.Contains(query, "(") && strings.Contains(query, ",") {
-		// 尝试提取坐标
-		parts := strings.Fields(query)
-		for _, part := range parts {
-			if strings.Contains(part, ",") && strings.Contains(part, "(") {
-				intent.Value = part
-				intent.Target = "coordinate"
-				break
-			}
-		}
-	}
+	gen.Code, gen.Source = cg.generateCode(plan, FormatContext(docs)), CodeSourceTemplate
+	return gen, nil
+}
 
-	// 检测使用的模块
-	if strings.Contains(queryLower, "ui") || strings.Contains(queryLower, "控件") {
-		intent.Module = "uiacc"
-	} else if strings.Contains(queryLower, "图像") || strings.Contains(queryLower, "图片") || strings.Contains(queryLower, "模板") {
-		intent.Module = "opencv"
-	} else if strings.Contains(queryLower, "ocr") || strings.Contains(queryLower, "识别") || strings.Contains(queryLower, "文字") {
-		intent.Module = "ppocr"
-	} else if strings.Contains(queryLower, "坐标") || strings.Contains(queryLower, "点击") {
-		intent.Module = "motion"
+// CacheKey 返回LLM生成代码的缓存键，由查询、检索上下文、对话记忆、模型和提示词版本决定；
+// 未启用LLM时返回空字符串（模板生成无需缓存）
+func (cg *CodeGenerator) CacheKey(userQuery string, docs []APIDoc, memoryContext string) string {
+	if !cg.useLLM || cg.llm == nil {
+		return ""
 	}
-
-	return intent
+	model := cg.llm.ModelName()
+	return hashParts("code", strings.TrimSpace(userQuery), FormatContext(docs), memoryContext,
+		model, cg.prompts.Version(PromptGenerate, model))
 }
 
-// generateCode 生成代码
-func (cg *CodeGenerator) generateCode(intent Intent, context string) string {
+// generateCode 生成代码，每个步骤对应一个返回error的函数，按顺序执行并在首个失败步骤处退出
+func (cg *CodeGenerator) generateCode(plan *TestPlan, apiContext string) string {
 	var code strings.Builder
 
 	// 添加包声明和导入
@@ -151,145 +107,320 @@ func (cg *CodeGenerator) generateCode(intent Intent, context string) string {
 	code.WriteString("import (\n")
 	code.WriteString("\t\"fmt\"\n")
 	code.WriteString("\t\"os\"\n")
-	code.WriteString("\t\"strings\"\n")
-	code.WriteString("\t\"time\"\n\n")
-	
+	if cg.needsStrings(plan) {
+		code.WriteString("\t\"strings\"\n")
+	}
+
 	// 根据需要的模块添加导入
-	modules := cg.getRequiredModules(intent)
+	modules := cg.getRequiredModules(plan)
+	if len(modules) > 0 {
+		code.WriteString("\n")
+	}
 	for _, module := range modules {
 		code.WriteString(fmt.Sprintf("\t\"github.com/xiaocainiao633/Genie1.0--/%s\"\n", module))
 	}
-	code.WriteString("\t\"github.com/xiaocainiao633/Genie1.0--/utils\"\n")
 	code.WriteString(")\n\n")
 
-	// 添加主函数
+	// 添加主函数，步骤通过steps包上报结构化结果
 	code.WriteString("func main() {\n")
 	code.WriteString("\tfmt.Println(\"开始执行自动化测试...\")\n\n")
+	code.WriteString("\terr := steps.RunAll([]steps.Step{\n")
+	for _, s := range plan.Steps {
+		code.WriteString(fmt.Sprintf("\t\t{Name: %q, Run: step%d},\n", s.Text, s.Index))
+	}
+	code.WriteString("\t})\n")
+	code.WriteString("\tif err != nil {\n")
+	code.WriteString("\t\tfmt.Printf(\"❌ %v\\n\", err)\n")
+	code.WriteString("\t\tos.Exit(1)\n")
+	code.WriteString("\t}\n\n")
+	code.WriteString("\tfmt.Println(\"测试完成\")\n")
+	code.WriteString("}\n")
+
+	// 根据意图生成每个步骤
+	for _, s := range plan.Steps {
+		code.WriteString(fmt.Sprintf("\n// step%d %s\n", s.Index, s.Text))
+		code.WriteString(fmt.Sprintf("func step%d() error {\n", s.Index))
+		body := cg.generateStepCode(s.Intent)
+		code.WriteString(body)
+		if !strings.HasPrefix(lastLine(body), "\treturn ") {
+			code.WriteString("\treturn nil\n")
+		}
+		code.WriteString("}\n")
+	}
+
+	return code.String()
+}
+
+// lastLine 返回代码片段的最后一行
+func lastLine(code string) string {
+	code = strings.TrimRight(code, "\n")
+	return code[strings.LastIndex(code, "\n")+1:]
+}
 
-	// 根据意图生成代码
+// generateStepCode 生成单个步骤的函数体
+func (cg *CodeGenerator) generateStepCode(intent Intent) string {
 	switch intent.Action {
 	case "click":
-		code.WriteString(cg.generateClickCode(intent))
+		return cg.generateClickCode(intent)
 	case "input":
-		code.WriteString(cg.generateInputCode(intent))
+		return cg.generateInputCode(intent)
 	case "assert":
-		code.WriteString(cg.generateAssertCode(intent))
+		return cg.generateAssertCode(intent)
 	case "wait":
-		code.WriteString(cg.generateWaitCode(intent))
+		return cg.generateWaitCode(intent)
 	case "launch":
-		code.WriteString(cg.generateLaunchCode(intent))
+		return cg.generateLaunchCode(intent)
 	case "swipe":
-		code.WriteString(cg.generateSwipeCode(intent))
+		return cg.generateSwipeCode(intent)
+	case "long_click":
+		return cg.generateLongClickCode(intent)
+	case "key":
+		return cg.generateKeyCode(intent)
+	case "scroll_to":
+		return cg.generateScrollToCode(intent)
+	case "force_stop", "clear_data", "install", "uninstall":
+		return cg.generateAppCode(intent)
+	case "clipboard":
+		return cg.generateClipboardCode(intent)
+	case "volume":
+		return cg.generateVolumeCode(intent)
+	case "screenshot":
+		return cg.generateScreenshotCode(intent)
 	default:
-		code.WriteString("\t// 未识别的操作类型\n")
+		if negated := intent.Parameters["negated"]; negated != "" {
+			return fmt.Sprintf("\t// 否定的操作（%s），不执行\n", negated)
+		}
+		return "\t// 未识别的操作类型\n"
 	}
+}
 
-	code.WriteString("\tfmt.Println(\"测试完成\")\n")
-	code.WriteString("}\n")
-
-	return code.String()
+// complete 调用LLM，ctx中带有流式回调时以流式方式生成
+func (cg *CodeGenerator) complete(ctx context.Context, prompt string) (string, error) {
+	if onToken := tokenFuncFrom(ctx); onToken != nil {
+		return cg.llm.GenerateStream(ctx, prompt, onToken)
+	}
+	return cg.llm.GenerateContext(ctx, prompt)
 }
 
-func (cg *CodeGenerator) generateCodeWithLLM(intent Intent, context, memoryContext string) (string, error) {
-	if cg.ollama == nil {
+func (cg *CodeGenerator) generateCodeWithLLM(ctx context.Context, plan *TestPlan, docs []APIDoc, memoryContext string) (string, error) {
+	if cg.llm == nil {
 		return "", fmt.Errorf("LLM未配置")
 	}
 
-	var prompt strings.Builder
-	prompt.WriteString("你是一名资深的Go语言自动化测试工程师。")
-	prompt.WriteString("请根据以下信息生成一个完整的Go测试脚本，脚本会在AutoGo环境中执行。\n\n")
-	if memoryContext != "" {
-		prompt.WriteString(memoryContext + "\n")
+	prompt, err := cg.prompts.Render(PromptGenerate, cg.llm.ModelName(), PromptData{
+		Query:      plan.Query,
+		Intent:     plan.String(),
+		Steps:      plan.Steps,
+		APIContext: FormatContext(docs),
+		Memory:     memoryContext,
+		Examples:   promptExamples(docs),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	response, err := cg.complete(ctx, prompt)
+	if err != nil {
+		return "", err
 	}
-	prompt.WriteString("相关API文档:\n")
-	prompt.WriteString(context + "\n")
-	prompt.WriteString("用户需求:\n")
-	prompt.WriteString(intent.String() + "\n\n")
-	prompt.WriteString("要求：\n")
-	prompt.WriteString("1. 必须包含package main和main函数。\n")
-	prompt.WriteString("2. 导入必要的AutoGo模块。\n")
-	prompt.WriteString("3. 代码可直接编译运行。\n")
-	prompt.WriteString("4. 添加必要的错误处理和日志输出。\n")
 
-	response, err := cg.ollama.Generate(prompt.String())
+	return ExtractGoCode(response)
+}
+
+// activeLLM 返回启用中的LLM后端，未启用时为nil
+func (cg *CodeGenerator) activeLLM() LLMBackend {
+	if !cg.useLLM {
+		return nil
+	}
+	return cg.llm
+}
+
+// Summarize 通过LLM将较早的对话合并到已有摘要中，limit为摘要的最大字数
+func (cg *CodeGenerator) Summarize(ctx context.Context, summary string, messages []Message, limit int) (string, error) {
+	llm := cg.activeLLM()
+	if llm == nil {
+		return "", fmt.Errorf("LLM未配置")
+	}
+	var conversation strings.Builder
+	for _, msg := range messages {
+		conversation.WriteString(fmt.Sprintf("[%s] %s\n", msg.Role, msg.Content))
+	}
+	prompt, err := cg.prompts.Render(PromptSummarize, llm.ModelName(), PromptData{
+		Memory:       summary,
+		Conversation: conversation.String(),
+		Limit:        limit,
+	})
 	if err != nil {
 		return "", err
 	}
+	return llm.GenerateContext(ctx, prompt)
+}
 
-	return strings.TrimSpace(response), nil
+// CanRepair 是否可以通过LLM修复编译错误
+func (cg *CodeGenerator) CanRepair() bool {
+	return cg.useLLM && cg.llm != nil
 }
 
-// getRequiredModules 获取需要的模块
-func (cg *CodeGenerator) getRequiredModules(intent Intent) []string {
-	modules := make(map[string]bool)
-	
-	if intent.Module != "" {
-		modules[intent.Module] = true
+// RepairTestScript 将编译错误、失败代码和相关API文档交给LLM修复
+func (cg *CodeGenerator) RepairTestScript(ctx context.Context, userQuery string, docs []APIDoc, code, diagnostics string) (string, error) {
+	if !cg.CanRepair() {
+		return "", fmt.Errorf("LLM未配置")
 	}
-	
-	// 根据操作类型添加必要模块
-	switch intent.Action {
-	case "click":
-		if intent.Target == "image" {
-			modules["opencv"] = true
-			modules["images"] = true
-		}
-		modules["motion"] = true
-	case "input":
-		modules["uiacc"] = true
-		modules["ime"] = true
-	case "assert":
-		if intent.Target == "text" {
-			modules["ppocr"] = true
-			modules["images"] = true
-		} else if intent.Target == "image" {
-			modules["opencv"] = true
-			modules["images"] = true
+
+	prompt, err := cg.prompts.Render(PromptRepair, cg.llm.ModelName(), PromptData{
+		Query:       userQuery,
+		APIContext:  FormatContext(docs),
+		Examples:    promptExamples(docs),
+		Code:        code,
+		Diagnostics: diagnostics,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	response, err := cg.complete(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+
+	return ExtractGoCode(response)
+}
+
+// getRequiredModules 获取所有步骤需要的模块
+func (cg *CodeGenerator) getRequiredModules(plan *TestPlan) []string {
+	// 生成的脚本总是通过steps包上报步骤结果
+	modules := map[string]bool{"steps": true}
+
+	// 根据操作类型添加必要模块，需与各步骤生成的代码保持一致
+	for _, s := range plan.Steps {
+		intent := s.Intent
+		switch intent.Action {
+		case "click":
+			if intent.Target == "color" && intent.Value != "" {
+				modules["images"] = true
+				modules["motion"] = true
+			} else if intent.Target == "coordinate" && intent.Point != nil {
+				modules["motion"] = true
+			} else if intent.Target == "button" && intent.Value != "" {
+				modules["uiacc"] = true
+			}
+		case "input":
+			if intent.Value == "" {
+				continue
+			}
+			if intent.Target == "input" {
+				modules["uiacc"] = true
+			} else {
+				modules["ime"] = true
+			}
+		case "assert":
+			if intent.Value == "" {
+				continue
+			}
+			if intent.Target == "text" {
+				modules["ppocr"] = true
+				modules["images"] = true
+			} else if intent.Target == "color" {
+				modules["images"] = true
+			}
+		case "wait":
+			if intent.Value != "" {
+				modules["uiacc"] = true
+			} else {
+				modules["utils"] = true
+			}
+		case "launch":
+			if intent.Value != "" {
+				modules["app"] = true
+				modules["utils"] = true
+			}
+		case "swipe":
+			modules["motion"] = true
+			if intent.From == nil || intent.To == nil {
+				if _, ok := swipeByDirection[intent.Direction]; ok {
+					modules["device"] = true
+				}
+			}
+		case "long_click":
+			if intent.Target == "coordinate" && intent.Point != nil {
+				modules["motion"] = true
+			} else if intent.Value != "" {
+				modules["uiacc"] = true
+				modules["motion"] = true
+			}
+		case "key":
+			if _, ok := keyFunctions[intent.Value]; ok {
+				modules["motion"] = true
+			}
+		case "scroll_to":
+			if intent.Value != "" {
+				modules["uiacc"] = true
+				modules["utils"] = true
+			}
+		case "force_stop", "clear_data", "install", "uninstall":
+			if intent.Value != "" {
+				modules["app"] = true
+			}
+		case "clipboard":
+			if intent.Value != "" {
+				modules["ime"] = true
+			}
+		case "volume":
+			if intent.Value != "" {
+				modules["device"] = true
+			}
+		case "screenshot":
+			if intent.Value != "" {
+				modules["images"] = true
+			}
 		}
-	case "launch":
-		modules["app"] = true
 	}
 
 	result := make([]string, 0, len(modules))
 	for module := range modules {
 		result = append(result, module)
 	}
+	sort.Strings(result)
 	return result
 }
 
+// needsStrings 判断生成的代码是否用到strings包
+func (cg *CodeGenerator) needsStrings(plan *TestPlan) bool {
+	for _, s := range plan.Steps {
+		if s.Intent.Action == "assert" && s.Intent.Target == "text" && s.Intent.Value != "" {
+			return true
+		}
+	}
+	return false
+}
+
 // generateClickCode 生成点击代码
 func (cg *CodeGenerator) generateClickCode(intent Intent) string {
 	var code strings.Builder
 
-	if intent.Target == "coordinate" {
+	if intent.Target == "color" && intent.Value != "" {
+		// 查找颜色并点击
+		code.WriteString(findColorCode(intent))
+		code.WriteString("\tif x == -1 || y == -1 {\n")
+		code.WriteString(fmt.Sprintf("\t\treturn fmt.Errorf(\"未找到颜色: %%s\", %q)\n", intent.Value))
+		code.WriteString("\t}\n")
+		code.WriteString("\tmotion.Click(x, y, 1)\n")
+		code.WriteString("\tfmt.Printf(\"找到颜色并点击，坐标: (%d, %d)\\n\", x, y)\n")
+	} else if intent.Target == "coordinate" && intent.Point != nil {
 		// 直接坐标点击
 		code.WriteString("\t// 在指定坐标点击\n")
-		code.WriteString(fmt.Sprintf("\tmotion.Click(%s, 1)\n", intent.Value))
+		code.WriteString(fmt.Sprintf("\tmotion.Click(%d, %d, 1)\n", intent.Point.X, intent.Point.Y))
 	} else if intent.Target == "button" && intent.Value != "" {
 		// 通过文本查找按钮
 		code.WriteString("\t// 查找并点击按钮\n")
-		code.WriteString(fmt.Sprintf("\tobj := uiacc.New().Text(\"%s\").FindOnce()\n", intent.Value))
-		code.WriteString("\tif obj != nil {\n")
-		code.WriteString("\t\tobj.Click()\n")
-		code.WriteString("\t\tfmt.Println(\"点击成功\")\n")
-		code.WriteString("\t} else {\n")
-		code.WriteString("\t\tfmt.Println(\"未找到按钮\")\n")
+		code.WriteString(fmt.Sprintf("\tobj := uiacc.New().Text(%q).FindOnce()\n", intent.Value))
+		code.WriteString("\tif obj == nil {\n")
+		code.WriteString(fmt.Sprintf("\t\treturn fmt.Errorf(\"未找到按钮: %%s\", %q)\n", intent.Value))
 		code.WriteString("\t}\n")
+		code.WriteString("\tobj.Click()\n")
+		code.WriteString("\tfmt.Println(\"点击成功\")\n")
 	} else if intent.Target == "image" && intent.Value != "" {
-		// 通过图像匹配点击
-		code.WriteString("\t// 通过图像匹配查找并点击\n")
-		code.WriteString(fmt.Sprintf("\ttemplateBytes, err := os.ReadFile(\"%s\")\n", intent.Value))
-		code.WriteString("\tif err != nil {\n")
-		code.WriteString("\t\tfmt.Printf(\"读取模板失败: %%v\\n\", err)\n")
-		code.WriteString("\t\treturn\n")
-		code.WriteString("\t}\n")
-		code.WriteString("\tx, y := opencv.FindImage(0, 0, 0, 0, &templateBytes, false, 1.0, 0.8)\n")
-		code.WriteString("\tif x != -1 && y != -1 {\n")
-		code.WriteString("\t\tmotion.Click(x, y, 1)\n")
-		code.WriteString("\t\tfmt.Printf(\"找到并点击，坐标: (%%d, %%d)\\n\", x, y)\n")
-		code.WriteString("\t} else {\n")
-		code.WriteString("\t\tfmt.Println(\"未找到目标图像\")\n")
-		code.WriteString("\t}\n")
+		code.WriteString(unsupportedImageCode(intent))
 	} else {
 		code.WriteString("\t// 通用点击代码\n")
 		code.WriteString("\t// 请根据实际情况修改\n")
@@ -298,6 +429,11 @@ func (cg *CodeGenerator) generateClickCode(intent Intent) string {
 	return code.String()
 }
 
+// unsupportedImageCode AutoGo没有图像模板匹配的API，图像步骤执行时报告失败而不是静默跳过
+func unsupportedImageCode(intent Intent) string {
+	return fmt.Sprintf("\treturn fmt.Errorf(\"不支持图像模板匹配: %%s，请改用文字、控件或坐标定位\", %q)\n", intent.Value)
+}
+
 // generateInputCode 生成输入代码
 func (cg *CodeGenerator) generateInputCode(intent Intent) string {
 	var code strings.Builder
@@ -307,14 +443,15 @@ func (cg *CodeGenerator) generateInputCode(intent Intent) string {
 		if intent.Target == "input" {
 			code.WriteString("\t// 查找输入框\n")
 			code.WriteString("\tinputObj := uiacc.New().Editable(true).FindOnce()\n")
-			code.WriteString("\tif inputObj != nil {\n")
-			code.WriteString(fmt.Sprintf("\t\tinputObj.SetText(\"%s\")\n", intent.Value))
-			code.WriteString("\t\tfmt.Println(\"输入成功\")\n")
-			code.WriteString("\t} else {\n")
-			code.WriteString("\t\tfmt.Println(\"未找到输入框\")\n")
+			code.WriteString("\tif inputObj == nil {\n")
+			code.WriteString("\t\treturn fmt.Errorf(\"未找到输入框\")\n")
 			code.WriteString("\t}\n")
+			code.WriteString(fmt.Sprintf("\tif !inputObj.SetText(%q) {\n", intent.Value))
+			code.WriteString("\t\treturn fmt.Errorf(\"输入框设置文本失败\")\n")
+			code.WriteString("\t}\n")
+			code.WriteString("\tfmt.Println(\"输入成功\")\n")
 		} else {
-			code.WriteString(fmt.Sprintf("\time.InputText(\"%s\")\n", intent.Value))
+			code.WriteString(fmt.Sprintf("\time.InputText(%q)\n", intent.Value))
 		}
 	} else {
 		code.WriteString("\t// 输入代码（需要指定文本内容）\n")
@@ -331,32 +468,17 @@ func (cg *CodeGenerator) generateAssertCode(intent Intent) string {
 		code.WriteString("\t// 验证文本是否存在\n")
 		code.WriteString("\timg := images.CaptureScreen(0, 0, 0, 0)\n")
 		code.WriteString("\tresults := ppocr.OcrFromImage(img, \"\")\n")
-		code.WriteString("\tfound := false\n")
 		code.WriteString("\tfor _, result := range results {\n")
-		code.WriteString(fmt.Sprintf("\t\tif strings.Contains(result.Label, \"%s\") {\n", intent.Value))
-		code.WriteString("\t\t\tfound = true\n")
-		code.WriteString("\t\t\tfmt.Printf(\"找到文本: %%s\\n\", result.Label)\n")
-		code.WriteString("\t\t\tbreak\n")
+		code.WriteString(fmt.Sprintf("\t\tif strings.Contains(result.Label, %q) {\n", intent.Value))
+		code.WriteString("\t\t\treturn steps.Assert(true, \"找到文本 %s\", result.Label)\n")
 		code.WriteString("\t\t}\n")
 		code.WriteString("\t}\n")
-		code.WriteString("\tif found {\n")
-		code.WriteString("\t\tfmt.Println(\"✅ 断言通过：文本存在\")\n")
-		code.WriteString("\t} else {\n")
-		code.WriteString("\t\tfmt.Println(\"❌ 断言失败：文本不存在\")\n")
-		code.WriteString("\t}\n")
+		code.WriteString(fmt.Sprintf("\treturn steps.Assert(false, \"文本不存在: %%s\", %q)\n", intent.Value))
+	} else if intent.Target == "color" && intent.Value != "" {
+		code.WriteString(findColorCode(intent))
+		code.WriteString(fmt.Sprintf("\treturn steps.Assert(x != -1 && y != -1, \"找到颜色 %%s，坐标: (%%d, %%d)\", %q, x, y)\n", intent.Value))
 	} else if intent.Target == "image" && intent.Value != "" {
-		code.WriteString("\t// 验证图像是否存在\n")
-		code.WriteString(fmt.Sprintf("\ttemplateBytes, err := os.ReadFile(\"%s\")\n", intent.Value))
-		code.WriteString("\tif err != nil {\n")
-		code.WriteString("\t\tfmt.Printf(\"读取模板失败: %%v\\n\", err)\n")
-		code.WriteString("\t\treturn\n")
-		code.WriteString("\t}\n")
-		code.WriteString("\tx, y := opencv.FindImage(0, 0, 0, 0, &templateBytes, false, 1.0, 0.8)\n")
-		code.WriteString("\tif x != -1 && y != -1 {\n")
-		code.WriteString("\t\tfmt.Printf(\"✅ 断言通过：图像存在，坐标: (%%d, %%d)\\n\", x, y)\n")
-		code.WriteString("\t} else {\n")
-		code.WriteString("\t\tfmt.Println(\"❌ 断言失败：图像不存在\")\n")
-		code.WriteString("\t}\n")
+		code.WriteString(unsupportedImageCode(intent))
 	} else {
 		code.WriteString("\t// 断言代码（需要指定验证内容）\n")
 	}
@@ -368,22 +490,20 @@ func (cg *CodeGenerator) generateAssertCode(intent Intent) string {
 func (cg *CodeGenerator) generateWaitCode(intent Intent) string {
 	var code strings.Builder
 
-	timeout := "5000"
-	if t, ok := intent.Parameters["timeout"]; ok {
-		timeout = t
+	timeout := int64(5000)
+	if intent.Duration > 0 {
+		timeout = intent.Duration.Milliseconds()
 	}
 
 	if intent.Value != "" {
 		code.WriteString("\t// 等待元素出现\n")
-		code.WriteString(fmt.Sprintf("\tobj := uiacc.New().Text(\"%s\").WaitFor(%s)\n", intent.Value, timeout))
-		code.WriteString("\tif obj != nil {\n")
-		code.WriteString("\t\tfmt.Println(\"元素已出现\")\n")
-		code.WriteString("\t} else {\n")
-		code.WriteString("\t\tfmt.Println(\"等待超时\")\n")
+		code.WriteString(fmt.Sprintf("\tif uiacc.New().Text(%q).WaitFor(%d) == nil {\n", intent.Value, timeout))
+		code.WriteString(fmt.Sprintf("\t\treturn fmt.Errorf(\"等待元素超时: %%s\", %q)\n", intent.Value))
 		code.WriteString("\t}\n")
+		code.WriteString("\tfmt.Println(\"元素已出现\")\n")
 	} else {
-		code.WriteString(fmt.Sprintf("\t// 等待 %s 毫秒\n", timeout))
-		code.WriteString(fmt.Sprintf("\tutils.Sleep(%s)\n", timeout))
+		code.WriteString(fmt.Sprintf("\t// 等待 %d 毫秒\n", timeout))
+		code.WriteString(fmt.Sprintf("\tutils.Sleep(%d)\n", timeout))
 	}
 
 	return code.String()
@@ -395,13 +515,11 @@ func (cg *CodeGenerator) generateLaunchCode(intent Intent) string {
 
 	if intent.Value != "" {
 		code.WriteString("\t// 启动应用\n")
-		code.WriteString(fmt.Sprintf("\tif app.Launch(\"%s\", 0) {\n", intent.Value))
-		code.WriteString("\t\tfmt.Println(\"应用启动成功\")\n")
-		code.WriteString("\t\tutils.Sleep(2000)\n")
-		code.WriteString("\t} else {\n")
-		code.WriteString("\t\tfmt.Println(\"应用启动失败\")\n")
-		code.WriteString("\t\treturn\n")
+		code.WriteString(fmt.Sprintf("\tif !app.Launch(%q, 0) {\n", intent.Value))
+		code.WriteString(fmt.Sprintf("\t\treturn fmt.Errorf(\"应用启动失败: %%s\", %q)\n", intent.Value))
 		code.WriteString("\t}\n")
+		code.WriteString("\tfmt.Println(\"应用启动成功\")\n")
+		code.WriteString("\tutils.Sleep(2000)\n")
 	} else {
 		code.WriteString("\t// 启动应用（需要指定包名）\n")
 	}
@@ -409,14 +527,202 @@ func (cg *CodeGenerator) generateLaunchCode(intent Intent) string {
 	return code.String()
 }
 
+// swipeByDirection 按方向滑动时相对屏幕宽高的起止点
+var swipeByDirection = map[string]string{
+	"up":    "w/2, h*3/4, w/2, h/4",
+	"down":  "w/2, h/4, w/2, h*3/4",
+	"left":  "w*3/4, h/2, w/4, h/2",
+	"right": "w/4, h/2, w*3/4, h/2",
+}
+
 // generateSwipeCode 生成滑动代码
 func (cg *CodeGenerator) generateSwipeCode(intent Intent) string {
 	var code strings.Builder
 
-	code.WriteString("\t// 执行滑动操作\n")
-	code.WriteString("\t// 请根据实际情况修改坐标\n")
-	code.WriteString("\tmotion.Swipe(100, 200, 300, 400, 500)\n")
+	duration := int64(500)
+	if intent.Duration > 0 {
+		duration = intent.Duration.Milliseconds()
+	}
+
+	if intent.From != nil && intent.To != nil {
+		code.WriteString(fmt.Sprintf("\t// 从%s滑动到%s\n", intent.From, intent.To))
+		code.WriteString(fmt.Sprintf("\tmotion.Swipe(%d, %d, %d, %d, %d)\n",
+			intent.From.X, intent.From.Y, intent.To.X, intent.To.Y, duration))
+	} else if points, ok := swipeByDirection[intent.Direction]; ok {
+		code.WriteString(fmt.Sprintf("\t// 按屏幕尺寸向%s滑动\n", intent.Direction))
+		code.WriteString("\tw, h := device.Width, device.Height\n")
+		code.WriteString(fmt.Sprintf("\tmotion.Swipe(%s, %d)\n", points, duration))
+	} else {
+		code.WriteString("\t// 执行滑动操作\n")
+		code.WriteString("\t// 请根据实际情况修改坐标\n")
+		code.WriteString(fmt.Sprintf("\tmotion.Swipe(100, 200, 300, 400, %d)\n", duration))
+	}
+
+	return code.String()
+}
+
+// findColorCode 生成查找颜色的代码，给出坐标时只检查该点，否则在全屏查找
+func findColorCode(intent Intent) string {
+	if intent.Point != nil {
+		return fmt.Sprintf("\t// 检查坐标%s的颜色\n\tx, y := images.FindColor(%d, %d, %d, %d, %q, 0.9, 0)\n",
+			intent.Point, intent.Point.X, intent.Point.Y, intent.Point.X+1, intent.Point.Y+1, intent.Value)
+	}
+	return fmt.Sprintf("\t// 在全屏查找颜色\n\tx, y := images.FindColor(0, 0, 0, 0, %q, 0.9, 0)\n", intent.Value)
+}
+
+// generateLongClickCode 生成长按代码
+func (cg *CodeGenerator) generateLongClickCode(intent Intent) string {
+	var code strings.Builder
+
+	duration := int64(1000)
+	if intent.Duration > 0 {
+		duration = intent.Duration.Milliseconds()
+	}
+
+	if intent.Target == "coordinate" && intent.Point != nil {
+		code.WriteString("\t// 在指定坐标长按\n")
+		code.WriteString(fmt.Sprintf("\tmotion.LongClick(%d, %d, %d)\n", intent.Point.X, intent.Point.Y, duration))
+	} else if intent.Value != "" {
+		code.WriteString("\t// 查找控件并在其中心长按\n")
+		code.WriteString(fmt.Sprintf("\tobj := uiacc.New().Text(%q).FindOnce()\n", intent.Value))
+		code.WriteString("\tif obj == nil {\n")
+		code.WriteString(fmt.Sprintf("\t\treturn fmt.Errorf(\"未找到控件: %%s\", %q)\n", intent.Value))
+		code.WriteString("\t}\n")
+		code.WriteString("\tbounds := obj.GetBounds()\n")
+		code.WriteString(fmt.Sprintf("\tmotion.LongClick(bounds.CenterX, bounds.CenterY, %d)\n", duration))
+		code.WriteString("\tfmt.Println(\"长按成功\")\n")
+	} else {
+		code.WriteString("\t// 长按代码（需要指定坐标或控件文字）\n")
+	}
 
 	return code.String()
 }
 
+// keyFunctions 系统按键对应的motion函数
+var keyFunctions = map[string]string{
+	"back":    "Back",
+	"home":    "Home",
+	"recents": "Recents",
+}
+
+// generateKeyCode 生成系统按键代码
+func (cg *CodeGenerator) generateKeyCode(intent Intent) string {
+	fn, ok := keyFunctions[intent.Value]
+	if !ok {
+		return "\t// 按键代码（需要指定返回、主页或多任务键）\n"
+	}
+	return fmt.Sprintf("\t// 按下%s键\n\tmotion.%s()\n", intent.Value, fn)
+}
+
+// maxScrolls 滚动查找的最大滚动次数
+const maxScrolls = 10
+
+// generateScrollToCode 生成滚动查找代码：滚动第一个可滚动的控件直到目标文字出现
+func (cg *CodeGenerator) generateScrollToCode(intent Intent) string {
+	if intent.Value == "" {
+		return "\t// 滚动查找代码（需要指定目标文字）\n"
+	}
+
+	scroll := "ScrollForward"
+	if intent.Direction == "up" || intent.Direction == "left" {
+		scroll = "ScrollBackward"
+	}
+
+	var code strings.Builder
+	code.WriteString("\t// 滚动列表直到目标文字出现\n")
+	code.WriteString("\tfor i := 0; ; i++ {\n")
+	code.WriteString(fmt.Sprintf("\t\tif uiacc.New().Text(%q).FindOnce() != nil {\n", intent.Value))
+	code.WriteString("\t\t\tfmt.Println(\"已找到目标\")\n")
+	code.WriteString("\t\t\treturn nil\n")
+	code.WriteString("\t\t}\n")
+	code.WriteString("\t\tlist := uiacc.New().Scrollable(true).FindOnce()\n")
+	code.WriteString(fmt.Sprintf("\t\tif i == %d || list == nil || !list.%s() {\n", maxScrolls, scroll))
+	code.WriteString(fmt.Sprintf("\t\t\treturn fmt.Errorf(\"滚动后仍未找到: %%s\", %q)\n", intent.Value))
+	code.WriteString("\t\t}\n")
+	code.WriteString("\t\tutils.Sleep(500)\n")
+	code.WriteString("\t}\n")
+	return code.String()
+}
+
+// generateAppCode 生成停止应用、清除数据、安装和卸载代码
+func (cg *CodeGenerator) generateAppCode(intent Intent) string {
+	if intent.Value == "" {
+		if intent.Action == "install" {
+			return "\t// 安装代码（需要指定apk路径）\n"
+		}
+		return "\t// 应用管理代码（需要指定包名）\n"
+	}
+
+	var code strings.Builder
+	switch intent.Action {
+	case "force_stop":
+		code.WriteString("\t// 强制停止应用\n")
+		code.WriteString(fmt.Sprintf("\tapp.ForceStop(%q)\n", intent.Value))
+	case "clear_data":
+		code.WriteString("\t// 清除应用数据\n")
+		code.WriteString(fmt.Sprintf("\tapp.Clear(%q)\n", intent.Value))
+	case "install":
+		code.WriteString("\t// 安装应用\n")
+		code.WriteString(fmt.Sprintf("\tapp.Install(%q)\n", intent.Value))
+		if intent.Package != "" {
+			code.WriteString(fmt.Sprintf("\tif !app.IsInstalled(%q) {\n", intent.Package))
+			code.WriteString(fmt.Sprintf("\t\treturn fmt.Errorf(\"应用安装失败: %%s\", %q)\n", intent.Package))
+			code.WriteString("\t}\n")
+		}
+	case "uninstall":
+		code.WriteString("\t// 卸载应用\n")
+		code.WriteString(fmt.Sprintf("\tapp.Uninstall(%q)\n", intent.Value))
+		code.WriteString(fmt.Sprintf("\tif !app.IsUninstalled(%q) {\n", intent.Value))
+		code.WriteString(fmt.Sprintf("\t\treturn fmt.Errorf(\"应用卸载失败: %%s\", %q)\n", intent.Value))
+		code.WriteString("\t}\n")
+	}
+	code.WriteString(fmt.Sprintf("\tfmt.Println(\"%s完成\")\n", appActionNames[intent.Action]))
+	return code.String()
+}
+
+// appActionNames 应用管理操作的名称
+var appActionNames = map[string]string{
+	"force_stop": "强制停止",
+	"clear_data": "清除数据",
+	"install":    "安装",
+	"uninstall":  "卸载",
+}
+
+// generateClipboardCode 生成设置剪贴板代码
+func (cg *CodeGenerator) generateClipboardCode(intent Intent) string {
+	if intent.Value == "" {
+		return "\t// 剪贴板代码（需要指定文本内容）\n"
+	}
+
+	var code strings.Builder
+	code.WriteString("\t// 设置剪贴板内容\n")
+	code.WriteString(fmt.Sprintf("\tif !ime.SetClipText(%q) {\n", intent.Value))
+	code.WriteString("\t\treturn fmt.Errorf(\"设置剪贴板失败\")\n")
+	code.WriteString("\t}\n")
+	return code.String()
+}
+
+// generateVolumeCode 生成设置媒体音量代码
+func (cg *CodeGenerator) generateVolumeCode(intent Intent) string {
+	volume, err := strconv.Atoi(intent.Value)
+	if err != nil {
+		return "\t// 音量代码（需要指定音量值）\n"
+	}
+	return fmt.Sprintf("\t// 设置媒体音量\n\tdevice.SetMusicVolume(%d)\n", volume)
+}
+
+// generateScreenshotCode 生成截图保存代码，并上报截图路径
+func (cg *CodeGenerator) generateScreenshotCode(intent Intent) string {
+	if intent.Value == "" {
+		return "\t// 截图代码（需要指定保存路径）\n"
+	}
+
+	var code strings.Builder
+	code.WriteString("\t// 截图并保存\n")
+	code.WriteString("\timg := images.CaptureScreen(0, 0, 0, 0)\n")
+	code.WriteString(fmt.Sprintf("\tif img == nil || !images.Save(img, %q, 100) {\n", intent.Value))
+	code.WriteString(fmt.Sprintf("\t\treturn fmt.Errorf(\"保存截图失败: %%s\", %q)\n", intent.Value))
+	code.WriteString("\t}\n")
+	code.WriteString(fmt.Sprintf("\tsteps.Screenshot(%q)\n", intent.Value))
+	return code.String()
+}
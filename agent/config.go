@@ -1,5 +1,14 @@
 package agent
 
+import (
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// DefaultMaxRepairAttempts 编译失败后交给LLM修复的默认最大次数
+const DefaultMaxRepairAttempts = 2
+
 // AgentConfig 代理配置
 type AgentConfig struct {
 	UseLLM       bool
@@ -8,6 +17,45 @@ type AgentConfig struct {
 	ReportDir    string
 	ADBPath      string
 	RemoteDir    string
+	// MaxRepairAttempts 编译失败后交给LLM修复的最大次数，nil使用DefaultMaxRepairAttempts，0或负数表示不修复
+	MaxRepairAttempts *int
+	// Build 编译配置，用于交叉编译到安卓设备
+	Build BuildProfile
+	// Timeouts 各阶段超时时间
+	Timeouts PhaseTimeouts
+	// ReportFormats 除JSON外额外输出的报告格式，如junit、html
+	ReportFormats []ReportFormat
+	// HistoryPath 报告历史库路径，默认为知识库同目录下的 report_history.db
+	HistoryPath string
+	// MemoryPath 对话记忆库路径，默认为知识库同目录下的 conversation_memory.db
+	MemoryPath string
+	// MemoryBudget 对话记忆的token预算，超出时较早的对话被总结，默认DefaultMemoryBudget
+	MemoryBudget int
+	// MemoryMaxAge 没有被保存的会话引用的对话记忆在超过该时长未更新后删除，
+	// 默认DefaultMemoryMaxAge，负数表示不删除
+	MemoryMaxAge time.Duration
+	// PromptDir 提示词模板目录，默认为工作目录下的 prompts
+	PromptDir string
+	// CacheDir 代码和编译产物缓存目录，默认为工作目录下的 cache
+	CacheDir string
+	// DisableCache 禁用缓存，每次都重新生成和编译
+	DisableCache bool
+	// Retention 非nil时每次执行结束后按该策略清理工作目录
+	Retention *RetentionPolicy
+	// Devices 执行设备的筛选条件，未指定ABI时使用编译配置的ABI
+	Devices DeviceFilter
+	// AllDevices 在所有满足条件的设备上并行执行，否则每次执行租借一台空闲设备
+	AllDevices bool
+	// Executor 执行后端: adb（默认）、host、ssh
+	Executor string
+	// SSH ssh执行后端的连接配置
+	SSH SSHConfig
+	// CustomExecutor 非nil时直接使用该执行器并忽略Executor，如测试中的FakeExecutor
+	CustomExecutor Executor
+	// KeepRemoteBinary 执行结束后保留推送到设备的二进制
+	KeepRemoteBinary bool
+	// Evidence 截图和界面控件树的采集时机，默认仅在执行失败时采集
+	Evidence EvidenceMode
 }
 
 func (cfg *AgentConfig) normalize() {
@@ -17,5 +65,45 @@ func (cfg *AgentConfig) normalize() {
 	if cfg.ReportDir == "" {
 		cfg.ReportDir = "./workspace/reports"
 	}
+	if cfg.PromptDir == "" {
+		cfg.PromptDir = filepath.Join(cfg.WorkspaceDir, "prompts")
+	}
+	if cfg.CacheDir == "" {
+		cfg.CacheDir = filepath.Join(cfg.WorkspaceDir, "cache")
+	}
+	if cfg.MaxRepairAttempts == nil {
+		attempts := DefaultMaxRepairAttempts
+		cfg.MaxRepairAttempts = &attempts
+	}
+	if cfg.MemoryBudget <= 0 {
+		cfg.MemoryBudget = DefaultMemoryBudget
+	}
+	if cfg.MemoryMaxAge == 0 {
+		cfg.MemoryMaxAge = DefaultMemoryMaxAge
+	}
+	if cfg.Evidence == "" {
+		cfg.Evidence = EvidenceOnFailure
+	}
+	// 本机执行时未指定编译配置则显式编译到宿主机，不受环境中GOOS/GOARCH（如交叉编译到安卓的设置）影响。
+	// motion、device等包依赖cgo，因此同时开启CGO_ENABLED
+	if cfg.Executor == ExecutorHost && cfg.Build.IsHost() {
+		cfg.Build.GOOS = runtime.GOOS
+		cfg.Build.GOARCH = runtime.GOARCH
+		cfg.Build.CGOEnabled = true
+	}
+	cfg.Timeouts.normalize()
 }
 
+// executor 创建配置的执行后端
+func (cfg *AgentConfig) executor() (Executor, error) {
+	if cfg.CustomExecutor != nil {
+		return cfg.CustomExecutor, nil
+	}
+	return NewExecutor(ExecutorConfig{
+		Backend:    cfg.Executor,
+		ADBPath:    cfg.ADBPath,
+		RemoteDir:  cfg.RemoteDir,
+		SSH:        cfg.SSH,
+		KeepBinary: cfg.KeepRemoteBinary,
+	})
+}
@@ -0,0 +1,328 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Device adb devices -l 列出的设备
+type Device struct {
+	Serial  string `json:"serial"`
+	State   string `json:"state"` // device、offline、unauthorized 等
+	Model   string `json:"model,omitempty"`
+	Product string `json:"product,omitempty"`
+	Name    string `json:"device,omitempty"`
+	ABI     string `json:"abi,omitempty"`
+}
+
+// Ready 设备是否可用
+func (d Device) Ready() bool {
+	return d.State == "device"
+}
+
+func (d Device) String() string {
+	parts := []string{d.Serial, d.State}
+	if d.Model != "" {
+		parts = append(parts, d.Model)
+	}
+	if d.ABI != "" {
+		parts = append(parts, d.ABI)
+	}
+	return strings.Join(parts, " ")
+}
+
+// ParseDevices 解析 adb devices -l 的输出
+func ParseDevices(output string) []Device {
+	var devices []Device
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "List of devices") || strings.HasPrefix(line, "*") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		d := Device{Serial: fields[0], State: fields[1]}
+		rest := fields[2:]
+		// "no permissions" 状态由两个词组成
+		if d.State == "no" && len(rest) > 0 && rest[0] == "permissions" {
+			d.State = "no permissions"
+			rest = rest[1:]
+		}
+		for _, field := range rest {
+			key, value, ok := strings.Cut(field, ":")
+			if !ok {
+				continue
+			}
+			switch key {
+			case "model":
+				d.Model = value
+			case "product":
+				d.Product = value
+			case "device":
+				d.Name = value
+			}
+		}
+		devices = append(devices, d)
+	}
+	return devices
+}
+
+// Devices 列出连接的设备，并读取可用设备的ABI
+func (e *AndroidExecutor) Devices(ctx context.Context) ([]Device, error) {
+	output, err := e.command(ctx, "devices", "-l").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("adb devices失败: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	devices := ParseDevices(string(output))
+	for i := range devices {
+		if !devices[i].Ready() {
+			continue
+		}
+		abi, err := e.withSerial(devices[i].Serial).command(ctx, "shell", "getprop", "ro.product.cpu.abi").Output()
+		if err == nil {
+			devices[i].ABI = strings.TrimSpace(string(abi))
+		}
+	}
+	return devices, nil
+}
+
+// DeviceFilter 设备筛选条件，零值字段表示不限制
+type DeviceFilter struct {
+	Serials []string `json:"serials,omitempty"` // 指定序列号
+	Model   string   `json:"model,omitempty"`   // 型号包含的关键字，不区分大小写
+	ABI     string   `json:"abi,omitempty"`     // 设备ABI，如 arm64-v8a
+}
+
+// ParseDeviceFilter 解析筛选表达式，如 "serial=abc,def;model=pixel;abi=arm64-v8a"，
+// 不含等号时视为逗号分隔的序列号列表
+func ParseDeviceFilter(value string) (DeviceFilter, error) {
+	var filter DeviceFilter
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return filter, nil
+	}
+	if !strings.Contains(value, "=") {
+		filter.Serials = splitList(value)
+		return filter, nil
+	}
+	for _, part := range strings.Split(value, ";") {
+		key, val, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return filter, fmt.Errorf("无效的设备筛选条件: %s", part)
+		}
+		switch strings.TrimSpace(key) {
+		case "serial":
+			filter.Serials = splitList(val)
+		case "model":
+			filter.Model = strings.TrimSpace(val)
+		case "abi":
+			filter.ABI = strings.TrimSpace(val)
+		default:
+			return filter, fmt.Errorf("未知的设备筛选字段: %s（可选 serial, model, abi）", key)
+		}
+	}
+	return filter, nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// String 返回可由ParseDeviceFilter解析的筛选表达式，零值为空
+func (f DeviceFilter) String() string {
+	var parts []string
+	if len(f.Serials) > 0 {
+		parts = append(parts, "serial="+strings.Join(f.Serials, ","))
+	}
+	if f.Model != "" {
+		parts = append(parts, "model="+f.Model)
+	}
+	if f.ABI != "" {
+		parts = append(parts, "abi="+f.ABI)
+	}
+	return strings.Join(parts, ";")
+}
+
+// Matches 设备是否满足筛选条件（不检查设备状态）
+func (f DeviceFilter) Matches(d Device) bool {
+	if len(f.Serials) > 0 {
+		found := false
+		for _, serial := range f.Serials {
+			if serial == d.Serial {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Model != "" && !strings.Contains(strings.ToLower(d.Model), strings.ToLower(f.Model)) {
+		return false
+	}
+	if f.ABI != "" && d.ABI != "" && d.ABI != f.ABI {
+		return false
+	}
+	return true
+}
+
+// DevicePool 设备池，将设备租借给各次执行，保证同一时刻一台设备只运行一个测试
+type DevicePool struct {
+	executor Executor
+
+	mu      sync.Mutex
+	devices []Device
+	leased  map[string]bool
+	// released 有设备归还时关闭并替换，用于唤醒等待中的Acquire
+	released chan struct{}
+}
+
+// NewDevicePool 创建设备池，devices为空时需调用Refresh发现设备
+func NewDevicePool(executor Executor, devices []Device) *DevicePool {
+	return &DevicePool{
+		executor: executor,
+		devices:  devices,
+		leased:   make(map[string]bool),
+		released: make(chan struct{}),
+	}
+}
+
+// Refresh 重新发现设备
+func (p *DevicePool) Refresh(ctx context.Context) error {
+	devices, err := p.executor.Devices(ctx)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.devices = devices
+	p.mu.Unlock()
+	return nil
+}
+
+// Devices 返回池中所有设备
+func (p *DevicePool) Devices() []Device {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Device(nil), p.devices...)
+}
+
+// matching 返回满足条件的可用设备，按序列号排序
+func (p *DevicePool) matching(filter DeviceFilter) []Device {
+	var result []Device
+	for _, d := range p.devices {
+		if d.Ready() && filter.Matches(d) {
+			result = append(result, d)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Serial < result[j].Serial })
+	return result
+}
+
+// DeviceLease 租借的设备，用完后必须调用Release
+type DeviceLease struct {
+	Device   Device
+	Executor Executor
+	pool     *DevicePool
+	once     sync.Once
+}
+
+// Release 归还设备
+func (l *DeviceLease) Release() {
+	l.once.Do(func() {
+		l.pool.mu.Lock()
+		delete(l.pool.leased, l.Device.Serial)
+		close(l.pool.released)
+		l.pool.released = make(chan struct{})
+		l.pool.mu.Unlock()
+	})
+}
+
+// Acquire 租借一台满足条件的空闲设备，全部被占用时等待归还，ctx取消时返回错误
+func (p *DevicePool) Acquire(ctx context.Context, filter DeviceFilter) (*DeviceLease, error) {
+	for {
+		p.mu.Lock()
+		candidates := p.matching(filter)
+		if len(candidates) == 0 {
+			p.mu.Unlock()
+			return nil, fmt.Errorf("没有满足条件的可用设备")
+		}
+		for _, d := range candidates {
+			if !p.leased[d.Serial] {
+				p.leased[d.Serial] = true
+				p.mu.Unlock()
+				return &DeviceLease{Device: d, Executor: p.executor.ForDevice(d.Serial), pool: p}, nil
+			}
+		}
+		released := p.released
+		p.mu.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// DeviceResult 单台设备上的执行结果
+type DeviceResult struct {
+	Device   Device        `json:"device"`
+	Success  bool          `json:"success"`
+	Output   string        `json:"output"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+	ExitCode *int          `json:"exit_code,omitempty"`
+	Steps    []StepResult  `json:"steps,omitempty"`
+	Evidence *Evidence     `json:"evidence,omitempty"`
+}
+
+// RunFunc 在租借到的设备上执行一次测试
+type RunFunc func(ctx context.Context, lease *DeviceLease) (string, error)
+
+// RunOnAll 在所有满足条件的设备上并行执行，结果按序列号排序
+func (p *DevicePool) RunOnAll(ctx context.Context, filter DeviceFilter, run RunFunc) ([]DeviceResult, error) {
+	p.mu.Lock()
+	targets := p.matching(filter)
+	p.mu.Unlock()
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("没有满足条件的可用设备")
+	}
+
+	results := make([]DeviceResult, len(targets))
+	var wg sync.WaitGroup
+	for i, d := range targets {
+		wg.Add(1)
+		go func(i int, d Device) {
+			defer wg.Done()
+			result := DeviceResult{Device: d}
+			start := time.Now()
+			// 按序列号租借，等待其他执行归还该设备
+			lease, err := p.Acquire(ctx, DeviceFilter{Serials: []string{d.Serial}})
+			if err == nil {
+				result.Output, err = run(ctx, lease)
+				lease.Release()
+				if code, ok := ExitCodeOf(err); ok {
+					result.ExitCode = &code
+				}
+			}
+			result.Duration = time.Since(start)
+			result.Success = err == nil
+			result.Error = errString(err)
+			results[i] = result
+		}(i, d)
+	}
+	wg.Wait()
+	return results, nil
+}
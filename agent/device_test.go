@@ -0,0 +1,182 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseDevices(t *testing.T) {
+	output := `* daemon not running; starting now at tcp:5037
+List of devices attached
+emulator-5554          device product:sdk_gphone64_x86_64 model:sdk_gphone64_x86_64 device:emu64xa transport_id:1
+R58M123ABC             unauthorized transport_id:2
+0123456789ABCDEF       no permissions (user in plugdev group); see [http://developer.android.com/tools/device.html]
+
+`
+	devices := ParseDevices(output)
+	if len(devices) != 3 {
+		t.Fatalf("got %d devices, want 3: %+v", len(devices), devices)
+	}
+	want := Device{Serial: "emulator-5554", State: "device", Model: "sdk_gphone64_x86_64", Product: "sdk_gphone64_x86_64", Name: "emu64xa"}
+	if devices[0] != want {
+		t.Errorf("devices[0] = %+v, want %+v", devices[0], want)
+	}
+	if devices[1].State != "unauthorized" || devices[1].Ready() {
+		t.Errorf("devices[1] = %+v, want unauthorized", devices[1])
+	}
+	if devices[2].State != "no permissions" {
+		t.Errorf("devices[2].State = %q, want %q", devices[2].State, "no permissions")
+	}
+}
+
+func TestParseDeviceFilter(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    DeviceFilter
+		wantErr bool
+	}{
+		{value: "", want: DeviceFilter{}},
+		{value: "abc, def", want: DeviceFilter{Serials: []string{"abc", "def"}}},
+		{value: "serial=abc;model=Pixel;abi=arm64-v8a", want: DeviceFilter{Serials: []string{"abc"}, Model: "Pixel", ABI: "arm64-v8a"}},
+		{value: "model=pixel", want: DeviceFilter{Model: "pixel"}},
+		{value: "color=red", wantErr: true},
+		{value: "model=pixel;abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDeviceFilter(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseDeviceFilter(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseDeviceFilter(%q) = %+v, want %+v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestDeviceFilterMatches(t *testing.T) {
+	pixel := Device{Serial: "a1", State: "device", Model: "Pixel_7", ABI: "arm64-v8a"}
+	tests := []struct {
+		filter DeviceFilter
+		want   bool
+	}{
+		{DeviceFilter{}, true},
+		{DeviceFilter{Serials: []string{"b2", "a1"}}, true},
+		{DeviceFilter{Serials: []string{"b2"}}, false},
+		{DeviceFilter{Model: "pixel"}, true},
+		{DeviceFilter{Model: "galaxy"}, false},
+		{DeviceFilter{ABI: "arm64-v8a"}, true},
+		{DeviceFilter{ABI: "x86_64"}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.Matches(pixel); got != tt.want {
+			t.Errorf("%+v.Matches = %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+	// ABI未知的设备不按ABI排除
+	if !(DeviceFilter{ABI: "x86_64"}).Matches(Device{Serial: "c3", State: "device"}) {
+		t.Error("device without ABI should match any ABI filter")
+	}
+}
+
+func testDevicePool() *DevicePool {
+	return NewDevicePool(NewFakeExecutor(nil), []Device{
+		{Serial: "b", State: "device", Model: "Pixel_7"},
+		{Serial: "a", State: "device", Model: "Pixel_6"},
+		{Serial: "c", State: "offline"},
+	})
+}
+
+func TestDevicePoolAcquire(t *testing.T) {
+	pool := testDevicePool()
+	ctx := context.Background()
+
+	first, err := pool.Acquire(ctx, DeviceFilter{})
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	if first.Device.Serial != "a" || first.Executor.(*FakeExecutor).Serial != "a" {
+		t.Fatalf("first lease = %s (executor %v), want a", first.Device.Serial, first.Executor)
+	}
+	second, err := pool.Acquire(ctx, DeviceFilter{})
+	if err != nil || second.Device.Serial != "b" {
+		t.Fatalf("second lease = %v, %v, want b", second, err)
+	}
+
+	if _, err := pool.Acquire(ctx, DeviceFilter{Serials: []string{"c"}}); err == nil {
+		t.Error("offline device should not be leased")
+	}
+
+	// 设备全部被占用时等待归还
+	acquired := make(chan *DeviceLease)
+	go func() {
+		lease, _ := pool.Acquire(ctx, DeviceFilter{})
+		acquired <- lease
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("Acquire should block while all devices are leased")
+	case <-time.After(50 * time.Millisecond):
+	}
+	second.Release()
+	second.Release() // 重复归还无影响
+	select {
+	case lease := <-acquired:
+		if lease.Device.Serial != "b" {
+			t.Errorf("waiting lease = %s, want b", lease.Device.Serial)
+		}
+		lease.Release()
+	case <-time.After(time.Second):
+		t.Fatal("Acquire was not woken by Release")
+	}
+
+	cancelled, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := pool.Acquire(cancelled, DeviceFilter{Serials: []string{"a"}}); err != context.DeadlineExceeded {
+		t.Errorf("Acquire with cancelled ctx = %v, want DeadlineExceeded", err)
+	}
+	first.Release()
+}
+
+func TestDevicePoolRunOnAll(t *testing.T) {
+	pool := testDevicePool()
+	var running, maxRunning int32
+	results, err := pool.RunOnAll(context.Background(), DeviceFilter{Model: "pixel"}, func(ctx context.Context, lease *DeviceLease) (string, error) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		if lease.Device.Serial == "b" {
+			return "", fmt.Errorf("exit status 1")
+		}
+		return "ok on " + lease.Executor.(*FakeExecutor).Serial, nil
+	})
+	if err != nil {
+		t.Fatalf("RunOnAll: %v", err)
+	}
+	if len(results) != 2 || results[0].Device.Serial != "a" || results[1].Device.Serial != "b" {
+		t.Fatalf("results = %+v, want a and b in order", results)
+	}
+	if !results[0].Success || results[0].Output != "ok on a" {
+		t.Errorf("results[0] = %+v", results[0])
+	}
+	if results[1].Success || results[1].Error != "exit status 1" {
+		t.Errorf("results[1] = %+v", results[1])
+	}
+	if maxRunning != 2 {
+		t.Errorf("max concurrent runs = %d, want 2", maxRunning)
+	}
+
+	if _, err := pool.RunOnAll(context.Background(), DeviceFilter{Model: "galaxy"}, nil); err == nil {
+		t.Error("RunOnAll without matching devices should fail")
+	}
+}
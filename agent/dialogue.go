@@ -2,39 +2,85 @@ package agent
 
 import (
 	"bufio"
+	"context"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
 	"strings"
 )
 
 // DialogueSystem 对话系统
 type DialogueSystem struct {
-	agent  *Agent
-	memory *ConversationMemory
+	agent   *Agent
+	memory  *ConversationMemory
+	store   *SessionStore
+	session *Session
+	out     io.Writer
 }
 
-// NewDialogueSystem 创建对话系统
+// NewDialogueSystem 创建对话系统，会话和命名脚本保存在Agent的工作目录中，
+// 对话记忆按会话ID保存在Agent的对话记忆库中
 func NewDialogueSystem(agent *Agent) *DialogueSystem {
-	return &DialogueSystem{
-		agent:  agent,
-		memory: NewConversationMemory(6),
+	ds := &DialogueSystem{
+		agent:   agent,
+		store:   NewSessionStore(agent.Options().WorkspaceDir),
+		session: &Session{ID: newSessionID()},
+		out:     os.Stdout,
 	}
+	ds.memory = ds.openMemory(ds.session.ID)
+	return ds
 }
 
-// Start 启动对话系统
+// openMemory 打开会话的对话记忆，记忆库不可用时只保存在内存中
+func (ds *DialogueSystem) openMemory(sessionID string) *ConversationMemory {
+	memory, err := ds.agent.NewMemory(sessionID)
+	if err != nil {
+		fmt.Fprintf(ds.out, "%v，本次会话的对话记忆只保存在内存中\n", err)
+		return NewConversationMemory(ds.agent.Options().MemoryBudget)
+	}
+	return memory
+}
+
+// dialogueCommand 以/开头的对话命令
+type dialogueCommand struct {
+	name  string
+	args  string
+	usage string
+	run   func(ds *DialogueSystem, args string) error
+}
+
+// dialogueCommands 按帮助中的顺序排列
+var dialogueCommands = []dialogueCommand{
+	{"/history", "", "显示本次会话的执行记录", (*DialogueSystem).cmdHistory},
+	{"/rerun", "[脚本名]", "不重新生成，直接重新执行上一次生成的脚本或保存的脚本", (*DialogueSystem).cmdRerun},
+	{"/save", "<脚本名>", "保存上一次生成的脚本", (*DialogueSystem).cmdSave},
+	{"/scripts", "", "列出保存的脚本", (*DialogueSystem).cmdScripts},
+	{"/kb", "<关键词>", "检索知识库中的API", (*DialogueSystem).cmdKB},
+	{"/device", "[筛选条件|any]", "查看或切换目标设备，如 /device model=pixel", (*DialogueSystem).cmdDevice},
+	{"/model", "[模型名]", "查看或切换LLM推理模型", (*DialogueSystem).cmdModel},
+	{"/auto", "[on|off]", "开关自动执行，不带参数时切换", (*DialogueSystem).cmdAuto},
+	{"/report", "", "打开上一次执行的报告", (*DialogueSystem).cmdReport},
+	{"/session", "save|load|list|new [名称]", "保存、恢复、列出会话或开始新会话", (*DialogueSystem).cmdSession},
+}
+
+// Start 启动对话系统，自动恢复上次退出时的会话
 func (ds *DialogueSystem) Start() {
 	scanner := bufio.NewScanner(os.Stdin)
 
-	fmt.Println("=" + strings.Repeat("=", 60))
-	fmt.Println("AutoGo 自动化测试对话系统")
-	fmt.Println("=" + strings.Repeat("=", 60))
-	fmt.Println("输入 'exit' 或 'quit' 退出")
-	fmt.Println("输入 'help' 查看帮助")
-	fmt.Println("=" + strings.Repeat("=", 60))
-	fmt.Println()
+	fmt.Fprintln(ds.out, "="+strings.Repeat("=", 60))
+	fmt.Fprintln(ds.out, "AutoGo 自动化测试对话系统")
+	fmt.Fprintln(ds.out, "="+strings.Repeat("=", 60))
+	fmt.Fprintln(ds.out, "输入 'exit' 或 'quit' 退出")
+	fmt.Fprintln(ds.out, "输入 'help' 查看帮助，/ 开头的命令见帮助")
+	fmt.Fprintln(ds.out, "="+strings.Repeat("=", 60))
+	ds.restoreAutosave()
+	fmt.Fprintln(ds.out)
 
 	for {
-		fmt.Print("有什么能帮您的吗？ ")
+		fmt.Fprint(ds.out, "有什么能帮您的吗？ ")
 		if !scanner.Scan() {
 			break
 		}
@@ -45,68 +91,478 @@ func (ds *DialogueSystem) Start() {
 		}
 
 		// 处理特殊命令
-		if query == "exit" || query == "quit" {
-			fmt.Println("再见！")
+		if ds.handleCommand(query) {
+			fmt.Fprintln(ds.out, "再见！")
 			break
 		}
+	}
+}
 
-		if query == "help" {
-			ds.showHelp()
-			continue
+// handleCommand 处理一行输入，返回是否退出
+func (ds *DialogueSystem) handleCommand(line string) bool {
+	name, args, _ := strings.Cut(line, " ")
+	args = strings.TrimSpace(args)
+	switch name {
+	case "exit", "quit", "/exit", "/quit":
+		return true
+	case "help", "/help":
+		ds.showHelp()
+		return false
+	}
+	if !strings.HasPrefix(line, "/") {
+		ds.handleQuery(line)
+		return false
+	}
+
+	for _, cmd := range dialogueCommands {
+		if cmd.name == name {
+			if err := cmd.run(ds, args); err != nil {
+				fmt.Fprintf(ds.out, "❌ %v\n", err)
+			}
+			return false
+		}
+	}
+	fmt.Fprintf(ds.out, "未知命令: %s，输入 help 查看可用命令\n", name)
+	return false
+}
+
+// handleQuery 生成并执行查询，记录到会话后自动保存
+func (ds *DialogueSystem) handleQuery(query string) {
+	// 处理用户查询
+	fmt.Fprintln(ds.out, "\n正在处理您的请求...（按 Ctrl+C 取消）")
+	result, err := ds.runQuery(func(ctx context.Context) (*TestResult, error) {
+		ds.remember(ctx, "user", query)
+		return ds.agent.Run(ctx, query, ds.memory.ContextString())
+	})
+	ds.finish(query, result, err)
+}
+
+// finish 显示结果，记录到会话和对话记忆并自动保存
+func (ds *DialogueSystem) finish(query string, result *TestResult, err error) {
+	if result != nil {
+		ds.session.AddResult(query, result)
+	}
+	if err != nil {
+		fmt.Fprintf(ds.out, "❌ 错误: %v\n\n", err)
+	} else {
+		// 显示结果
+		fmt.Fprintln(ds.out, ds.agent.FormatResult(result))
+		fmt.Fprintln(ds.out)
+	}
+	// 记忆中保存代码和失败原因，后续查询可以在此基础上修改。超出预算时的总结同样可用Ctrl+C取消
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	ds.remember(ctx, "assistant", ResultMemory(result, err))
+	stop()
+	ds.autosave()
+}
+
+// remember 将消息添加到对话记忆，写入记忆库失败时提示但不中断对话
+func (ds *DialogueSystem) remember(ctx context.Context, role, content string) {
+	if err := ds.memory.AddMessageContext(ctx, role, content); err != nil {
+		fmt.Fprintf(ds.out, "保存对话记忆失败: %v\n", err)
+	}
+}
+
+// runQuery 执行查询，LLM生成的代码实时输出到终端，Ctrl+C取消当前请求
+func (ds *DialogueSystem) runQuery(run func(ctx context.Context) (*TestResult, error)) (*TestResult, error) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	streaming := false
+	ctx = WithTokenFunc(ctx, func(token string) {
+		if !streaming {
+			streaming = true
+			fmt.Fprintln(ds.out, "--- LLM 生成中 ---")
+		}
+		fmt.Fprint(ds.out, token)
+	})
+
+	result, err := run(ctx)
+	if streaming {
+		fmt.Fprintln(ds.out, "\n--- 生成结束 ---")
+	}
+	return result, err
+}
+
+// cmdHistory 显示本次会话的执行记录
+func (ds *DialogueSystem) cmdHistory(string) error {
+	if len(ds.session.Turns) == 0 {
+		fmt.Fprintln(ds.out, "本次会话还没有执行记录")
+		return nil
+	}
+	for i, turn := range ds.session.Turns {
+		status := "✅"
+		if !turn.Success {
+			status = "❌"
+		}
+		fmt.Fprintf(ds.out, "%3d. %s %s  %s\n", i+1, status, turn.Timestamp.Format("15:04:05"), turn.Query)
+		if turn.Error != "" {
+			fmt.Fprintf(ds.out, "       错误: %s\n", firstLine(turn.Error))
+		}
+		if turn.ReportPath != "" {
+			fmt.Fprintf(ds.out, "       报告: %s\n", turn.ReportPath)
+		}
+	}
+	return nil
+}
+
+// cmdRerun 重新执行上一次生成的脚本，或按名称执行保存的脚本
+func (ds *DialogueSystem) cmdRerun(name string) error {
+	var query, code string
+	if name != "" {
+		var err error
+		if code, err = ds.store.LoadScript(name); err != nil {
+			return err
 		}
+		query = "/rerun " + name
+	} else {
+		last := ds.session.LastTurn()
+		if last == nil {
+			return fmt.Errorf("本次会话还没有生成过脚本")
+		}
+		query, code = last.Query, last.Code
+	}
 
-		ds.memory.AddMessage("user", query)
+	fmt.Fprintf(ds.out, "\n正在重新执行: %s（按 Ctrl+C 取消）\n", query)
+	result, err := ds.runQuery(func(ctx context.Context) (*TestResult, error) {
+		ds.remember(ctx, "user", "重新执行: "+query)
+		return ds.agent.RunScript(ctx, query, code)
+	})
+	ds.finish(query, result, err)
+	return nil
+}
 
-		// 处理用户查询
-		fmt.Println("\n正在处理您的请求...")
-		result, err := ds.agent.ProcessQueryWithContext(query, ds.memory.ContextString())
+// cmdSave 保存上一次生成的脚本
+func (ds *DialogueSystem) cmdSave(name string) error {
+	if name == "" {
+		return fmt.Errorf("用法: /save <脚本名>")
+	}
+	last := ds.session.LastTurn()
+	if last == nil {
+		return fmt.Errorf("本次会话还没有生成过脚本")
+	}
+	path, err := ds.store.SaveScript(name, last.Code)
+	if err != nil {
+		return fmt.Errorf("保存脚本失败: %w", err)
+	}
+	fmt.Fprintf(ds.out, "脚本已保存: %s（/rerun %s 重新执行）\n", path, name)
+	return nil
+}
+
+// cmdScripts 列出保存的脚本
+func (ds *DialogueSystem) cmdScripts(string) error {
+	names, err := ds.store.Scripts()
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		fmt.Fprintln(ds.out, "还没有保存的脚本，使用 /save <脚本名> 保存")
+		return nil
+	}
+	for _, name := range names {
+		fmt.Fprintln(ds.out, "  -", name)
+	}
+	return nil
+}
+
+// cmdKB 检索知识库
+func (ds *DialogueSystem) cmdKB(words string) error {
+	if words == "" {
+		return fmt.Errorf("用法: /kb <关键词>")
+	}
+	docs, err := ds.agent.GetAPIInfo(words)
+	if err != nil {
+		return fmt.Errorf("检索知识库失败: %w", err)
+	}
+	if len(docs) == 0 {
+		fmt.Fprintln(ds.out, "没有找到相关API")
+		return nil
+	}
+	for _, doc := range docs {
+		fmt.Fprintf(ds.out, "  %s.%s  %s\n", doc.Module, doc.Function, doc.Signature)
+		fmt.Fprintf(ds.out, "      %s\n", doc.Description)
+	}
+	return nil
+}
+
+// cmdDevice 查看或切换目标设备，any表示不限制
+func (ds *DialogueSystem) cmdDevice(expr string) error {
+	if expr == "" {
+		current := ds.agent.Options().Devices.String()
+		if current == "" {
+			current = "任意可用设备"
+		}
+		fmt.Fprintln(ds.out, "目标设备:", current)
+		return nil
+	}
+	var filter DeviceFilter
+	if expr != "any" {
+		var err error
+		if filter, err = ParseDeviceFilter(expr); err != nil {
+			return err
+		}
+	}
+	ds.agent.SetDevices(filter)
+	ds.autosave()
+	fmt.Fprintln(ds.out, "已切换目标设备:", expr)
+	return nil
+}
+
+// cmdModel 查看或切换推理模型
+func (ds *DialogueSystem) cmdModel(model string) error {
+	if model == "" {
+		current := ds.agent.ModelName()
+		if current == "" {
+			current = "未启用LLM"
+		}
+		fmt.Fprintln(ds.out, "当前模型:", current)
+		return nil
+	}
+	if err := ds.agent.SetModel(model); err != nil {
+		return err
+	}
+	ds.autosave()
+	fmt.Fprintln(ds.out, "已切换模型:", model)
+	return nil
+}
+
+// cmdAuto 开关自动执行
+func (ds *DialogueSystem) cmdAuto(value string) error {
+	enabled := !ds.agent.Options().AutoExecute
+	switch value {
+	case "":
+	case "on":
+		enabled = true
+	case "off":
+		enabled = false
+	default:
+		return fmt.Errorf("用法: /auto [on|off]")
+	}
+	if err := ds.agent.SetAutoExecute(enabled); err != nil {
+		return err
+	}
+	ds.autosave()
+	if enabled {
+		fmt.Fprintln(ds.out, "自动执行: 开")
+	} else {
+		fmt.Fprintln(ds.out, "自动执行: 关")
+	}
+	return nil
+}
+
+// cmdReport 打开上一次执行的报告：有HTML报告时用系统浏览器打开，否则在终端显示
+func (ds *DialogueSystem) cmdReport(string) error {
+	path := ds.session.LastReport()
+	if path == "" {
+		return fmt.Errorf("本次会话还没有生成过报告")
+	}
+	html := strings.TrimSuffix(path, ".json") + formatExt[FormatHTML]
+	if _, err := os.Stat(html); err == nil {
+		if err := openFile(html); err == nil {
+			fmt.Fprintln(ds.out, "已打开报告:", html)
+			return nil
+		}
+	}
+	report, err := LoadReport(path)
+	if err != nil {
+		return fmt.Errorf("读取报告失败: %w", err)
+	}
+	fmt.Fprintln(ds.out, report.Markdown())
+	fmt.Fprintln(ds.out, "报告路径:", path)
+	return nil
+}
+
+// openFile 用系统默认程序打开文件
+func openFile(path string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", path)
+	case "windows":
+		cmd = exec.Command("cmd", "/c", "start", "", path)
+	default:
+		cmd = exec.Command("xdg-open", path)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
+
+// cmdSession 保存、恢复、列出会话或开始新会话
+func (ds *DialogueSystem) cmdSession(args string) error {
+	action, name, _ := strings.Cut(args, " ")
+	name = strings.TrimSpace(name)
+	switch action {
+	case "save":
+		if name == "" {
+			return fmt.Errorf("用法: /session save <名称>")
+		}
+		// 命名会话使用对话记忆的副本，之后的对话不影响保存的内容
+		saved := *ds.snapshot()
+		saved.ID = newSessionID()
+		saved.Turns = append([]SessionTurn(nil), saved.Turns...)
+		if err := ds.agent.memory.Copy(ds.session.ID, saved.ID); err != nil {
+			return fmt.Errorf("保存对话记忆失败: %w", err)
+		}
+		old, _ := ds.store.Load(name)
+		path, err := ds.store.Save(name, &saved)
 		if err != nil {
-			fmt.Printf("❌ 错误: %v\n\n", err)
-			continue
+			if err := ds.agent.memory.Delete(saved.ID); err != nil {
+				fmt.Fprintf(ds.out, "删除对话记忆副本失败: %v\n", err)
+			}
+			return fmt.Errorf("保存会话失败: %w", err)
+		}
+		fmt.Fprintln(ds.out, "会话已保存:", path)
+		// 被覆盖的同名会话的记忆不再被引用，删除失败时由PruneMemory在过期后清理
+		if old != nil && old.ID != "" {
+			if err := ds.agent.memory.Delete(old.ID); err != nil {
+				fmt.Fprintf(ds.out, "删除旧会话的对话记忆失败: %v\n", err)
+			}
+		}
+	case "load":
+		if name == "" {
+			return fmt.Errorf("用法: /session load <名称>")
+		}
+		session, err := ds.store.Load(name)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("没有名为 %s 的会话", name)
+			}
+			return err
 		}
+		// 在副本上继续，保存的会话保持不变
+		id := newSessionID()
+		if err := ds.agent.memory.Copy(session.ID, id); err != nil {
+			return fmt.Errorf("恢复对话记忆失败: %w", err)
+		}
+		session.ID = id
+		ds.restore(session, true)
+		ds.autosave()
+		fmt.Fprintf(ds.out, "已恢复会话 %s（%d 次执行）\n", name, len(session.Turns))
+	case "list":
+		names, err := ds.store.Sessions()
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			fmt.Fprintln(ds.out, "  -", name)
+		}
+	case "new":
+		if err := ds.memory.Clear(); err != nil {
+			return err
+		}
+		ds.session = &Session{ID: newSessionID()}
+		ds.memory = ds.openMemory(ds.session.ID)
+		if err := ds.store.Delete(AutosaveSession); err != nil {
+			return err
+		}
+		fmt.Fprintln(ds.out, "已开始新会话")
+	default:
+		return fmt.Errorf("用法: /session save|load|list|new [名称]")
+	}
+	return nil
+}
 
-		// 显示结果
-		fmt.Println(ds.agent.FormatResult(result))
-		ds.memory.AddMessage("assistant", fmt.Sprintf("状态: %v, 报告: %s", result.Success, result.ReportPath))
-		fmt.Println()
+// snapshot 返回包含当前设置的会话
+func (ds *DialogueSystem) snapshot() *Session {
+	options := ds.agent.Options()
+	ds.session.Devices = options.Devices
+	ds.session.Model = ds.agent.ModelName()
+	ds.session.AutoExecute = options.AutoExecute
+	return ds.session
+}
+
+// restore 恢复会话的执行记录和对话记忆，applySettings时同时恢复设备、模型和自动执行设置
+func (ds *DialogueSystem) restore(session *Session, applySettings bool) {
+	ds.session = session
+	ds.memory = ds.openMemory(session.ID)
+	if !applySettings {
+		return
+	}
+	ds.agent.SetDevices(session.Devices)
+	if session.Model != "" && session.Model != ds.agent.ModelName() {
+		if err := ds.agent.SetModel(session.Model); err != nil {
+			fmt.Fprintf(ds.out, "恢复模型 %s 失败: %v\n", session.Model, err)
+		}
+	}
+	if session.AutoExecute != ds.agent.Options().AutoExecute {
+		if err := ds.agent.SetAutoExecute(session.AutoExecute); err != nil {
+			fmt.Fprintf(ds.out, "恢复自动执行设置失败: %v\n", err)
+		}
+	}
+}
+
+// restoreAutosave 恢复上次退出时自动保存的会话。设置以本次启动的命令行参数为准
+func (ds *DialogueSystem) restoreAutosave() {
+	session, err := ds.store.Load(AutosaveSession)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Fprintf(ds.out, "恢复上次会话失败: %v\n", err)
+		}
+		return
+	}
+	if session.ID == "" || len(session.Turns) == 0 {
+		return
+	}
+	ds.restore(session, false)
+	fmt.Fprintf(ds.out, "已恢复上次会话（%d 次执行），/session new 开始新会话\n", len(session.Turns))
+}
+
+// autosave 自动保存当前会话
+func (ds *DialogueSystem) autosave() {
+	if _, err := ds.store.Save(AutosaveSession, ds.snapshot()); err != nil {
+		fmt.Fprintf(ds.out, "自动保存会话失败: %v\n", err)
 	}
 }
 
 // showHelp 显示帮助信息
 func (ds *DialogueSystem) showHelp() {
+	var commands strings.Builder
+	for _, cmd := range dialogueCommands {
+		usage := cmd.name
+		if cmd.args != "" {
+			usage += " " + cmd.args
+		}
+		commands.WriteString(fmt.Sprintf("  - %s: %s\n", usage, cmd.usage))
+	}
+
 	help := `
 可用命令:
-  - exit/quit: 退出系统
+  - exit/quit: 退出系统（会话自动保存，下次启动时恢复）
   - help: 显示此帮助信息
-
+` + commands.String() + `
 示例查询:
   - "点击登录按钮"
   - "在坐标(100, 200)点击"
   - "输入文本'Hello World'"
   - "验证页面是否存在'主页'文字"
-  - "验证是否存在图片'logo.png'"
   - "启动应用com.example.app"
   - "等待5秒"
   - "滑动从(100,200)到(300,400)"
+  - "启动应用com.example.app，点击登录按钮，然后验证页面是否存在'主页'文字"（多步骤）
 
 支持的模块:
   - motion: 触摸操作（点击、滑动等）
   - uiacc: UI控件识别和操作
-  - opencv: 图像模板匹配
   - ppocr: OCR文字识别
   - app: 应用管理
   - ime: 输入法操作
 `
-	fmt.Println(help)
+	fmt.Fprintln(ds.out, help)
 }
 
 // ProcessSingleQuery 处理单个查询（用于API调用）
 func (ds *DialogueSystem) ProcessSingleQuery(query string) (*TestResult, error) {
-	ds.memory.AddMessage("user", query)
+	if err := ds.memory.AddMessage("user", query); err != nil {
+		return nil, fmt.Errorf("保存对话记忆失败: %w", err)
+	}
 	result, err := ds.agent.ProcessQueryWithContext(query, ds.memory.ContextString())
 	if err == nil {
-		ds.memory.AddMessage("assistant", fmt.Sprintf("状态: %v", result.Success))
+		if err := ds.memory.AddMessage("assistant", ResultMemory(result, nil)); err != nil {
+			return result, fmt.Errorf("保存对话记忆失败: %w", err)
+		}
 	}
 	return result, err
 }
-
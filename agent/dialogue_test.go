@@ -0,0 +1,165 @@
+package agent
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func newTestDialogue(t *testing.T, fake *FakeExecutor) (*DialogueSystem, *bytes.Buffer) {
+	t.Helper()
+	ds := NewDialogueSystem(newPipelineAgent(t, fake, nil))
+	var out bytes.Buffer
+	ds.out = &out
+	return ds, &out
+}
+
+// command 执行一条命令并返回其输出
+func command(t *testing.T, ds *DialogueSystem, out *bytes.Buffer, line string) string {
+	t.Helper()
+	out.Reset()
+	if ds.handleCommand(line) {
+		t.Fatalf("%q should not quit", line)
+	}
+	return out.String()
+}
+
+func TestDialogueRerunAndScripts(t *testing.T) {
+	fake := NewFakeExecutor(nil, FakeRun{Output: "登录成功\n"})
+	ds, out := newTestDialogue(t, fake)
+
+	if got := command(t, ds, out, "/rerun"); !strings.Contains(got, "还没有生成过脚本") {
+		t.Errorf("rerun without a script: %q", got)
+	}
+	command(t, ds, out, "点击登录按钮")
+	if len(ds.session.Turns) != 1 || ds.session.Turns[0].Code == "" || !ds.session.Turns[0].Success {
+		t.Fatalf("turns = %+v", ds.session.Turns)
+	}
+
+	if got := command(t, ds, out, "/save login"); !strings.Contains(got, "脚本已保存") {
+		t.Errorf("save: %q", got)
+	}
+	if got := command(t, ds, out, "/save ../evil"); !strings.Contains(got, "无效的名称") {
+		t.Errorf("save with a path: %q", got)
+	}
+	if got := command(t, ds, out, "/scripts"); !strings.Contains(got, "- login") {
+		t.Errorf("scripts: %q", got)
+	}
+
+	command(t, ds, out, "/rerun")
+	command(t, ds, out, "/rerun login")
+	if len(ds.session.Turns) != 3 {
+		t.Fatalf("got %d turns, want 3", len(ds.session.Turns))
+	}
+	for _, turn := range ds.session.Turns[1:] {
+		if turn.Code != ds.session.Turns[0].Code || !turn.Success {
+			t.Errorf("rerun turn = %+v", turn)
+		}
+	}
+	if ds.session.Turns[2].Query != "/rerun login" {
+		t.Errorf("rerun query = %q", ds.session.Turns[2].Query)
+	}
+	if runs := strings.Count(fakeMethods(fake.Calls()), "run"); runs != 3 {
+		t.Errorf("executed %d times, want 3", runs)
+	}
+
+	history := command(t, ds, out, "/history")
+	if strings.Count(history, "✅") != 3 || !strings.Contains(history, "点击登录按钮") {
+		t.Errorf("history:\n%s", history)
+	}
+	// 只有JSON报告时在终端显示，不会调用浏览器
+	if got := command(t, ds, out, "/report"); !strings.Contains(got, "报告路径") {
+		t.Errorf("report: %q", got)
+	}
+}
+
+func TestDialogueSettings(t *testing.T) {
+	ds, out := newTestDialogue(t, NewFakeExecutor(nil))
+
+	command(t, ds, out, "/device model=pixel;abi=arm64-v8a")
+	if got := ds.agent.Options().Devices; got.Model != "pixel" || got.ABI != "arm64-v8a" {
+		t.Errorf("devices = %+v", got)
+	}
+	if got := command(t, ds, out, "/device"); !strings.Contains(got, "model=pixel;abi=arm64-v8a") {
+		t.Errorf("device: %q", got)
+	}
+	command(t, ds, out, "/device any")
+	if got := ds.agent.Options().Devices.String(); got != "" {
+		t.Errorf("devices after any = %q", got)
+	}
+
+	if got := command(t, ds, out, "/model"); !strings.Contains(got, "fake") {
+		t.Errorf("model: %q", got)
+	}
+	if got := command(t, ds, out, "/model other"); !strings.Contains(got, "不支持切换模型") {
+		t.Errorf("model switch on a fixed backend: %q", got)
+	}
+
+	command(t, ds, out, "/auto")
+	if ds.agent.Options().AutoExecute {
+		t.Error("/auto should toggle auto-exec off")
+	}
+	command(t, ds, out, "/auto on")
+	if !ds.agent.Options().AutoExecute {
+		t.Error("/auto on should enable auto-exec")
+	}
+	if got := command(t, ds, out, "/auto maybe"); !strings.Contains(got, "用法") {
+		t.Errorf("auto usage: %q", got)
+	}
+
+	if got := command(t, ds, out, "/kb click"); !strings.Contains(got, "motion.") {
+		t.Errorf("kb: %q", got)
+	}
+	if got := command(t, ds, out, "/nope"); !strings.Contains(got, "未知命令") {
+		t.Errorf("unknown command: %q", got)
+	}
+	if !ds.handleCommand("exit") || !ds.handleCommand("/quit") {
+		t.Error("exit and /quit should quit")
+	}
+}
+
+func TestDialogueSessions(t *testing.T) {
+	ds, out := newTestDialogue(t, NewFakeExecutor(nil, FakeRun{Output: "ok\n"}))
+	command(t, ds, out, "点击登录按钮")
+	command(t, ds, out, "/device model=pixel")
+	command(t, ds, out, "/session save demo")
+
+	// 重启后自动恢复执行记录和对话记忆，设置以命令行为准
+	ds.agent.SetDevices(DeviceFilter{})
+	restarted := NewDialogueSystem(ds.agent)
+	restarted.out = out
+	out.Reset()
+	restarted.restoreAutosave()
+	if !strings.Contains(out.String(), "已恢复上次会话（1 次执行）") {
+		t.Errorf("autosave restore: %q", out.String())
+	}
+	if restarted.session.LastTurn() == nil || len(restarted.memory.Messages()) != 2 {
+		t.Errorf("restored session = %+v, memory %v", restarted.session, restarted.memory.Messages())
+	}
+	// 后续查询的上下文中包含之前生成的代码
+	if context := restarted.memory.ContextString(); !strings.Contains(context, "```go\npackage main") {
+		t.Errorf("restored memory lacks the generated code:\n%s", context)
+	}
+	if ds.agent.Options().Devices.Model != "" {
+		t.Error("autosave restore should keep the command-line device filter")
+	}
+
+	command(t, restarted, out, "/session new")
+	if len(restarted.session.Turns) != 0 || restarted.memory.ContextString() != "" {
+		t.Errorf("new session = %+v", restarted.session)
+	}
+	if got := command(t, restarted, out, "/session list"); !strings.Contains(got, "- demo") {
+		t.Errorf("session list: %q", got)
+	}
+
+	// 显式恢复时同时恢复设置
+	if got := command(t, restarted, out, "/session load demo"); !strings.Contains(got, "已恢复会话 demo（1 次执行）") {
+		t.Errorf("session load: %q", got)
+	}
+	if ds.agent.Options().Devices.Model != "pixel" {
+		t.Errorf("devices after load = %+v", ds.agent.Options().Devices)
+	}
+	if got := command(t, restarted, out, "/session load missing"); !strings.Contains(got, "没有名为 missing 的会话") {
+		t.Errorf("missing session: %q", got)
+	}
+}
@@ -0,0 +1,185 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// EvidenceMode 截图和界面控件树的采集时机，除never外logcat总是采集
+type EvidenceMode string
+
+const (
+	EvidenceOnFailure EvidenceMode = "failure" // 仅在执行失败时截图
+	EvidenceAlways    EvidenceMode = "always"  // 每次执行结束都截图
+	EvidenceNever     EvidenceMode = "never"   // 不采集任何证据
+)
+
+// ParseEvidenceMode 解析证据采集模式，空字符串返回默认的failure
+func ParseEvidenceMode(value string) (EvidenceMode, error) {
+	switch mode := EvidenceMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case "":
+		return EvidenceOnFailure, nil
+	case EvidenceOnFailure, EvidenceAlways, EvidenceNever:
+		return mode, nil
+	}
+	return "", fmt.Errorf("未知的证据采集模式: %s（可选 failure, always, never）", value)
+}
+
+// 证据采集的限制
+const (
+	// evidenceTimeout 采集全部证据的超时时间，执行超时或被取消后仍会采集
+	evidenceTimeout = 30 * time.Second
+	// maxLogcatLines 报告中保留的logcat最大行数（取最后的部分）
+	maxLogcatLines = 2000
+)
+
+// Evidence 一次设备端执行留下的现场证据
+type Evidence struct {
+	Logcat     string   `json:"logcat,omitempty"`
+	Screenshot string   `json:"screenshot,omitempty"`
+	UIDump     string   `json:"ui_dump,omitempty"`
+	Errors     []string `json:"errors,omitempty"` // 采集失败的原因
+}
+
+// StartLogcat 清空设备日志缓冲区，返回设备当前时间作为本次执行日志窗口的起点。
+// 读取设备时间失败时返回空字符串，之后读取整个缓冲区。
+func (e *AndroidExecutor) StartLogcat(ctx context.Context) (string, error) {
+	if output, err := e.command(ctx, "logcat", "-c").CombinedOutput(); err != nil {
+		return "", fmt.Errorf("清空logcat失败: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	// adb shell会把参数拼接后交给设备端shell再次拆分，带空格的格式串需要整体加引号
+	output, err := e.command(ctx, "shell", "date '+%m-%d %H:%M:%S.000'").Output()
+	if err != nil {
+		return "", nil
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// Logcat 读取since之后的设备日志，since为空时读取整个缓冲区
+func (e *AndroidExecutor) Logcat(ctx context.Context, since string) (string, error) {
+	args := []string{"logcat", "-d", "-v", "threadtime"}
+	if since != "" {
+		args = append(args, "-T", since)
+	}
+	output, err := e.command(ctx, args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("读取logcat失败: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return tailLines(string(output), maxLogcatLines), nil
+}
+
+// Screencap 截取设备屏幕并保存为本地PNG
+func (e *AndroidExecutor) Screencap(ctx context.Context, localPath string) error {
+	cmd := e.command(ctx, "exec-out", "screencap", "-p")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	data, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("截图失败: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if len(data) == 0 {
+		return fmt.Errorf("截图失败: 设备未返回数据")
+	}
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(localPath, data, 0644)
+}
+
+// DumpUI 导出设备当前界面的控件树并拉取到本地
+func (e *AndroidExecutor) DumpUI(ctx context.Context, localPath string) error {
+	remote := filepath.ToSlash(filepath.Join(e.RemoteDir, "window_dump.xml"))
+	if output, err := e.command(ctx, "shell", "uiautomator", "dump", remote).CombinedOutput(); err != nil {
+		return fmt.Errorf("uiautomator dump失败: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	defer e.command(ctx, "shell", "rm", "-f", remote).Run()
+
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return err
+	}
+	if output, err := e.command(ctx, "pull", remote, localPath).CombinedOutput(); err != nil {
+		return fmt.Errorf("拉取界面控件树失败: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// CollectEvidence 采集since之后的logcat，capture为true时再截图并导出控件树到dir。
+// 执行超时或被取消后也要采集，因此使用独立于ctx取消的超时。
+func (e *AndroidExecutor) CollectEvidence(ctx context.Context, dir, since string, capture bool) *Evidence {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), evidenceTimeout)
+	defer cancel()
+
+	evidence := &Evidence{}
+	logcat, err := e.Logcat(ctx, since)
+	if err != nil {
+		evidence.Errors = append(evidence.Errors, err.Error())
+	}
+	evidence.Logcat = logcat
+	if !capture {
+		return evidence
+	}
+
+	name := "device"
+	if e.Serial != "" {
+		name = sanitizeFileName(e.Serial)
+	}
+	screenshot := filepath.Join(dir, name+".png")
+	if err := e.Screencap(ctx, screenshot); err != nil {
+		evidence.Errors = append(evidence.Errors, err.Error())
+	} else {
+		evidence.Screenshot = screenshot
+	}
+	uiDump := filepath.Join(dir, name+"-window.xml")
+	if err := e.DumpUI(ctx, uiDump); err != nil {
+		evidence.Errors = append(evidence.Errors, err.Error())
+	} else {
+		evidence.UIDump = uiDump
+	}
+	return evidence
+}
+
+// tailLines 保留文本的最后n行
+func tailLines(text string, n int) string {
+	lines := strings.SplitAfter(text, "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) <= n {
+		return text
+	}
+	return fmt.Sprintf("... 省略前 %d 行 ...\n", len(lines)-n) + strings.Join(lines[len(lines)-n:], "")
+}
+
+// sanitizeFileName 将设备序列号（如 192.168.1.2:5555）转换为可用的文件名
+func sanitizeFileName(name string) string {
+	return strings.NewReplacer(":", "_", "/", "_", "\\", "_").Replace(name)
+}
+
+// collectedEvidence 汇总各设备的证据，返回logcat、截图和控件树路径；多台设备时logcat按设备分段
+func collectedEvidence(results []DeviceResult) (string, []string, []string) {
+	var logcat strings.Builder
+	var screenshots, uiDumps []string
+	for _, r := range results {
+		if r.Evidence == nil {
+			continue
+		}
+		if r.Evidence.Logcat != "" {
+			if len(results) > 1 {
+				logcat.WriteString(fmt.Sprintf("=== %s ===\n", r.Device.Serial))
+			}
+			logcat.WriteString(r.Evidence.Logcat)
+		}
+		if r.Evidence.Screenshot != "" {
+			screenshots = append(screenshots, r.Evidence.Screenshot)
+		}
+		if r.Evidence.UIDump != "" {
+			uiDumps = append(uiDumps, r.Evidence.UIDump)
+		}
+	}
+	return logcat.String(), screenshots, uiDumps
+}
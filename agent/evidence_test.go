@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakeADB 写入一个记录调用参数并模拟logcat、screencap和uiautomator的adb脚本
+func fakeADB(t *testing.T) (string, string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake adb script requires a POSIX shell")
+	}
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls.log")
+	script := `#!/bin/sh
+echo "$@" >> "` + calls + `"
+[ "$1" = "-s" ] && shift 2
+case "$1" in
+logcat)
+	[ "$2" = "-d" ] && printf '01-02 10:00:00.000  100  100 E TestApp: boom\n'
+	;;
+exec-out)
+	printf 'PNGDATA'
+	;;
+pull)
+	echo '<hierarchy/>' > "$3"
+	;;
+shell)
+	case "$2" in
+	date*) echo '01-02 10:00:00.000' ;;
+	esac
+	;;
+esac
+exit 0
+`
+	path := filepath.Join(dir, "adb")
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path, calls
+}
+
+func TestCollectEvidence(t *testing.T) {
+	adb, calls := fakeADB(t)
+	executor := NewAndroidExecutor(adb, "/data/local/tmp").withSerial("192.168.1.2:5555")
+	ctx := context.Background()
+
+	since, err := executor.StartLogcat(ctx)
+	if err != nil || since != "01-02 10:00:00.000" {
+		t.Fatalf("StartLogcat = %q, %v", since, err)
+	}
+
+	dir := t.TempDir()
+	evidence := executor.CollectEvidence(ctx, dir, since, true)
+	if len(evidence.Errors) > 0 {
+		t.Fatalf("CollectEvidence errors: %v", evidence.Errors)
+	}
+	if !strings.Contains(evidence.Logcat, "TestApp: boom") {
+		t.Errorf("Logcat = %q", evidence.Logcat)
+	}
+	if evidence.Screenshot != filepath.Join(dir, "192.168.1.2_5555.png") {
+		t.Errorf("Screenshot = %q", evidence.Screenshot)
+	}
+	if data, _ := os.ReadFile(evidence.Screenshot); string(data) != "PNGDATA" {
+		t.Errorf("screenshot content = %q", data)
+	}
+	if data, _ := os.ReadFile(evidence.UIDump); !strings.Contains(string(data), "<hierarchy/>") {
+		t.Errorf("ui dump content = %q", data)
+	}
+
+	log, _ := os.ReadFile(calls)
+	for _, want := range []string{
+		"-s 192.168.1.2:5555 logcat -c",
+		"-s 192.168.1.2:5555 logcat -d -v threadtime -T 01-02 10:00:00.000",
+		"-s 192.168.1.2:5555 shell uiautomator dump /data/local/tmp/window_dump.xml",
+		"-s 192.168.1.2:5555 shell rm -f /data/local/tmp/window_dump.xml",
+	} {
+		if !strings.Contains(string(log), want) {
+			t.Errorf("adb calls missing %q:\n%s", want, log)
+		}
+	}
+
+	onlyLog := executor.CollectEvidence(ctx, dir, since, false)
+	if onlyLog.Logcat == "" || onlyLog.Screenshot != "" || onlyLog.UIDump != "" {
+		t.Errorf("capture=false evidence = %+v, want logcat only", onlyLog)
+	}
+}
+
+func TestCollectEvidenceAfterCancel(t *testing.T) {
+	adb, _ := fakeADB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	evidence := NewAndroidExecutor(adb, "").CollectEvidence(ctx, t.TempDir(), "", true)
+	if len(evidence.Errors) > 0 || evidence.Screenshot == "" {
+		t.Errorf("evidence after cancel = %+v, want collected", evidence)
+	}
+}
+
+func TestTailLines(t *testing.T) {
+	if got := tailLines("a\nb\n", 5); got != "a\nb\n" {
+		t.Errorf("tailLines short = %q", got)
+	}
+	if got := tailLines("a\nb\nc\nd\n", 2); got != "... 省略前 2 行 ...\nc\nd\n" {
+		t.Errorf("tailLines = %q", got)
+	}
+}
+
+func TestParseEvidenceMode(t *testing.T) {
+	for value, want := range map[string]EvidenceMode{"": EvidenceOnFailure, "Always": EvidenceAlways, "never": EvidenceNever} {
+		if got, err := ParseEvidenceMode(value); err != nil || got != want {
+			t.Errorf("ParseEvidenceMode(%q) = %q, %v, want %q", value, got, err, want)
+		}
+	}
+	if _, err := ParseEvidenceMode("sometimes"); err == nil {
+		t.Error("ParseEvidenceMode should reject unknown modes")
+	}
+}
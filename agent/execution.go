@@ -0,0 +1,236 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Executor 测试二进制的执行后端，每个后端管理一组执行目标（设备）
+type Executor interface {
+	// Devices 列出执行目标，本机和SSH后端只有一个目标
+	Devices(ctx context.Context) ([]Device, error)
+	// ForDevice 返回绑定到指定目标的执行器
+	ForDevice(serial string) Executor
+	// Push 将本地二进制部署到目标，返回目标上的路径和命令输出
+	Push(ctx context.Context, localBinary string) (string, string, error)
+	// Run 运行已部署的二进制，非零退出码返回*RemoteExitError，ctx取消时结束目标上的进程
+	Run(ctx context.Context, remoteBinary string) (string, error)
+	// Cleanup 结束残留进程并删除部署的二进制，执行被取消后也应能调用
+	Cleanup(ctx context.Context, remoteBinary string) error
+}
+
+// EvidenceCollector 能在执行前后采集现场证据的执行器
+type EvidenceCollector interface {
+	// StartLogcat 清空日志并返回日志窗口的起点
+	StartLogcat(ctx context.Context) (string, error)
+	// CollectEvidence 采集since之后的日志，capture为true时截图并导出界面到dir
+	CollectEvidence(ctx context.Context, dir, since string, capture bool) *Evidence
+}
+
+// 执行后端名称
+const (
+	ExecutorADB  = "adb"  // adb连接的安卓设备（默认）
+	ExecutorHost = "host" // 本机进程
+	ExecutorSSH  = "ssh"  // SSH可达的设备或主机
+)
+
+// ExecutorConfig 执行后端配置
+type ExecutorConfig struct {
+	Backend    string // adb, host, ssh
+	ADBPath    string
+	RemoteDir  string // 设备端或SSH主机上存放二进制的目录
+	SSH        SSHConfig
+	KeepBinary bool // 执行结束后保留部署的二进制
+}
+
+// NewExecutor 根据配置创建执行后端
+func NewExecutor(cfg ExecutorConfig) (Executor, error) {
+	switch cfg.Backend {
+	case "", ExecutorADB:
+		executor := NewAndroidExecutor(cfg.ADBPath, cfg.RemoteDir)
+		executor.KeepBinary = cfg.KeepBinary
+		return executor, nil
+	case ExecutorHost:
+		return NewHostExecutor(), nil
+	case ExecutorSSH:
+		if cfg.SSH.Target == "" {
+			return nil, fmt.Errorf("ssh执行后端需要指定目标主机")
+		}
+		executor := NewSSHExecutor(cfg.SSH, cfg.RemoteDir)
+		executor.KeepBinary = cfg.KeepBinary
+		return executor, nil
+	}
+	return nil, fmt.Errorf("未知的执行后端: %s（可选 adb, host, ssh）", cfg.Backend)
+}
+
+// 编译期检查各后端实现了接口
+var (
+	_ Executor          = (*AndroidExecutor)(nil)
+	_ EvidenceCollector = (*AndroidExecutor)(nil)
+	_ Executor          = (*HostExecutor)(nil)
+	_ Executor          = (*SSHExecutor)(nil)
+	_ Executor          = (*FakeExecutor)(nil)
+	_ EvidenceCollector = (*FakeExecutor)(nil)
+)
+
+// ExitCodeRestart system.RestartSelf 请求重启脚本时使用的退出码
+const ExitCodeRestart = 123
+
+// exitMarker 追加在输出末尾的退出码标记。旧版本设备的adb shell总是返回0，
+// 只能由目标上的shell回显 $? 取得真实退出码
+const exitMarker = "__GENIE_EXIT_CODE="
+
+// cleanupTimeout 超时或取消后结束目标上的进程、删除二进制的超时时间
+const cleanupTimeout = 10 * time.Second
+
+// RemoteExitError 设备端进程以非零退出码结束
+type RemoteExitError struct {
+	Code int
+}
+
+func (e *RemoteExitError) Error() string {
+	return fmt.Sprintf("设备端进程退出码 %d（%s）", e.Code, DescribeExitCode(e.Code))
+}
+
+// DescribeExitCode 返回退出码的含义
+func DescribeExitCode(code int) string {
+	switch {
+	case code == 0:
+		return "成功"
+	case code == ExitCodeRestart:
+		return "脚本请求重启（system.RestartSelf）"
+	case code == 126:
+		return "没有执行权限"
+	case code == 127:
+		return "找不到可执行文件"
+	case code > 128 && code < 160:
+		signal := code - 128
+		names := map[int]string{6: "SIGABRT", 9: "SIGKILL", 11: "SIGSEGV", 13: "SIGPIPE", 15: "SIGTERM"}
+		if name, ok := names[signal]; ok {
+			return fmt.Sprintf("被信号 %d (%s) 终止", signal, name)
+		}
+		return fmt.Sprintf("被信号 %d 终止", signal)
+	}
+	return "执行失败"
+}
+
+// ExitCodeOf 从执行错误中取出退出码：nil表示成功返回0，无法确定时（如超时被结束）返回false
+func ExitCodeOf(err error) (int, bool) {
+	if err == nil {
+		return 0, true
+	}
+	var exitErr *RemoteExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code, true
+	}
+	return 0, false
+}
+
+// shellFunc 构造在目标shell中执行script的命令，script由目标上的sh解释
+type shellFunc func(ctx context.Context, script string) *exec.Cmd
+
+// runShellBinary 在目标shell中运行二进制，由输出末尾的标记取得真实退出码。
+// ctx取消时先调用kill结束目标上的进程：只结束本地的adb/ssh进程时目标上的进程会继续运行
+func runShellBinary(ctx context.Context, shell shellFunc, label, binary string, kill func(context.Context) error) (string, error) {
+	runCmd := shell(ctx, shellQuote(binary)+"; echo "+exitMarker+"$?")
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	runCmd.Stdout = &stdout
+	runCmd.Stderr = &stderr
+	var killErr error
+	runCmd.Cancel = func() error {
+		killErr = kill(context.WithoutCancel(ctx))
+		return runCmd.Process.Kill()
+	}
+
+	runErr := runCmd.Run()
+	output, code, ok := parseExitMarker(stdout.String())
+	output += stderr.String()
+
+	if ctx.Err() != nil {
+		if killErr != nil {
+			output += "\n" + killErr.Error()
+		}
+		return output, fmt.Errorf("%s执行被中断: %w", label, ctx.Err())
+	}
+	if !ok {
+		// 没有标记说明目标上的shell没有执行到echo，退回使用命令自身的退出状态
+		var exitErr *exec.ExitError
+		if errors.As(runErr, &exitErr) {
+			return output, &RemoteExitError{Code: exitErr.ExitCode()}
+		}
+		if runErr != nil {
+			return output, fmt.Errorf("%s执行失败: %w", label, runErr)
+		}
+		return output, fmt.Errorf("%s执行失败: 未取得退出码", label)
+	}
+	if code != 0 {
+		return output, &RemoteExitError{Code: code}
+	}
+	return output, nil
+}
+
+// killScript 按pgrep -f匹配到的进程逐层查找子进程，最后一起结束整棵进程树
+const killScript = `pids=$(pgrep -f %s); all=""
+while [ -n "$pids" ]; do
+	all="$all $pids"; next=""
+	for p in $pids; do next="$next $(pgrep -P $p)"; done
+	pids=$(echo $next)
+done
+[ -n "$all" ] && kill -9 $all; true`
+
+// killProcesses 通过目标shell结束命令行中包含完整路径name的进程及其子进程
+func killProcesses(ctx context.Context, shell shellFunc, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, cleanupTimeout)
+	defer cancel()
+	output, err := shell(ctx, fmt.Sprintf(killScript, shellQuote(killPattern(name)))).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("结束进程失败: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// removeFile 通过目标shell删除文件
+func removeFile(ctx context.Context, shell shellFunc, file string) error {
+	ctx, cancel := context.WithTimeout(ctx, cleanupTimeout)
+	defer cancel()
+	if output, err := shell(ctx, "rm -f "+shellQuote(file)).CombinedOutput(); err != nil {
+		return fmt.Errorf("删除二进制失败: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// parseExitMarker 从输出中去掉退出码标记行并解析退出码
+func parseExitMarker(output string) (string, int, bool) {
+	idx := strings.LastIndex(output, exitMarker)
+	if idx < 0 {
+		return output, 0, false
+	}
+	code, err := strconv.Atoi(strings.TrimSpace(output[idx+len(exitMarker):]))
+	if err != nil {
+		return output, 0, false
+	}
+	return output[:idx], code, true
+}
+
+// killPattern 返回完整匹配name的pgrep -f正则。首字符写成字符类，
+// 使执行pgrep的shell自身的命令行不会匹配，如 /tmp/bin 变为 [/]tmp/bin；
+// 前后要求不是路径字符，避免 /tmp/bin_1 误匹配 /tmp/bin_10 或 /a/tmp/bin_1
+func killPattern(name string) string {
+	if name == "" {
+		return name
+	}
+	return "(^|[^[:alnum:]_./-])[" + regexp.QuoteMeta(name[:1]) + "]" + regexp.QuoteMeta(name[1:]) + "([^[:alnum:]_./-]|$)"
+}
+
+// shellQuote 为目标shell加单引号
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
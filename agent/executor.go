@@ -1,10 +1,12 @@
 package agent
 
 import (
-	"bytes"
+	"context"
 	"fmt"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"time"
 )
 
 // AndroidExecutor 负责将测试二进制推送到 Android 设备执行
@@ -12,6 +14,10 @@ type AndroidExecutor struct {
 	ADBPath    string
 	RemoteDir  string
 	PackageDir string
+	// Serial 目标设备序列号，为空时由adb选择唯一连接的设备
+	Serial string
+	// KeepBinary 执行结束后保留设备端的二进制，便于手动复现
+	KeepBinary bool
 }
 
 // NewAndroidExecutor 创建执行器
@@ -28,30 +34,83 @@ func NewAndroidExecutor(adbPath, remoteDir string) *AndroidExecutor {
 	}
 }
 
-// Execute 在设备上运行二进制
+// ForDevice 返回指定设备序列号的执行器副本
+func (e *AndroidExecutor) ForDevice(serial string) Executor {
+	return e.withSerial(serial)
+}
+
+func (e *AndroidExecutor) withSerial(serial string) *AndroidExecutor {
+	clone := *e
+	clone.Serial = serial
+	return &clone
+}
+
+// Execute 在设备上运行二进制，结束后清理设备端进程和二进制
 func (e *AndroidExecutor) Execute(localBinary string) (string, error) {
-	remoteBinary := filepath.ToSlash(filepath.Join(e.RemoteDir, filepath.Base(localBinary)))
+	ctx := context.Background()
+	remoteBinary, output, err := e.Push(ctx, localBinary)
+	if err != nil {
+		return output, err
+	}
+	defer e.Cleanup(ctx, remoteBinary)
+	return e.Run(ctx, remoteBinary)
+}
 
-	pushCmd := exec.Command(e.ADBPath, "push", localBinary, remoteBinary)
+// Push 推送二进制到设备并添加执行权限，返回设备端路径
+func (e *AndroidExecutor) Push(ctx context.Context, localBinary string) (string, string, error) {
+	remoteBinary := path.Join(e.RemoteDir, filepath.Base(localBinary))
+
+	pushCmd := e.command(ctx, "push", localBinary, remoteBinary)
 	if output, err := pushCmd.CombinedOutput(); err != nil {
-		return string(output), fmt.Errorf("adb push失败: %w", err)
+		return "", string(output), fmt.Errorf("adb push失败: %w", err)
 	}
 
-	chmodCmd := exec.Command(e.ADBPath, "shell", "chmod", "+x", remoteBinary)
+	chmodCmd := e.command(ctx, "shell", "chmod", "+x", remoteBinary)
 	if output, err := chmodCmd.CombinedOutput(); err != nil {
-		return string(output), fmt.Errorf("adb chmod失败: %w", err)
+		return "", string(output), fmt.Errorf("adb chmod失败: %w", err)
 	}
 
-	runCmd := exec.Command(e.ADBPath, "shell", remoteBinary)
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	runCmd.Stdout = &stdout
-	runCmd.Stderr = &stderr
+	return remoteBinary, "", nil
+}
+
+// Run 在设备上运行已推送的二进制。非零退出码返回*RemoteExitError；
+// ctx取消或超时时按二进制路径结束设备端的进程，避免其在设备上继续运行
+func (e *AndroidExecutor) Run(ctx context.Context, remoteBinary string) (string, error) {
+	return runShellBinary(ctx, e.shell, "adb shell", remoteBinary, func(ctx context.Context) error {
+		return e.Kill(ctx, remoteBinary)
+	})
+}
+
+// Kill 按二进制的设备端完整路径结束本次执行的进程及其派生的子进程
+func (e *AndroidExecutor) Kill(ctx context.Context, remoteBinary string) error {
+	return killProcesses(ctx, e.shell, remoteBinary)
+}
 
-	if err := runCmd.Run(); err != nil {
-		return stdout.String() + stderr.String(), fmt.Errorf("adb shell执行失败: %w", err)
+// Cleanup 结束残留的设备端进程，未设置KeepBinary时删除推送的二进制。
+// 执行被取消后也要清理，因此使用独立于ctx取消的超时
+func (e *AndroidExecutor) Cleanup(ctx context.Context, remoteBinary string) error {
+	ctx = context.WithoutCancel(ctx)
+	if err := e.Kill(ctx, remoteBinary); err != nil {
+		return err
 	}
+	if e.KeepBinary {
+		return nil
+	}
+	return removeFile(ctx, e.shell, remoteBinary)
+}
 
-	return stdout.String(), nil
+// shell 通过adb shell在设备上执行脚本
+func (e *AndroidExecutor) shell(ctx context.Context, script string) *exec.Cmd {
+	return e.command(ctx, "shell", script)
 }
 
+// command 创建可随ctx取消的adb命令，设置了Serial时附加 -s 参数
+func (e *AndroidExecutor) command(ctx context.Context, args ...string) *exec.Cmd {
+	if e.Serial != "" {
+		args = append([]string{"-s", e.Serial}, args...)
+	}
+	cmd := exec.CommandContext(ctx, e.ADBPath, args...)
+	// adb的子进程可能继续占用输出管道，取消后最多再等待这么久
+	cmd.WaitDelay = 5 * time.Second
+	return cmd
+}
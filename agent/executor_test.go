@@ -0,0 +1,220 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scriptADB 写入一个在主机上直接执行adb shell命令的adb脚本，并记录调用参数
+func scriptADB(t *testing.T) (string, string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake adb script requires a POSIX shell")
+	}
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls.log")
+	script := `#!/bin/sh
+echo "$@" >> "` + calls + `"
+[ "$1" = "-s" ] && shift 2
+if [ "$1" = "shell" ]; then
+	shift
+	exec sh -c "$*"
+fi
+exit 0
+`
+	path := filepath.Join(dir, "adb")
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path, calls
+}
+
+func writeScript(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test_binary")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRunExitCodes(t *testing.T) {
+	adb, _ := scriptADB(t)
+	executor := NewAndroidExecutor(adb, t.TempDir())
+	ctx := context.Background()
+
+	output, err := executor.Run(ctx, writeScript(t, "echo hello\n"))
+	if err != nil || output != "hello\n" {
+		t.Fatalf("Run = %q, %v, want hello without exit marker", output, err)
+	}
+
+	output, err = executor.Run(ctx, writeScript(t, "printf partial\nexit 123\n"))
+	var exitErr *RemoteExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != ExitCodeRestart {
+		t.Fatalf("Run error = %v, want exit code 123", err)
+	}
+	if output != "partial" {
+		t.Errorf("output = %q, want partial", output)
+	}
+	if !strings.Contains(err.Error(), "system.RestartSelf") {
+		t.Errorf("error %q should mention system.RestartSelf", err)
+	}
+	if code, ok := ExitCodeOf(err); !ok || code != 123 {
+		t.Errorf("ExitCodeOf = %d, %v", code, ok)
+	}
+}
+
+func TestRunTimeoutKillsRemoteProcess(t *testing.T) {
+	adb, calls := scriptADB(t)
+	executor := NewAndroidExecutor(adb, t.TempDir())
+	binary := writeScript(t, "sleep 30\n")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := executor.Run(ctx, binary)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Run error = %v, want DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Run took %v after timeout", elapsed)
+	}
+	if _, ok := ExitCodeOf(err); ok {
+		t.Error("exit code of a killed run should be unknown")
+	}
+	log, _ := os.ReadFile(calls)
+	if !strings.Contains(string(log), "pgrep -f '"+killPattern(binary)+"'") {
+		t.Errorf("timeout should kill the remote binary, calls:\n%s", log)
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	adb, _ := scriptADB(t)
+	executor := NewAndroidExecutor(adb, t.TempDir())
+	binary := writeScript(t, "exit 0\n")
+
+	executor.KeepBinary = true
+	if err := executor.Cleanup(context.Background(), binary); err != nil {
+		t.Fatalf("Cleanup: %v", err)
+	}
+	if _, err := os.Stat(binary); err != nil {
+		t.Errorf("KeepBinary should keep %s: %v", binary, err)
+	}
+
+	executor.KeepBinary = false
+	if err := executor.Cleanup(context.Background(), binary); err != nil {
+		t.Fatalf("Cleanup: %v", err)
+	}
+	if _, err := os.Stat(binary); !os.IsNotExist(err) {
+		t.Errorf("Cleanup should remove %s", binary)
+	}
+}
+
+func TestCleanupKeepsOtherRuns(t *testing.T) {
+	adb, _ := scriptADB(t)
+	executor := NewAndroidExecutor(adb, t.TempDir())
+	dir := t.TempDir()
+	write := func(name string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("#!/bin/sh\nsleep 30\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	binary := write("test_binary_1")
+	other := write("test_binary_10")
+
+	// 另一次执行的二进制名以本次的为前缀，清理时不能被误杀
+	cmd := exec.Command(other)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	if err := executor.Cleanup(context.Background(), binary); err != nil {
+		t.Fatalf("Cleanup: %v", err)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("Cleanup killed another run's process: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("Cleanup removed another run's binary: %v", err)
+	}
+}
+
+func TestParseExitMarker(t *testing.T) {
+	tests := []struct {
+		output string
+		want   string
+		code   int
+		ok     bool
+	}{
+		{"ok\n" + exitMarker + "0\n", "ok\n", 0, true},
+		{"no newline" + exitMarker + "1\r\n", "no newline", 1, true},
+		{"old adb without marker", "old adb without marker", 0, false},
+		{exitMarker + "garbage", exitMarker + "garbage", 0, false},
+	}
+	for _, tt := range tests {
+		got, code, ok := parseExitMarker(tt.output)
+		if got != tt.want || code != tt.code || ok != tt.ok {
+			t.Errorf("parseExitMarker(%q) = %q, %d, %v", tt.output, got, code, ok)
+		}
+	}
+}
+
+func TestDescribeExitCode(t *testing.T) {
+	tests := map[int]string{
+		0:   "成功",
+		1:   "执行失败",
+		123: "脚本请求重启（system.RestartSelf）",
+		127: "找不到可执行文件",
+		137: "被信号 9 (SIGKILL) 终止",
+		139: "被信号 11 (SIGSEGV) 终止",
+	}
+	for code, want := range tests {
+		if got := DescribeExitCode(code); got != want {
+			t.Errorf("DescribeExitCode(%d) = %q, want %q", code, got, want)
+		}
+	}
+	if got := killPattern("/tmp/test.bin"); got != `(^|[^[:alnum:]_./-])[/]tmp/test\.bin([^[:alnum:]_./-]|$)` {
+		t.Errorf("killPattern = %q", got)
+	}
+}
+
+func TestHostExecutor(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("host executor requires a POSIX shell")
+	}
+	executor := NewHostExecutor()
+	ctx := context.Background()
+	devices, err := executor.Devices(ctx)
+	if err != nil || len(devices) != 1 || !devices[0].Ready() {
+		t.Fatalf("Devices = %+v, %v", devices, err)
+	}
+
+	binary, _, err := executor.Push(ctx, writeScript(t, "echo on host\nexit 3\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := executor.Run(ctx, binary)
+	if code, ok := ExitCodeOf(err); !ok || code != 3 || output != "on host\n" {
+		t.Errorf("Run = %q, %v", output, err)
+	}
+	if err := executor.Cleanup(ctx, binary); err != nil {
+		t.Errorf("Cleanup: %v", err)
+	}
+	if _, err := os.Stat(binary); err != nil {
+		t.Error("host Cleanup should leave the binary in the run dir")
+	}
+}
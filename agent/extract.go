@@ -0,0 +1,111 @@
+package agent
+
+import (
+	"fmt"
+	"go/format"
+	"regexp"
+	"strings"
+)
+
+// ExtractionError LLM响应中没有可用的Go代码，Reasons记录每个候选被拒绝的原因
+type ExtractionError struct {
+	Reasons []string
+}
+
+func (e *ExtractionError) Error() string {
+	return "无法从LLM响应中提取有效的Go代码: " + strings.Join(e.Reasons, "; ")
+}
+
+// fencePattern 匹配Markdown代码块，分组1为语言标记，分组2为代码
+var fencePattern = regexp.MustCompile("(?s)```[ \\t]*([A-Za-z0-9_+-]*)[^\\n]*\\n(.*?)\\n?[ \\t]*```")
+
+// mainFuncPattern 匹配顶层的main函数声明
+var mainFuncPattern = regexp.MustCompile(`(?m)^func\s+main\s*\(\s*\)`)
+
+// codeCandidate 从响应中找到的候选代码
+type codeCandidate struct {
+	label string
+	code  string
+}
+
+// ExtractGoCode 从LLM响应中提取Go代码：优先使用Markdown代码块，
+// 多个代码块时选择包含 package main 和 main 函数的那个，去掉前后的说明文字，
+// 并用go/format格式化。没有可用代码时返回*ExtractionError说明原因。
+func ExtractGoCode(response string) (string, error) {
+	response = strings.ReplaceAll(response, "\r\n", "\n")
+	if strings.TrimSpace(response) == "" {
+		return "", &ExtractionError{Reasons: []string{"响应为空"}}
+	}
+
+	var candidates []codeCandidate
+	var reasons []string
+	for i, match := range fencePattern.FindAllStringSubmatch(response, -1) {
+		label := fmt.Sprintf("代码块%d", i+1)
+		switch strings.ToLower(match[1]) {
+		case "", "go", "golang":
+			candidates = append(candidates, codeCandidate{label: label, code: match[2]})
+		default:
+			reasons = append(reasons, fmt.Sprintf("%s: 语言为%s", label, match[1]))
+		}
+	}
+	if len(candidates) == 0 {
+		// 没有代码块时，从package声明开始截取
+		if code, ok := stripProse(response); ok {
+			candidates = append(candidates, codeCandidate{label: "正文", code: code})
+		} else if len(reasons) == 0 {
+			reasons = append(reasons, "未找到Go代码块或package声明")
+		}
+	}
+
+	// 只接受包含main函数的package main，其余候选记录拒绝原因
+	for _, c := range candidates {
+		switch {
+		case !isMainPackage(c.code):
+			reasons = append(reasons, fmt.Sprintf("%s: 不是package main", c.label))
+		case !mainFuncPattern.MatchString(c.code):
+			reasons = append(reasons, fmt.Sprintf("%s: package main中没有main函数", c.label))
+		default:
+			formatted, err := format.Source([]byte(c.code))
+			if err != nil {
+				reasons = append(reasons, fmt.Sprintf("%s: 格式化失败: %v", c.label, err))
+				continue
+			}
+			return string(formatted), nil
+		}
+	}
+	return "", &ExtractionError{Reasons: reasons}
+}
+
+// isMainPackage 代码是否声明为package main
+func isMainPackage(code string) bool {
+	for _, line := range strings.Split(code, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "package" {
+			return fields[1] == "main"
+		}
+	}
+	return false
+}
+
+// stripProse 去掉没有代码块的响应中package声明之前和最后一个顶层右括号之后的说明文字
+func stripProse(response string) (string, bool) {
+	lines := strings.Split(response, "\n")
+	start := -1
+	for i, line := range lines {
+		if strings.HasPrefix(line, "package ") {
+			start = i
+			break
+		}
+	}
+	if start == -1 {
+		return "", false
+	}
+	end := len(lines)
+	for i := len(lines) - 1; i > start; i-- {
+		if strings.HasPrefix(lines[i], "}") || strings.HasPrefix(lines[i], ")") {
+			end = i + 1
+			break
+		}
+	}
+	return strings.Join(lines[start:end], "\n"), true
+}
@@ -0,0 +1,96 @@
+package agent
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestExtractGoCode(t *testing.T) {
+	const mainCode = "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"ok\")\n}\n"
+
+	tests := []struct {
+		name     string
+		response string
+		want     string // 期望结果包含的内容，为空表示应被拒绝
+		reason   string // 拒绝原因包含的内容
+	}{
+		{
+			name:     "plain code",
+			response: mainCode,
+			want:     "func main() {",
+		},
+		{
+			name:     "fenced with prose",
+			response: "下面是测试脚本：\n\n```go\n" + mainCode + "```\n\n说明：脚本会打印ok。",
+			want:     "fmt.Println(\"ok\")",
+		},
+		{
+			name:     "prefers package main among several files",
+			response: "```go\npackage helper\n\nfunc Help() {}\n```\n\n```golang\n" + mainCode + "```",
+			want:     "package main",
+		},
+		{
+			name:     "unformatted code is formatted",
+			response: "```\npackage main\nimport \"fmt\"\nfunc main(){fmt.Println(\"ok\")}\n```",
+			want:     "func main() { fmt.Println(\"ok\") }",
+		},
+		{
+			name:     "prose around unfenced code",
+			response: "好的，代码如下\n" + mainCode + "希望对你有帮助",
+			want:     "package main",
+		},
+		{
+			name:     "empty",
+			response: "  ",
+			reason:   "响应为空",
+		},
+		{
+			name:     "no code",
+			response: "抱歉，我无法完成这个请求。",
+			reason:   "未找到Go代码块",
+		},
+		{
+			name:     "syntax error",
+			response: "```go\npackage main\n\nfunc main() {\n```",
+			reason:   "格式化失败",
+		},
+		{
+			name:     "package main without func main",
+			response: "```go\npackage main\n\n// func main() {}\nfunc helper() {}\n```",
+			reason:   "package main中没有main函数",
+		},
+		{
+			name:     "skips a main package without func main",
+			response: "```go\npackage main\n\nimport \"fmt\"\n```\n\n```go\n" + mainCode + "```",
+			want:     "func main() {",
+		},
+		{
+			name:     "not main package",
+			response: "```go\npackage helper\n```\n```bash\ngo build\n```",
+			reason:   "不是package main",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := ExtractGoCode(tt.response)
+			if tt.want != "" {
+				if err != nil {
+					t.Fatalf("ExtractGoCode: %v", err)
+				}
+				if !strings.Contains(code, tt.want) || strings.Contains(code, "```") {
+					t.Errorf("extracted code does not contain %q:\n%s", tt.want, code)
+				}
+				return
+			}
+			var extractErr *ExtractionError
+			if !errors.As(err, &extractErr) {
+				t.Fatalf("ExtractGoCode error = %v, want *ExtractionError", err)
+			}
+			if !strings.Contains(err.Error(), tt.reason) {
+				t.Errorf("error %q does not mention %q", err, tt.reason)
+			}
+		})
+	}
+}
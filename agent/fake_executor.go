@@ -0,0 +1,175 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FakeRun FakeExecutor 一次执行的脚本化结果
+type FakeRun struct {
+	Serial   string        // 只用于该设备的执行，为空时用于任意设备
+	Output   string        // Run返回的输出
+	ExitCode int           // 非零时Run返回*RemoteExitError
+	Err      error         // Run返回的错误，优先于ExitCode
+	PushErr  error         // 非nil时Push失败，本次执行随之消耗
+	Delay    time.Duration // Run阻塞的时间，期间ctx取消时返回ctx.Err()
+	Logcat   string        // CollectEvidence返回的日志
+}
+
+// FakeCall FakeExecutor 记录的一次调用
+type FakeCall struct {
+	Serial string
+	Method string // devices, push, run, cleanup, logcat, evidence
+	Arg    string
+}
+
+// FakeExecutor 内存中的执行器，按脚本依次返回输出和失败，
+// 用于在没有设备的环境中测试执行流水线。脚本用完后重复最后一次匹配的结果，没有脚本时总是成功。
+type FakeExecutor struct {
+	Serial string
+	state  *fakeState
+}
+
+// fakeState 同一FakeExecutor及其ForDevice副本共享的状态
+type fakeState struct {
+	mu      sync.Mutex
+	devices []Device
+	runs    []FakeRun
+	used    []bool
+	calls   []FakeCall
+	last    map[string]FakeRun
+}
+
+// NewFakeExecutor 创建内存执行器，devices为空时提供一台名为fake的设备
+func NewFakeExecutor(devices []Device, runs ...FakeRun) *FakeExecutor {
+	if len(devices) == 0 {
+		devices = []Device{{Serial: "fake", State: "device", Model: "Fake"}}
+	}
+	return &FakeExecutor{state: &fakeState{
+		devices: devices,
+		runs:    runs,
+		used:    make([]bool, len(runs)),
+		last:    make(map[string]FakeRun),
+	}}
+}
+
+// Calls 返回记录的调用
+func (f *FakeExecutor) Calls() []FakeCall {
+	f.state.mu.Lock()
+	defer f.state.mu.Unlock()
+	return append([]FakeCall(nil), f.state.calls...)
+}
+
+func (f *FakeExecutor) record(method, arg string) {
+	f.state.mu.Lock()
+	f.state.calls = append(f.state.calls, FakeCall{Serial: f.Serial, Method: method, Arg: arg})
+	f.state.mu.Unlock()
+}
+
+// next 取出本设备的下一次执行结果，consume为false时只查看不消耗
+func (f *FakeExecutor) next(consume bool) FakeRun {
+	s := f.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lastMatch := -1
+	for i, run := range s.runs {
+		if run.Serial != "" && run.Serial != f.Serial {
+			continue
+		}
+		lastMatch = i
+		if !s.used[i] {
+			if consume {
+				s.used[i] = true
+				s.last[f.Serial] = run
+			}
+			return run
+		}
+	}
+	if lastMatch < 0 {
+		return FakeRun{}
+	}
+	run := s.runs[lastMatch]
+	if consume {
+		s.last[f.Serial] = run
+	}
+	return run
+}
+
+// Devices 返回配置的设备
+func (f *FakeExecutor) Devices(ctx context.Context) ([]Device, error) {
+	f.record("devices", "")
+	f.state.mu.Lock()
+	defer f.state.mu.Unlock()
+	return append([]Device(nil), f.state.devices...), nil
+}
+
+// ForDevice 返回绑定到指定设备、共享脚本和调用记录的副本
+func (f *FakeExecutor) ForDevice(serial string) Executor {
+	return &FakeExecutor{Serial: serial, state: f.state}
+}
+
+// Push 模拟推送，脚本中的PushErr在此返回
+func (f *FakeExecutor) Push(ctx context.Context, localBinary string) (string, string, error) {
+	f.record("push", localBinary)
+	if run := f.next(false); run.PushErr != nil {
+		f.next(true)
+		return "", "", run.PushErr
+	}
+	return path.Join("/fake", filepath.Base(localBinary)), "", nil
+}
+
+// Run 返回脚本中的下一次执行结果
+func (f *FakeExecutor) Run(ctx context.Context, remoteBinary string) (string, error) {
+	f.record("run", remoteBinary)
+	run := f.next(true)
+	if run.Delay > 0 {
+		timer := time.NewTimer(run.Delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return run.Output, ctx.Err()
+		}
+	}
+	if run.Err != nil {
+		return run.Output, run.Err
+	}
+	if run.ExitCode != 0 {
+		return run.Output, &RemoteExitError{Code: run.ExitCode}
+	}
+	return run.Output, nil
+}
+
+// Cleanup 记录清理调用
+func (f *FakeExecutor) Cleanup(ctx context.Context, remoteBinary string) error {
+	f.record("cleanup", remoteBinary)
+	return nil
+}
+
+// StartLogcat 记录调用并返回固定的起点
+func (f *FakeExecutor) StartLogcat(ctx context.Context) (string, error) {
+	f.record("logcat", "")
+	return "fake-since", nil
+}
+
+// CollectEvidence 返回最近一次执行的日志，capture为true时写入一张假截图
+func (f *FakeExecutor) CollectEvidence(ctx context.Context, dir, since string, capture bool) *Evidence {
+	f.record("evidence", since)
+	f.state.mu.Lock()
+	evidence := &Evidence{Logcat: f.state.last[f.Serial].Logcat}
+	f.state.mu.Unlock()
+	if !capture {
+		return evidence
+	}
+	screenshot := filepath.Join(dir, sanitizeFileName(f.Serial)+".png")
+	if err := os.MkdirAll(dir, 0755); err == nil && os.WriteFile(screenshot, []byte("fake screenshot"), 0644) == nil {
+		evidence.Screenshot = screenshot
+	} else {
+		evidence.Errors = append(evidence.Errors, "写入截图失败")
+	}
+	return evidence
+}
@@ -0,0 +1,346 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// ReportHistory 报告历史库，按查询哈希记录每次执行的报告
+type ReportHistory struct {
+	db *sql.DB
+}
+
+// HistoryEntry 一次执行的历史记录
+type HistoryEntry struct {
+	ID         int64         `json:"id"`
+	QueryHash  string        `json:"query_hash"`
+	Query      string        `json:"query"`
+	Success    bool          `json:"success"`
+	Duration   time.Duration `json:"duration"`
+	Timestamp  time.Time     `json:"timestamp"`
+	ReportPath string        `json:"report_path,omitempty"`
+}
+
+// HistoryFilter 历史查询条件，零值字段表示不过滤
+type HistoryFilter struct {
+	Query     string    // 查询文本包含的关键字
+	QueryHash string    // 精确匹配查询哈希
+	Status    string    // pass 或 fail
+	Since     time.Time // 起始时间（含）
+	Until     time.Time // 截止时间（不含）
+	Limit     int
+}
+
+// QueryTrend 单个查询的通过率趋势
+type QueryTrend struct {
+	QueryHash string    `json:"query_hash"`
+	Query     string    `json:"query"`
+	Runs      int       `json:"runs"`
+	Passed    int       `json:"passed"`
+	PassRate  float64   `json:"pass_rate"`
+	Flips     int       `json:"flips"` // 相邻两次执行结果发生翻转的次数
+	Flaky     bool      `json:"flaky"`
+	Recent    string    `json:"recent"` // 最近的执行结果，按时间顺序，如 "PPFP"
+	LastRun   time.Time `json:"last_run"`
+}
+
+// QueryHash 计算查询的哈希，忽略首尾空白和大小写差异
+func QueryHash(query string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(query))))
+	return hex.EncodeToString(sum[:8])
+}
+
+// DefaultHistoryPath 返回知识库同目录下的默认历史库路径
+func DefaultHistoryPath(kbPath string) string {
+	return filepath.Join(filepath.Dir(kbPath), "report_history.db")
+}
+
+// OpenReportHistory 打开（不存在时创建）报告历史库
+func OpenReportHistory(dbPath string) (*ReportHistory, error) {
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite3", dbPath+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+
+	h := &ReportHistory{db: db}
+	if err := h.initDB(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return h, nil
+}
+
+// initDB 初始化数据库
+func (h *ReportHistory) initDB() error {
+	createTableSQL := `
+	CREATE TABLE IF NOT EXISTS report_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		query_hash TEXT NOT NULL,
+		query TEXT NOT NULL,
+		success INTEGER NOT NULL,
+		duration INTEGER NOT NULL,
+		timestamp INTEGER NOT NULL,
+		report_path TEXT,
+		report TEXT NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_history_query_hash ON report_history(query_hash);
+	CREATE INDEX IF NOT EXISTS idx_history_timestamp ON report_history(timestamp);
+	`
+
+	_, err := h.db.Exec(createTableSQL)
+	return err
+}
+
+// Close 关闭数据库
+func (h *ReportHistory) Close() error {
+	return h.db.Close()
+}
+
+// Record 记录一份报告，返回记录ID
+func (h *ReportHistory) Record(report *TestReport, reportPath string) (int64, error) {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return 0, err
+	}
+	res, err := h.db.Exec(`
+	INSERT INTO report_history (query_hash, query, success, duration, timestamp, report_path, report)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, QueryHash(report.Query), report.Query, report.Success, int64(report.Duration),
+		report.Timestamp.UnixNano(), reportPath, string(data))
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// Get 读取一条历史记录的完整报告
+func (h *ReportHistory) Get(id int64) (*TestReport, error) {
+	var data string
+	err := h.db.QueryRow("SELECT report FROM report_history WHERE id = ?", id).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("历史记录不存在: %d", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var report TestReport
+	if err := json.Unmarshal([]byte(data), &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// where 将过滤条件转换为SQL条件和参数
+func (f HistoryFilter) where() (string, []interface{}, error) {
+	var conds []string
+	var args []interface{}
+	if f.Query != "" {
+		conds = append(conds, "LOWER(query) LIKE ?")
+		args = append(args, "%"+strings.ToLower(f.Query)+"%")
+	}
+	if f.QueryHash != "" {
+		conds = append(conds, "query_hash = ?")
+		args = append(args, f.QueryHash)
+	}
+	switch strings.ToLower(f.Status) {
+	case "":
+	case "pass", "passed", "success":
+		conds = append(conds, "success = 1")
+	case "fail", "failed", "failure":
+		conds = append(conds, "success = 0")
+	default:
+		return "", nil, fmt.Errorf("无效的状态: %s（可选 pass, fail）", f.Status)
+	}
+	if !f.Since.IsZero() {
+		conds = append(conds, "timestamp >= ?")
+		args = append(args, f.Since.UnixNano())
+	}
+	if !f.Until.IsZero() {
+		conds = append(conds, "timestamp < ?")
+		args = append(args, f.Until.UnixNano())
+	}
+	if len(conds) == 0 {
+		return "", args, nil
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args, nil
+}
+
+// List 按时间倒序列出历史记录
+func (h *ReportHistory) List(filter HistoryFilter) ([]HistoryEntry, error) {
+	where, args, err := filter.where()
+	if err != nil {
+		return nil, err
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := h.db.Query(`
+	SELECT id, query_hash, query, success, duration, timestamp, report_path
+	FROM report_history `+where+`
+	ORDER BY timestamp DESC, id DESC
+	LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []HistoryEntry{}
+	for rows.Next() {
+		var e HistoryEntry
+		var duration, timestamp int64
+		var reportPath sql.NullString
+		if err := rows.Scan(&e.ID, &e.QueryHash, &e.Query, &e.Success, &duration, &timestamp, &reportPath); err != nil {
+			return nil, err
+		}
+		e.Duration = time.Duration(duration)
+		e.Timestamp = time.Unix(0, timestamp)
+		e.ReportPath = reportPath.String
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Trends 统计每个查询的通过率和结果翻转次数，按最近执行时间倒序；
+// 结果在相邻两次执行间发生过翻转的查询标记为不稳定（flaky）
+func (h *ReportHistory) Trends(filter HistoryFilter) ([]QueryTrend, error) {
+	where, args, err := filter.where()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := h.db.Query(`
+	SELECT query_hash, query, success, timestamp
+	FROM report_history `+where+`
+	ORDER BY timestamp ASC, id ASC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trends := make(map[string]*QueryTrend)
+	last := make(map[string]bool)
+	for rows.Next() {
+		var hash, query string
+		var success bool
+		var timestamp int64
+		if err := rows.Scan(&hash, &query, &success, &timestamp); err != nil {
+			return nil, err
+		}
+		t, ok := trends[hash]
+		if !ok {
+			t = &QueryTrend{QueryHash: hash}
+			trends[hash] = t
+		} else if last[hash] != success {
+			t.Flips++
+		}
+		last[hash] = success
+		t.Query = query
+		t.Runs++
+		if success {
+			t.Passed++
+			t.Recent += "P"
+		} else {
+			t.Recent += "F"
+		}
+		t.LastRun = time.Unix(0, timestamp)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]QueryTrend, 0, len(trends))
+	for _, t := range trends {
+		t.PassRate = float64(t.Passed) / float64(t.Runs)
+		t.Flaky = t.Flips > 0
+		if len(t.Recent) > 20 {
+			t.Recent = t.Recent[len(t.Recent)-20:]
+		}
+		result = append(result, *t)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].LastRun.After(result[j].LastRun)
+	})
+	if filter.Limit > 0 && len(result) > filter.Limit {
+		result = result[:filter.Limit]
+	}
+	return result, nil
+}
+
+// Flaky 返回结果不稳定的查询
+func (h *ReportHistory) Flaky(filter HistoryFilter) ([]QueryTrend, error) {
+	limit := filter.Limit
+	filter.Limit = 0
+	trends, err := h.Trends(filter)
+	if err != nil {
+		return nil, err
+	}
+	flaky := []QueryTrend{}
+	for _, t := range trends {
+		if t.Flaky {
+			flaky = append(flaky, t)
+		}
+	}
+	if limit > 0 && len(flaky) > limit {
+		flaky = flaky[:limit]
+	}
+	return flaky, nil
+}
+
+// ParseHistoryDate 解析日期参数，支持 2006-01-02、2006-01-02 15:04:05 和 RFC3339，空字符串返回零值
+func ParseHistoryDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04:05", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("无效的日期: %s（格式 2006-01-02）", value)
+}
+
+// FormatHistory 格式化历史记录列表
+func FormatHistory(entries []HistoryEntry) string {
+	if len(entries) == 0 {
+		return "没有历史记录\n"
+	}
+	var builder strings.Builder
+	for _, e := range entries {
+		status := map[bool]string{true: "✅", false: "❌"}[e.Success]
+		builder.WriteString(fmt.Sprintf("#%-5d %s %s %s %-8v %s\n", e.ID, e.Timestamp.Format("2006-01-02 15:04:05"),
+			e.QueryHash, status, e.Duration.Round(time.Millisecond), e.Query))
+	}
+	return builder.String()
+}
+
+// FormatTrends 格式化通过率趋势
+func FormatTrends(trends []QueryTrend) string {
+	if len(trends) == 0 {
+		return "没有历史记录\n"
+	}
+	var builder strings.Builder
+	for _, t := range trends {
+		flaky := ""
+		if t.Flaky {
+			flaky = fmt.Sprintf(" ⚠️ 不稳定(翻转%d次)", t.Flips)
+		}
+		builder.WriteString(fmt.Sprintf("%s 通过率 %5.1f%% (%d/%d) %s%s\n    %s\n", t.QueryHash, t.PassRate*100,
+			t.Passed, t.Runs, t.Recent, flaky, t.Query))
+	}
+	return builder.String()
+}
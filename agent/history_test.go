@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReportHistory(t *testing.T) {
+	history, err := OpenReportHistory(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatalf("OpenReportHistory: %v", err)
+	}
+	defer history.Close()
+
+	base := time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local)
+	runs := []struct {
+		query   string
+		success bool
+	}{
+		{"点击登录按钮", true},
+		{"点击登录按钮", false},
+		{"点击登录按钮", true},
+		{"启动应用 com.example", true},
+		{"启动应用 com.example", true},
+	}
+	for i, run := range runs {
+		// 同一秒内的多次执行都必须保留
+		report := &TestReport{Query: run.query, Success: run.success, Timestamp: base.Add(time.Duration(i) * time.Millisecond)}
+		if _, err := history.Record(report, ""); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+
+	all, err := history.List(HistoryFilter{})
+	if err != nil || len(all) != len(runs) {
+		t.Fatalf("List returned %d entries (err %v), want %d", len(all), err, len(runs))
+	}
+	if all[0].Query != "启动应用 com.example" {
+		t.Errorf("List not ordered newest first: %+v", all[0])
+	}
+
+	failed, _ := history.List(HistoryFilter{Query: "登录", Status: "fail"})
+	if len(failed) != 1 || failed[0].QueryHash != QueryHash(" 点击登录按钮 ") {
+		t.Errorf("status filter returned %+v", failed)
+	}
+	if none, _ := history.List(HistoryFilter{Since: base.Add(time.Hour)}); len(none) != 0 {
+		t.Errorf("date filter returned %d entries", len(none))
+	}
+	if _, err := history.List(HistoryFilter{Status: "maybe"}); err == nil {
+		t.Error("List accepted an invalid status")
+	}
+
+	trends, err := history.Trends(HistoryFilter{})
+	if err != nil || len(trends) != 2 {
+		t.Fatalf("Trends returned %+v (err %v)", trends, err)
+	}
+	login := trends[1]
+	if login.Runs != 3 || login.Passed != 2 || login.Flips != 2 || !login.Flaky || login.Recent != "PFP" {
+		t.Errorf("unexpected login trend %+v", login)
+	}
+
+	flaky, _ := history.Flaky(HistoryFilter{})
+	if len(flaky) != 1 || flaky[0].Query != "点击登录按钮" {
+		t.Errorf("Flaky returned %+v", flaky)
+	}
+
+	report, err := history.Get(all[0].ID)
+	if err != nil || report.Query != all[0].Query {
+		t.Errorf("Get returned %+v (err %v)", report, err)
+	}
+}
@@ -0,0 +1,61 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// hostSerial 本机执行目标的序列号
+const hostSerial = "host"
+
+// HostExecutor 在本机直接运行测试二进制，用于编译目标为主机时的冒烟测试。
+// 通过sh执行，需要POSIX环境
+type HostExecutor struct{}
+
+// NewHostExecutor 创建本机执行器
+func NewHostExecutor() *HostExecutor {
+	return &HostExecutor{}
+}
+
+// Devices 本机只有一个执行目标
+func (e *HostExecutor) Devices(ctx context.Context) ([]Device, error) {
+	name, _ := os.Hostname()
+	return []Device{{Serial: hostSerial, State: "device", Model: name}}, nil
+}
+
+// ForDevice 本机只有一个目标，返回自身
+func (e *HostExecutor) ForDevice(serial string) Executor {
+	return e
+}
+
+// Push 二进制已在本机，直接返回其绝对路径
+func (e *HostExecutor) Push(ctx context.Context, localBinary string) (string, string, error) {
+	path, err := filepath.Abs(localBinary)
+	if err != nil {
+		return "", "", err
+	}
+	return path, "", nil
+}
+
+// Run 运行二进制，ctx取消时结束其进程树
+func (e *HostExecutor) Run(ctx context.Context, binary string) (string, error) {
+	return runShellBinary(ctx, hostShell, "本机", binary, func(ctx context.Context) error {
+		return killProcesses(ctx, hostShell, binary)
+	})
+}
+
+// Cleanup 结束残留进程。二进制位于执行目录中，由工作目录回收统一清理
+func (e *HostExecutor) Cleanup(ctx context.Context, binary string) error {
+	// 每次执行的二进制路径不同，按完整路径匹配以免误杀其他执行
+	return killProcesses(context.WithoutCancel(ctx), hostShell, binary)
+}
+
+// hostShell 通过本机sh执行脚本
+func hostShell(ctx context.Context, script string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "sh", "-c", script)
+	cmd.WaitDelay = 5 * time.Second
+	return cmd
+}
@@ -0,0 +1,825 @@
+package agent
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Intent 用户意图，由ParseIntent从单个步骤描述中解析
+type Intent struct {
+	Action     string            // 操作类型: click, input, assert, wait, launch, swipe
+	Target     string            // 目标: button, input, text, image, coordinate
+	Value      string            // 值: 坐标、文本、图片路径、包名等
+	Module     string            // 使用的模块
+	Parameters map[string]string // 额外参数
+
+	Point     *Point        // 操作的坐标
+	From      *Point        // 滑动起点
+	To        *Point        // 滑动终点
+	Direction string        // 滑动方向: up, down, left, right
+	Duration  time.Duration // 等待时长或滑动时长
+	Package   string        // 应用包名
+	Texts     []string      // 引号中的文本，按出现顺序
+}
+
+// Point 屏幕坐标
+type Point struct {
+	X, Y int
+}
+
+func (p Point) String() string {
+	return fmt.Sprintf("(%d, %d)", p.X, p.Y)
+}
+
+func (i Intent) String() string {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("Action: %s\n", i.Action))
+	builder.WriteString(fmt.Sprintf("Target: %s\n", i.Target))
+	if i.Value != "" {
+		builder.WriteString(fmt.Sprintf("Value: %s\n", i.Value))
+	}
+	if i.Module != "" {
+		builder.WriteString(fmt.Sprintf("Module: %s\n", i.Module))
+	}
+	if i.From != nil || i.To != nil {
+		builder.WriteString(fmt.Sprintf("Swipe: %v -> %v\n", i.From, i.To))
+	}
+	if i.Direction != "" {
+		builder.WriteString(fmt.Sprintf("Direction: %s\n", i.Direction))
+	}
+	if i.Duration > 0 {
+		builder.WriteString(fmt.Sprintf("Duration: %s\n", i.Duration))
+	}
+	if i.Package != "" && i.Package != i.Value {
+		builder.WriteString(fmt.Sprintf("Package: %s\n", i.Package))
+	}
+	if len(i.Texts) > 1 {
+		builder.WriteString(fmt.Sprintf("Texts: %q\n", i.Texts))
+	}
+	if len(i.Parameters) > 0 {
+		builder.WriteString("Parameters:\n")
+		for k, v := range i.Parameters {
+			builder.WriteString(fmt.Sprintf(" - %s: %s\n", k, v))
+		}
+	}
+	return builder.String()
+}
+
+// lexeme 词典中一个词的含义，同一个词可以同时有多种含义
+type lexeme struct {
+	action    string        // 操作类型
+	target    string        // 目标类型
+	module    string        // 提示使用的模块
+	direction string        // 滑动方向
+	unit      time.Duration // 时间单位
+	role      string        // 坐标的角色: from, to
+	value     string        // 作为操作词时的固定值，如按键名
+	negate    bool          // 否定词，紧跟其后的操作不执行
+}
+
+// intentLexicon 意图词典。中文按最长匹配切分，英文按单词匹配，多个英文单词的词组用空格连接
+var intentLexicon = map[string]lexeme{
+	// 点击
+	"点击": {action: "click", module: "motion"}, "单击": {action: "click", module: "motion"},
+	"点按": {action: "click", module: "motion"}, "轻触": {action: "click", module: "motion"},
+	"轻点": {action: "click", module: "motion"}, "按下": {action: "click", module: "motion"},
+	"click": {action: "click", module: "motion"}, "tap": {action: "click", module: "motion"},
+	"press": {action: "click", module: "motion"},
+	// 输入
+	"输入": {action: "input"}, "填写": {action: "input"}, "填入": {action: "input"},
+	"键入": {action: "input"}, "录入": {action: "input"},
+	"input": {action: "input", target: "input"}, "type": {action: "input"},
+	"enter": {action: "input"}, "fill": {action: "input"},
+	// 断言
+	"验证": {action: "assert"}, "检查": {action: "assert"}, "确认": {action: "assert"},
+	"断言": {action: "assert"}, "校验": {action: "assert"},
+	"assert": {action: "assert"}, "verify": {action: "assert"}, "check": {action: "assert"},
+	"expect": {action: "assert"}, "ensure": {action: "assert"},
+	// 等待
+	"等待": {action: "wait"}, "等": {action: "wait"}, "稍等": {action: "wait"}, "等一下": {action: "wait"},
+	"暂停": {action: "wait"}, "停留": {action: "wait"},
+	"wait": {action: "wait"}, "sleep": {action: "wait"}, "pause": {action: "wait"},
+	// 启动
+	"启动": {action: "launch"}, "打开": {action: "launch"}, "运行": {action: "launch"},
+	"开启":     {action: "launch"},
+	"launch": {action: "launch"}, "open": {action: "launch"}, "start": {action: "launch"},
+	// 滑动
+	"滑动": {action: "swipe"}, "滑屏": {action: "swipe"}, "划动": {action: "swipe"},
+	"拖动": {action: "swipe"}, "拖拽": {action: "swipe"}, "滑": {action: "swipe"}, "划": {action: "swipe"},
+	"swipe": {action: "swipe"}, "scroll": {action: "swipe"}, "drag": {action: "swipe"},
+	"fling": {action: "swipe"},
+	// 滑动方向，上滑等词同时表示操作
+	"上滑": {action: "swipe", direction: "up"}, "下滑": {action: "swipe", direction: "down"},
+	"左滑": {action: "swipe", direction: "left"}, "右滑": {action: "swipe", direction: "right"},
+	"向上": {direction: "up"}, "往上": {direction: "up"}, "向下": {direction: "down"}, "往下": {direction: "down"},
+	"向左": {direction: "left"}, "往左": {direction: "left"}, "向右": {direction: "right"}, "往右": {direction: "right"},
+	"up": {direction: "up"}, "down": {direction: "down"}, "left": {direction: "left"}, "right": {direction: "right"},
+	// 目标
+	"按钮": {target: "button"}, "按键": {target: "button"},
+	"button": {target: "button"}, "btn": {target: "button"},
+	"输入框": {target: "input"}, "文本框": {target: "input"}, "编辑框": {target: "input"}, "搜索框": {target: "input"},
+	"input box": {target: "input"}, "input field": {target: "input"}, "text box": {target: "input"},
+	"text field": {target: "input"}, "textbox": {target: "input"}, "edittext": {target: "input"},
+	"图片": {target: "image"}, "图像": {target: "image"}, "图标": {target: "image"},
+	"image": {target: "image"}, "picture": {target: "image"}, "icon": {target: "image"},
+	"文字": {target: "text", module: "ppocr"}, "文本": {target: "text"}, "文案": {target: "text"},
+	"text": {target: "text"}, "label": {target: "text"},
+	"坐标": {target: "coordinate", module: "motion"}, "位置": {target: "coordinate", module: "motion"},
+	"coordinate": {target: "coordinate", module: "motion"}, "coordinates": {target: "coordinate", module: "motion"},
+	"position": {target: "coordinate", module: "motion"},
+	// 模块提示
+	"控件": {module: "uiacc"}, "ui": {module: "uiacc"}, "元素": {module: "uiacc"}, "element": {module: "uiacc"},
+	"识别": {module: "ppocr"}, "ocr": {module: "ppocr"},
+	// 时间单位
+	"毫秒": {unit: time.Millisecond}, "ms": {unit: time.Millisecond},
+	"millisecond": {unit: time.Millisecond}, "milliseconds": {unit: time.Millisecond},
+	"秒": {unit: time.Second}, "秒钟": {unit: time.Second}, "s": {unit: time.Second},
+	"sec": {unit: time.Second}, "secs": {unit: time.Second}, "second": {unit: time.Second}, "seconds": {unit: time.Second},
+	"分钟": {unit: time.Minute}, "分": {unit: time.Minute}, "min": {unit: time.Minute}, "mins": {unit: time.Minute},
+	"minute": {unit: time.Minute}, "minutes": {unit: time.Minute},
+	// 长按
+	"长按": {action: "long_click", module: "motion"}, "按住": {action: "long_click", module: "motion"},
+	"long press": {action: "long_click", module: "motion"}, "long click": {action: "long_click", module: "motion"},
+	"hold": {action: "long_click", module: "motion"},
+	// 系统按键
+	"返回": {action: "key", value: "back"}, "返回键": {action: "key", value: "back"}, "后退": {action: "key", value: "back"},
+	"back": {action: "key", value: "back"},
+	"主页键":  {action: "key", value: "home"}, "桌面": {action: "key", value: "home"}, "home": {action: "key", value: "home"},
+	"多任务": {action: "key", value: "recents"}, "最近任务": {action: "key", value: "recents"}, "任务键": {action: "key", value: "recents"},
+	"recents": {action: "key", value: "recents"}, "recent apps": {action: "key", value: "recents"},
+	// 滚动查找
+	"滚动": {action: "swipe"}, "翻页": {action: "swipe"},
+	// 应用管理
+	"强制停止": {action: "force_stop"}, "停止": {action: "force_stop"}, "杀死": {action: "force_stop"},
+	"force stop": {action: "force_stop"}, "stop": {action: "force_stop"}, "kill": {action: "force_stop"},
+	"清除数据": {action: "clear_data"}, "清空数据": {action: "clear_data"}, "清除应用数据": {action: "clear_data"},
+	"clear data": {action: "clear_data"},
+	"安装":         {action: "install"}, "install": {action: "install"},
+	"卸载": {action: "uninstall"}, "uninstall": {action: "uninstall"},
+	// 剪贴板
+	"剪贴板": {action: "clipboard"}, "剪切板": {action: "clipboard"}, "复制": {action: "clipboard"}, "拷贝": {action: "clipboard"},
+	"clipboard": {action: "clipboard"}, "copy": {action: "clipboard"},
+	// 颜色
+	"颜色": {target: "color"}, "色值": {target: "color"}, "color": {target: "color"}, "colour": {target: "color"},
+	// 音量
+	"音量": {action: "volume"}, "静音": {action: "volume", value: "0"},
+	"volume": {action: "volume"}, "mute": {action: "volume", value: "0"},
+	// 截图保存
+	"截图": {action: "screenshot"}, "截屏": {action: "screenshot"}, "screenshot": {action: "screenshot"},
+	// 否定
+	"不要": {negate: true}, "别": {negate: true}, "勿": {negate: true}, "不用": {negate: true},
+	"无需": {negate: true}, "不必": {negate: true}, "禁止": {negate: true},
+	"don't": {negate: true}, "dont": {negate: true}, "doesn't": {negate: true}, "not": {negate: true},
+	"never": {negate: true},
+	// 滑动坐标的起点和终点
+	"从": {role: "from"}, "自": {role: "from"}, "from": {role: "from"},
+	"到": {role: "to"}, "至": {role: "to"}, "to": {role: "to"},
+}
+
+// boundLexemes 容易出现在其他词中的短词，只在满足条件时作为词典中的词，
+// 避免误识别 分享、平等、滑块、停止播放、级别 等
+var boundLexemes = map[string]func(c hanContext) bool{
+	// 时间单位只跟在数字后
+	"分": func(c hanContext) bool { return c.afterNumber },
+	// 等待在步骤开头或后接数字，如 等5秒、等一分钟
+	"等": func(c hanContext) bool { return c.atStart || c.beforeNumber() },
+	// 单字的滑动后面是词典中的词或这段汉字的结尾，如 滑到、向上滑
+	"滑": func(c hanContext) bool { return c.atRunEnd() || c.beforeWord() },
+	"划": func(c hanContext) bool { return c.atRunEnd() || c.beforeWord() },
+	// 停止后面是包名或“应用”，如 停止com.example.app
+	"停止": func(c hanContext) bool { return c.atRunEnd() || strings.HasPrefix(string(c.rest), "应用") },
+	// 否定词“别”在一段汉字的开头，如 别点击
+	"别": func(c hanContext) bool { return c.atRunStart },
+}
+
+// hanContext 汉字词在步骤中的位置，用于判断boundLexemes中的词是否成立
+type hanContext struct {
+	afterNumber bool   // 紧跟在数字之后
+	atStart     bool   // 是步骤的第一个词
+	atRunStart  bool   // 在一段连续汉字的开头
+	rest        []rune // 同一段汉字中该词之后的部分
+	digitAfter  bool   // 这段汉字之后紧跟阿拉伯数字
+}
+
+func (c hanContext) atRunEnd() bool {
+	return len(c.rest) == 0
+}
+
+func (c hanContext) beforeNumber() bool {
+	if c.atRunEnd() {
+		return c.digitAfter
+	}
+	_, n := chineseNumber(c.rest)
+	return n > 0
+}
+
+func (c hanContext) beforeWord() bool {
+	lex, _ := longestMatch(c.rest)
+	return lex != nil
+}
+
+// modulePriority 多个词提示不同模块时的优先级
+var modulePriority = []string{"uiacc", "ppocr", "motion"}
+
+// maxHanKeyLen 词典中最长中文词的字数，用于最长匹配
+var maxHanKeyLen = func() int {
+	max := 0
+	for key := range intentLexicon {
+		if n := len([]rune(key)); n > max && isHan([]rune(key)[0]) {
+			max = n
+		}
+	}
+	return max
+}()
+
+// packagePattern 应用包名，如 com.example.app
+var packagePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*(\.[a-zA-Z][a-zA-Z0-9_]*)+$`)
+
+// imageExtensions 作为图片模板或截图识别的文件扩展名
+var imageExtensions = []string{".png", ".jpg", ".jpeg", ".bmp", ".webp"}
+
+// packageExtensions 安装包的文件扩展名
+var packageExtensions = []string{".apk"}
+
+// colorPattern 十六进制颜色，如 #FF0000
+var colorPattern = regexp.MustCompile(`^#?[0-9a-fA-F]{6}$`)
+
+// tokenKind 词法单元的类型
+type tokenKind int
+
+const (
+	tokWord    tokenKind = iota // 词，英文已转为小写
+	tokNumber                   // 数字，包括中文数字
+	tokQuoted                   // 引号中的文本
+	tokPackage                  // 应用包名
+	tokFile                     // 图片或安装包的文件路径
+	tokColor                    // 以#开头的十六进制颜色
+	tokPunct                    // 标点，全角已转为半角
+)
+
+// intentToken 词法单元
+type intentToken struct {
+	kind tokenKind
+	text string
+	num  float64
+	lex  *lexeme // 词典中的含义，未收录的词为nil
+}
+
+// ParseIntent 解析单个步骤描述中的操作意图。
+// 先切分为词法单元（中文按词典最长匹配，识别数字、各种引号中的文本、包名、文件路径和颜色），
+// 再按语法提取操作、目标、坐标、滑动起止点、时长、包名和文本。
+func ParseIntent(query string) Intent {
+	intent := Intent{Parameters: make(map[string]string)}
+	tokens := tokenize(query)
+
+	var points []Point
+	var roles []string
+	var files []string
+	var colors []string
+	var numbers []string
+	var modules []string
+	var hexTexts []string
+	colorWord := false
+	var label, fixedValue, negated string
+	actionAt, negateAt := -1, -1
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if p, n := parsePoint(tokens[i:]); n > 0 {
+			points = append(points, p)
+			roles = append(roles, pointRole(tokens[:i]))
+			i += n - 1
+			continue
+		}
+
+		switch t.kind {
+		case tokNumber:
+			// 数字后接时间单位为时长，连续的时长相加，如 1分30秒
+			if i+1 < len(tokens) && tokens[i+1].lex != nil && tokens[i+1].lex.unit != 0 {
+				intent.Duration += time.Duration(t.num * float64(tokens[i+1].lex.unit))
+				i++
+				continue
+			}
+			numbers = append(numbers, strconv.FormatFloat(t.num, 'f', -1, 64))
+		case tokQuoted:
+			intent.Texts = append(intent.Texts, t.text)
+			// 没有#的六位十六进制也可能是验证码等文本，只在提到颜色时才作为颜色
+			if colorPattern.MatchString(t.text) && strings.HasPrefix(t.text, "#") {
+				colors = append(colors, normalizeColor(t.text))
+			} else if colorPattern.MatchString(t.text) {
+				hexTexts = append(hexTexts, normalizeColor(t.text))
+			} else if hasFileExtension(t.text) {
+				files = append(files, t.text)
+			}
+		case tokPackage:
+			if intent.Package == "" {
+				intent.Package = t.text
+			}
+		case tokFile:
+			files = append(files, t.text)
+		case tokColor:
+			colors = append(colors, normalizeColor(t.text))
+		case tokWord:
+			lex := t.lex
+			if lex == nil {
+				continue
+			}
+			if lex.negate {
+				negateAt = i
+				continue
+			}
+			// 否定词后的操作不执行，如 不要点击确定、don't click 'OK'
+			if lex.action != "" && intent.Action == "" && negateAt >= 0 && negateAt == i-1 {
+				negated = lex.action
+				continue
+			}
+			// 第一个操作词为本步骤的操作，之后的同形词（如input）作为目标。
+			// 按键词优先于点击和打开，后出现的按键优先，如 点击返回键、打开最近任务、返回桌面
+			asAction := lex.action != "" && intent.Action == "" ||
+				lex.action == "key" && (intent.Action == "click" || intent.Action == "launch" || intent.Action == "key")
+			if asAction {
+				intent.Action = lex.action
+				actionAt = i
+				fixedValue = lex.value
+			}
+			if lex.target != "" && intent.Target == "" && !asAction {
+				intent.Target = lex.target
+				// 未加引号的按钮文字紧跟在操作词之后，如 点击登录按钮
+				if lex.target == "button" && i >= 2 && actionAt == i-2 && tokens[i-1].kind == tokWord {
+					if prev := tokens[i-1].lex; prev == nil || prev.target == "" && prev.unit == 0 {
+						label = tokens[i-1].text
+					}
+				}
+			}
+			if lex.target == "color" {
+				colorWord = true
+			}
+			if lex.direction != "" && intent.Direction == "" {
+				intent.Direction = lex.direction
+			}
+			if lex.module != "" {
+				modules = append(modules, lex.module)
+			}
+		}
+	}
+
+	if negated != "" && intent.Action == "" {
+		return Intent{Parameters: map[string]string{"negated": negated}, Texts: intent.Texts}
+	}
+
+	if intent.Package == "" {
+		for _, text := range intent.Texts {
+			if packagePattern.MatchString(text) {
+				intent.Package = text
+				break
+			}
+		}
+	}
+	if colorWord {
+		colors = append(colors, hexTexts...)
+	}
+	if len(colors) > 0 && intent.Target == "" {
+		intent.Target = "color"
+	}
+
+	switch {
+	case intent.Action == "swipe" && len(points) > 0:
+		assignSwipePoints(&intent, points, roles)
+	case intent.Target == "color":
+		// 坐标为取色位置
+		if len(points) > 0 {
+			intent.Point = &points[0]
+		}
+		if len(colors) > 0 {
+			intent.Value = colors[0]
+		}
+	case len(points) > 0:
+		intent.Point = &points[0]
+		intent.Target = "coordinate"
+		intent.Value = intent.Point.String()
+	case intent.Action == "install" || intent.Action == "screenshot":
+		// 文件路径是安装包或截图的保存位置，不是图片模板
+		if path := firstWithExtension(files, packageExtensions); path != "" && intent.Action == "install" {
+			intent.Value = path
+		} else if path := firstWithExtension(files, imageExtensions); path != "" && intent.Action == "screenshot" {
+			intent.Value = path
+		}
+	case firstWithExtension(files, imageExtensions) != "" && (intent.Target == "" || intent.Target == "image"):
+		intent.Target = "image"
+		intent.Value = firstWithExtension(files, imageExtensions)
+	}
+
+	if intent.Value == "" {
+		switch {
+		case intent.Action == "volume" && len(numbers) > 0:
+			intent.Value = numbers[0]
+		case fixedValue != "":
+			intent.Value = fixedValue
+		case packageActions[intent.Action] && intent.Package != "":
+			intent.Value = intent.Package
+		case intent.Action == "install" || intent.Action == "screenshot":
+			// 没有识别出路径时不使用普通文本
+		case len(intent.Texts) > 0:
+			intent.Value = intent.Texts[0]
+		case label != "":
+			intent.Value = label
+		}
+	}
+
+	// 给出目标文字的滑动为滚动查找，如 向下滚动直到出现"设置"
+	if intent.Action == "swipe" && len(points) == 0 && len(intent.Texts) > 0 {
+		intent.Action = "scroll_to"
+	}
+
+	// 只给出文本时的默认目标：点击、长按按文字查找按钮，验证按文字识别
+	if intent.Target == "" && intent.Value != "" {
+		switch intent.Action {
+		case "click", "long_click":
+			intent.Target = "button"
+		case "assert":
+			intent.Target = "text"
+		}
+	}
+
+	for _, module := range modulePriority {
+		if containsString(modules, module) {
+			intent.Module = module
+			break
+		}
+	}
+	return intent
+}
+
+// packageActions 以包名为值的操作
+var packageActions = map[string]bool{
+	"launch": true, "force_stop": true, "clear_data": true, "uninstall": true,
+}
+
+// assignSwipePoints 按“从/到”标记分配滑动起止点，未标记的坐标依次作为起点和终点
+func assignSwipePoints(intent *Intent, points []Point, roles []string) {
+	var rest []*Point
+	for i := range points {
+		switch roles[i] {
+		case "from":
+			if intent.From == nil {
+				intent.From = &points[i]
+				continue
+			}
+		case "to":
+			if intent.To == nil {
+				intent.To = &points[i]
+				continue
+			}
+		}
+		rest = append(rest, &points[i])
+	}
+	for _, p := range rest {
+		if intent.From == nil {
+			intent.From = p
+		} else if intent.To == nil {
+			intent.To = p
+		}
+	}
+}
+
+// parsePoint 从tokens开头解析坐标，返回坐标和消耗的词法单元数，不是坐标时返回0。
+// 语法: "(" 数字 [","] 数字 ")" | 数字 "," 数字
+func parsePoint(tokens []intentToken) (Point, int) {
+	isPunct := func(i int, text string) bool {
+		return i < len(tokens) && tokens[i].kind == tokPunct && tokens[i].text == text
+	}
+	isNumber := func(i int) bool {
+		return i < len(tokens) && tokens[i].kind == tokNumber
+	}
+	point := func(x, y int) Point {
+		return Point{X: int(tokens[x].num), Y: int(tokens[y].num)}
+	}
+
+	if isPunct(0, "(") && isNumber(1) {
+		if isPunct(2, ",") && isNumber(3) && isPunct(4, ")") {
+			return point(1, 3), 5
+		}
+		if isNumber(2) && isPunct(3, ")") {
+			return point(1, 2), 4
+		}
+		return Point{}, 0
+	}
+	if isNumber(0) && isPunct(1, ",") && isNumber(2) {
+		return point(0, 2), 3
+	}
+	return Point{}, 0
+}
+
+// pointRole 返回坐标前的“从/到”标记，中间可以隔着“坐标”等词
+func pointRole(before []intentToken) string {
+	for i := len(before) - 1; i >= 0; i-- {
+		lex := before[i].lex
+		if lex == nil {
+			return ""
+		}
+		if lex.role != "" {
+			return lex.role
+		}
+		if lex.target != "coordinate" {
+			return ""
+		}
+	}
+	return ""
+}
+
+// tokenize 将步骤描述切分为词法单元
+func tokenize(query string) []intentToken {
+	var tokens []intentToken
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '#' && i+7 <= len(runes) && colorPattern.MatchString(string(runes[i:i+7])) &&
+			(i+7 == len(runes) || !isWordRune(runes[i+7])):
+			tokens = append(tokens, intentToken{kind: tokColor, text: string(runes[i : i+7])})
+			i += 7
+		case isQuoteOpen(runes, i):
+			end := quoteEnd(runes, i)
+			if end < 0 {
+				i++
+				continue
+			}
+			tokens = append(tokens, intentToken{kind: tokQuoted, text: string(runes[i+1 : end])})
+			i = end + 1
+		case r >= '0' && r <= '9':
+			end := i
+			for end < len(runes) && (runes[end] >= '0' && runes[end] <= '9' ||
+				runes[end] == '.' && end+1 < len(runes) && runes[end+1] >= '0' && runes[end+1] <= '9') {
+				end++
+			}
+			num, _ := strconv.ParseFloat(string(runes[i:end]), 64)
+			tokens = append(tokens, intentToken{kind: tokNumber, text: string(runes[i:end]), num: num})
+			i = end
+		case isWordStart(runes, i):
+			end := i
+			for end < len(runes) && isWordRune(runes[end]) {
+				end++
+			}
+			word := strings.TrimRight(string(runes[i:end]), ".-/")
+			next := i + len([]rune(word))
+			// 否定缩写，如 don't
+			if next == end && next+1 < len(runes) && runes[next] == '\'' && runes[next+1] == 't' &&
+				(next+2 == len(runes) || !isWordRune(runes[next+2])) {
+				word += "'t"
+			}
+			tokens = append(tokens, wordToken(word))
+			i += len([]rune(word))
+		case isHan(r):
+			end := i
+			for end < len(runes) && isHan(runes[end]) {
+				end++
+			}
+			tokens = append(tokens, segmentHan(runes[i:end], hanContext{
+				afterNumber: len(tokens) > 0 && tokens[len(tokens)-1].kind == tokNumber,
+				atStart:     len(tokens) == 0,
+				digitAfter:  end < len(runes) && runes[end] >= '0' && runes[end] <= '9',
+			})...)
+			i = end
+		default:
+			tokens = append(tokens, intentToken{kind: tokPunct, text: normalizePunct(r)})
+			i++
+		}
+	}
+	return mergePhrases(tokens)
+}
+
+// wordToken 将英文单词、包名或路径转换为词法单元
+func wordToken(word string) intentToken {
+	switch {
+	case hasFileExtension(word):
+		return intentToken{kind: tokFile, text: word}
+	case packagePattern.MatchString(word):
+		return intentToken{kind: tokPackage, text: word}
+	}
+	word = strings.ToLower(word)
+	t := intentToken{kind: tokWord, text: word}
+	if lex, ok := intentLexicon[word]; ok {
+		t.lex = &lex
+	}
+	return t
+}
+
+// mergePhrases 合并词典中的英文词组，如 input box、text field
+func mergePhrases(tokens []intentToken) []intentToken {
+	merged := tokens[:0]
+	for i := 0; i < len(tokens); i++ {
+		if tokens[i].kind == tokWord && i+1 < len(tokens) && tokens[i+1].kind == tokWord {
+			phrase := tokens[i].text + " " + tokens[i+1].text
+			if lex, ok := intentLexicon[phrase]; ok {
+				merged = append(merged, intentToken{kind: tokWord, text: phrase, lex: &lex})
+				i++
+				continue
+			}
+		}
+		merged = append(merged, tokens[i])
+	}
+	return merged
+}
+
+// segmentHan 按词典最长匹配切分一段连续的汉字。中文数字后接时间单位时作为数字，
+// 未收录的字和不满足条件的boundLexemes合并为一个词。at为这段汉字在步骤中的位置
+func segmentHan(run []rune, at hanContext) []intentToken {
+	var tokens []intentToken
+	var unknown []rune
+	flush := func() {
+		if len(unknown) > 0 {
+			tokens = append(tokens, intentToken{kind: tokWord, text: string(unknown)})
+			unknown = nil
+		}
+	}
+
+	for i := 0; i < len(run); {
+		if num, n := chineseNumber(run[i:]); n > 0 {
+			if lex, _ := longestMatch(run[i+n:]); lex != nil && lex.unit != 0 {
+				flush()
+				tokens = append(tokens, intentToken{kind: tokNumber, text: string(run[i : i+n]), num: num})
+				i += n
+				continue
+			}
+		}
+		if lex, n := longestMatch(run[i:]); lex != nil && boundAt(run, i, n, at, tokens, unknown) {
+			flush()
+			tokens = append(tokens, intentToken{kind: tokWord, text: string(run[i : i+n]), lex: lex})
+			i += n
+			continue
+		}
+		unknown = append(unknown, run[i])
+		i++
+	}
+	flush()
+	return tokens
+}
+
+// boundAt 判断run[i:i+n]处的词是否成立，不在boundLexemes中的词总是成立
+func boundAt(run []rune, i, n int, at hanContext, tokens []intentToken, unknown []rune) bool {
+	cond, ok := boundLexemes[string(run[i:i+n])]
+	if !ok {
+		return true
+	}
+	c := at
+	c.rest = run[i+n:]
+	c.atRunStart = i == 0
+	if i > 0 {
+		c.atStart = false
+		c.afterNumber = len(unknown) == 0 && len(tokens) > 0 && tokens[len(tokens)-1].kind == tokNumber
+	}
+	return cond(c)
+}
+
+// longestMatch 返回run开头在词典中最长的词
+func longestMatch(run []rune) (*lexeme, int) {
+	for n := min(maxHanKeyLen, len(run)); n > 0; n-- {
+		if lex, ok := intentLexicon[string(run[:n])]; ok {
+			return &lex, n
+		}
+	}
+	return nil, 0
+}
+
+// chineseDigits 中文数字
+var chineseDigits = map[rune]int{
+	'零': 0, '一': 1, '二': 2, '两': 2, '三': 3, '四': 4, '五': 5, '六': 6, '七': 7, '八': 8, '九': 9,
+}
+
+// chineseNumber 解析run开头的中文数字（支持到百位），返回数值和字数，不是数字时返回0
+func chineseNumber(run []rune) (float64, int) {
+	total, current, i := 0, 0, 0
+loop:
+	for ; i < len(run); i++ {
+		if d, ok := chineseDigits[run[i]]; ok {
+			current = d
+			continue
+		}
+		switch run[i] {
+		case '十':
+			if current == 0 {
+				current = 1
+			}
+			total += current * 10
+			current = 0
+		case '百':
+			if current == 0 {
+				current = 1
+			}
+			total += current * 100
+			current = 0
+		default:
+			break loop
+		}
+	}
+	return float64(total + current), i
+}
+
+// isQuoteOpen 判断位置i是否为引号的开始。夹在两个拉丁字母之间的英文单引号为撇号（如 don't）
+func isQuoteOpen(runes []rune, i int) bool {
+	r := runes[i]
+	if r == '(' || r == '（' {
+		return false
+	}
+	if _, ok := quotePairs[r]; !ok {
+		return false
+	}
+	return r != '\'' || !isApostrophe(runeAt(runes, i-1), runeAt(runes, i+1))
+}
+
+// quoteEnd 返回与位置i的引号配对的结束引号位置，没有时返回-1。
+// 夹在两个拉丁字母之间的英文单引号为撇号，如 'it's me'
+func quoteEnd(runes []rune, i int) int {
+	closing := quotePairs[runes[i]]
+	for j := i + 1; j < len(runes); j++ {
+		if runes[j] == closing && (closing != '\'' || !isApostrophe(runes[j-1], runeAt(runes, j+1))) {
+			return j
+		}
+	}
+	return -1
+}
+
+// runeAt 返回位置i的字符，越界时返回0
+func runeAt(runes []rune, i int) rune {
+	if i < 0 || i >= len(runes) {
+		return 0
+	}
+	return runes[i]
+}
+
+// isWordStart 英文单词、包名或路径的开始：字母、下划线，或后接字母的斜杠
+func isWordStart(runes []rune, i int) bool {
+	r := runes[i]
+	if r == '/' {
+		return i+1 < len(runes) && isWordRune(runes[i+1]) && runes[i+1] != '/'
+	}
+	return r < utf8.RuneSelf && (unicode.IsLetter(r) || r == '_')
+}
+
+func isWordRune(r rune) bool {
+	return r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_.-/", r))
+}
+
+func isHan(r rune) bool {
+	return unicode.Is(unicode.Han, r)
+}
+
+// normalizePunct 将全角标点转换为半角
+func normalizePunct(r rune) string {
+	switch r {
+	case '（':
+		return "("
+	case '）':
+		return ")"
+	case '，', '、':
+		return ","
+	case '：':
+		return ":"
+	}
+	return string(r)
+}
+
+// hasFileExtension 判断路径是否为图片或安装包
+func hasFileExtension(path string) bool {
+	return hasExtension(path, imageExtensions) || hasExtension(path, packageExtensions)
+}
+
+func hasExtension(path string, extensions []string) bool {
+	lower := strings.ToLower(path)
+	for _, ext := range extensions {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// firstWithExtension 返回第一个指定扩展名的路径
+func firstWithExtension(paths []string, extensions []string) string {
+	for _, path := range paths {
+		if hasExtension(path, extensions) {
+			return path
+		}
+	}
+	return ""
+}
+
+// normalizeColor 将颜色转换为images包使用的大写十六进制格式，如 FF0000
+func normalizeColor(color string) string {
+	return strings.ToUpper(strings.TrimPrefix(color, "#"))
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,163 @@
+package agent
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseIntent(t *testing.T) {
+	pt := func(x, y int) *Point { return &Point{X: x, Y: y} }
+	cases := []struct {
+		query string
+		want  Intent
+	}{
+		// 坐标
+		{"在坐标(100, 200)点击", Intent{Action: "click", Target: "coordinate", Value: "(100, 200)", Module: "motion", Point: pt(100, 200)}},
+		{"点击（540，960）", Intent{Action: "click", Target: "coordinate", Value: "(540, 960)", Module: "motion", Point: pt(540, 960)}},
+		{"点击100, 200", Intent{Action: "click", Target: "coordinate", Value: "(100, 200)", Module: "motion", Point: pt(100, 200)}},
+		{"tap at (12 34)", Intent{Action: "click", Target: "coordinate", Value: "(12, 34)", Module: "motion", Point: pt(12, 34)}},
+
+		// 各种引号中的文本
+		{"点击\"登录\"按钮", Intent{Action: "click", Target: "button", Value: "登录", Module: "motion", Texts: []string{"登录"}}},
+		{"点击“确定”按钮", Intent{Action: "click", Target: "button", Value: "确定", Module: "motion", Texts: []string{"确定"}}},
+		{"点击「设置」", Intent{Action: "click", Target: "button", Value: "设置", Module: "motion", Texts: []string{"设置"}}},
+		{"click the 'Sign in' button", Intent{Action: "click", Target: "button", Value: "Sign in", Module: "motion", Texts: []string{"Sign in"}}},
+		{"点击登录按钮", Intent{Action: "click", Target: "button", Value: "登录", Module: "motion"}},
+		{"tap 'it's me'", Intent{Action: "click", Target: "button", Value: "it's me", Module: "motion", Texts: []string{"it's me"}}},
+		{"长按'消息'3秒", Intent{Action: "long_click", Target: "button", Value: "消息", Module: "motion", Duration: 3 * time.Second, Texts: []string{"消息"}}},
+		{"点击'OK'2次", Intent{Action: "click", Target: "button", Value: "OK", Module: "motion", Texts: []string{"OK"}}},
+
+		// 输入
+		{"输入'admin'", Intent{Action: "input", Value: "admin", Texts: []string{"admin"}}},
+		{"在输入框中输入‘hello world’", Intent{Action: "input", Target: "input", Value: "hello world", Texts: []string{"hello world"}}},
+		{"input \"abc\" into the text field", Intent{Action: "input", Target: "input", Value: "abc", Texts: []string{"abc"}}},
+		{"点击输入框", Intent{Action: "click", Target: "input", Module: "motion"}},
+
+		// 时长
+		{"等待5秒", Intent{Action: "wait", Duration: 5 * time.Second}},
+		{"等待1.5秒", Intent{Action: "wait", Duration: 1500 * time.Millisecond}},
+		{"等待五秒", Intent{Action: "wait", Duration: 5 * time.Second}},
+		{"等待二十五秒钟", Intent{Action: "wait", Duration: 25 * time.Second}},
+		{"等1分30秒", Intent{Action: "wait", Duration: 90 * time.Second}},
+		{"wait 500ms", Intent{Action: "wait", Duration: 500 * time.Millisecond}},
+		{"sleep 2 seconds", Intent{Action: "wait", Duration: 2 * time.Second}},
+		{"等待『主页』出现10秒", Intent{Action: "wait", Value: "主页", Duration: 10 * time.Second, Texts: []string{"主页"}}},
+
+		// 包名
+		{"启动com.example.app", Intent{Action: "launch", Value: "com.example.app", Package: "com.example.app"}},
+		{"打开应用 com.android.settings", Intent{Action: "launch", Value: "com.android.settings", Package: "com.android.settings"}},
+		{"启动应用\"com.example.app\"", Intent{Action: "launch", Value: "com.example.app", Package: "com.example.app", Texts: []string{"com.example.app"}}},
+		{"launch com.tencent.mm then", Intent{Action: "launch", Value: "com.tencent.mm", Package: "com.tencent.mm"}},
+
+		// 断言和图片
+		{"验证页面出现'主页'", Intent{Action: "assert", Target: "text", Value: "主页", Texts: []string{"主页"}}},
+		{"检查“欢迎”文字", Intent{Action: "assert", Target: "text", Value: "欢迎", Module: "ppocr", Texts: []string{"欢迎"}}},
+		{"验证图片'/sdcard/logo.png'存在", Intent{Action: "assert", Target: "image", Value: "/sdcard/logo.png", Texts: []string{"/sdcard/logo.png"}}},
+		{"click icon.png", Intent{Action: "click", Target: "image", Value: "icon.png", Module: "motion"}},
+
+		// 滑动
+		{"从(100,800)滑动到(100,200)", Intent{Action: "swipe", From: pt(100, 800), To: pt(100, 200)}},
+		{"滑动到(100,200)从(100,800)", Intent{Action: "swipe", From: pt(100, 800), To: pt(100, 200)}},
+		{"swipe from 10,20 to 30,40 in 300ms", Intent{Action: "swipe", From: pt(10, 20), To: pt(30, 40), Duration: 300 * time.Millisecond}},
+		{"向上滑动", Intent{Action: "swipe", Direction: "up"}},
+		{"左滑两秒", Intent{Action: "swipe", Direction: "left", Duration: 2 * time.Second}},
+		{"scroll down", Intent{Action: "swipe", Direction: "down"}},
+
+		// 模块提示
+		{"通过控件点击'确定'", Intent{Action: "click", Target: "button", Value: "确定", Module: "uiacc", Texts: []string{"确定"}}},
+		{"识别屏幕文字", Intent{Target: "text", Module: "ppocr"}},
+
+		// 长按
+		{"长按(300, 400)两秒", Intent{Action: "long_click", Target: "coordinate", Value: "(300, 400)", Module: "motion", Point: pt(300, 400), Duration: 2 * time.Second}},
+		{"long press 'Photo'", Intent{Action: "long_click", Target: "button", Value: "Photo", Module: "motion", Texts: []string{"Photo"}}},
+
+		// 系统按键
+		{"按返回键", Intent{Action: "key", Value: "back"}},
+		{"点击返回键", Intent{Action: "key", Value: "back", Module: "motion"}},
+		{"返回桌面", Intent{Action: "key", Value: "home"}},
+		{"press home", Intent{Action: "key", Value: "home", Module: "motion"}},
+		{"打开最近任务", Intent{Action: "key", Value: "recents"}},
+		{"点击多任务键", Intent{Action: "key", Value: "recents", Module: "motion"}},
+
+		// 滚动查找
+		{"向下滚动直到出现“关于手机”", Intent{Action: "scroll_to", Value: "关于手机", Direction: "down", Texts: []string{"关于手机"}}},
+		{"scroll to 'Settings'", Intent{Action: "scroll_to", Value: "Settings", Texts: []string{"Settings"}}},
+
+		// 应用管理
+		{"强制停止com.example.app", Intent{Action: "force_stop", Value: "com.example.app", Package: "com.example.app"}},
+		{"清除数据 com.example.app", Intent{Action: "clear_data", Value: "com.example.app", Package: "com.example.app"}},
+		{"安装'/sdcard/demo.apk'", Intent{Action: "install", Value: "/sdcard/demo.apk", Texts: []string{"/sdcard/demo.apk"}}},
+		{"install /data/local/tmp/app.apk", Intent{Action: "install", Value: "/data/local/tmp/app.apk"}},
+		{"卸载com.example.app", Intent{Action: "uninstall", Value: "com.example.app", Package: "com.example.app"}},
+
+		// 剪贴板、颜色、音量和截图
+		{"复制'验证码123'到剪贴板", Intent{Action: "clipboard", Value: "验证码123", Texts: []string{"验证码123"}}},
+		{"验证(100,200)的颜色为#ff0000", Intent{Action: "assert", Target: "color", Value: "FF0000", Point: pt(100, 200)}},
+		{"检查屏幕上有颜色\"00FF00\"", Intent{Action: "assert", Target: "color", Value: "00FF00", Texts: []string{"00FF00"}}},
+		{"检查屏幕上有\"#00ff00\"", Intent{Action: "assert", Target: "color", Value: "00FF00", Texts: []string{"#00ff00"}}},
+		// 没有#也没有提到颜色的六位数字或十六进制是普通文本，如验证码
+		{"验证页面出现'123456'", Intent{Action: "assert", Target: "text", Value: "123456", Texts: []string{"123456"}}},
+		{"点击颜色#1E90FF", Intent{Action: "click", Target: "color", Value: "1E90FF", Module: "motion"}},
+		{"把音量设为8", Intent{Action: "volume", Value: "8"}},
+		{"静音", Intent{Action: "volume", Value: "0"}},
+		{"截图保存到/sdcard/home.png", Intent{Action: "screenshot", Value: "/sdcard/home.png"}},
+		{"截屏", Intent{Action: "screenshot"}},
+
+		// 否定的操作不执行
+		{"don't click 'OK'", Intent{Texts: []string{"OK"}}},
+		{"do not tap 'Delete'", Intent{Texts: []string{"Delete"}}},
+		{"不要点击确定按钮", Intent{}},
+		{"请勿点击“广告”", Intent{Texts: []string{"广告"}}},
+		{"别滑动", Intent{}},
+
+		// 出现在其他词中的短词
+		{"点击分享按钮", Intent{Action: "click", Target: "button", Value: "分享", Module: "motion"}},
+		{"点击平等按钮", Intent{Action: "click", Target: "button", Value: "平等", Module: "motion"}},
+		{"点击滑块按钮", Intent{Action: "click", Target: "button", Value: "滑块", Module: "motion"}},
+		{"点击停止播放按钮", Intent{Action: "click", Target: "button", Value: "停止播放", Module: "motion"}},
+		{"停止播放", Intent{}},
+		{"停止com.example.app", Intent{Action: "force_stop", Value: "com.example.app", Package: "com.example.app"}},
+		{"等一下", Intent{Action: "wait"}},
+		{"从(100,800)滑到(100,200)", Intent{Action: "swipe", From: pt(100, 800), To: pt(100, 200)}},
+
+		// 无法识别
+		{"随便看看", Intent{}},
+	}
+
+	for _, tc := range cases {
+		got := ParseIntent(tc.query)
+		got.Parameters = nil
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ParseIntent(%q)\n got  %+v\n want %+v", tc.query, got, tc.want)
+		}
+	}
+}
+
+func TestChineseNumber(t *testing.T) {
+	cases := map[string]float64{"五": 5, "十": 10, "十五": 15, "二十": 20, "两百零五": 205, "三百五十": 350}
+	for text, want := range cases {
+		got, n := chineseNumber([]rune(text + "秒"))
+		if got != want || n != len([]rune(text)) {
+			t.Errorf("chineseNumber(%q) = %v, %d, want %v", text, got, n, want)
+		}
+	}
+	if _, n := chineseNumber([]rune("秒")); n != 0 {
+		t.Errorf("chineseNumber without digits consumed %d runes", n)
+	}
+}
+
+func TestGenerateSwipeCode(t *testing.T) {
+	cg := NewCodeGenerator(nil)
+	plan := cg.Plan("从(100,800)滑动到(100,200)用时300毫秒，然后向上滑动")
+	code := cg.generateCode(plan, "")
+	for _, want := range []string{"motion.Swipe(100, 800, 100, 200, 300)", "w, h := device.Width, device.Height", "motion.Swipe(w/2, h*3/4, w/2, h/4, 500)"} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated code missing %q:\n%s", want, code)
+		}
+	}
+	if modules := cg.getRequiredModules(plan); !reflect.DeepEqual(modules, []string{"device", "motion", "steps"}) {
+		t.Errorf("modules = %v", modules)
+	}
+}
@@ -1,6 +1,7 @@
 package agent
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -35,6 +36,11 @@ type Embedder interface {
 	Embed(text string) ([]float32, error)
 }
 
+// ContextEmbedder 支持取消的向量化接口，Embedder实现该接口时优先使用
+type ContextEmbedder interface {
+	EmbedContext(ctx context.Context, text string) ([]float32, error)
+}
+
 // NewKnowledgeBase 创建知识库
 func NewKnowledgeBase(dbPath string) (*KnowledgeBase, error) {
 	db, err := sql.Open("sqlite3", dbPath + "?_journal_mode=WAL&_busy_timeout=5000")
@@ -64,6 +70,7 @@ func (kb *KnowledgeBase) initDB() error {
 		example TEXT,
 		keywords TEXT,
 		embedding TEXT,
+		builtin INTEGER NOT NULL DEFAULT 0,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
 
@@ -72,10 +79,50 @@ func (kb *KnowledgeBase) initDB() error {
 	CREATE INDEX IF NOT EXISTS idx_keywords ON api_docs(keywords);
 	`
 
-	_, err := kb.db.Exec(createTableSQL)
+	if _, err := kb.db.Exec(createTableSQL); err != nil {
+		return err
+	}
+	return kb.migrate()
+}
+
+// migrate 为旧版本创建的知识库补充builtin列
+func (kb *KnowledgeBase) migrate() error {
+	rows, err := kb.db.Query(`PRAGMA table_info(api_docs)`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, typ string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return err
+		}
+		if name == "builtin" {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_, err = kb.db.Exec(`ALTER TABLE api_docs ADD COLUMN builtin INTEGER NOT NULL DEFAULT 0`)
 	return err
 }
 
+// EnsureDefaults 知识库中的默认条目版本低于defaultKnowledgeVersion时重新写入默认条目，
+// 用户添加的条目保持不变
+func (kb *KnowledgeBase) EnsureDefaults() error {
+	var version int
+	if err := kb.db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	if version >= defaultKnowledgeVersion {
+		return nil
+	}
+	return BuildDefaultKnowledgeBase(kb)
+}
+
 // AddAPI 添加API文档
 func (kb *KnowledgeBase) AddAPI(doc APIDoc) error {
 	insertSQL := `
@@ -173,30 +220,42 @@ func (kb *KnowledgeBase) SetEmbedder(embedder Embedder) {
 
 // EnsureEmbeddings 为知识库生成Embedding
 func (kb *KnowledgeBase) EnsureEmbeddings() error {
+	return kb.EnsureEmbeddingsContext(context.Background())
+}
+
+// EnsureEmbeddingsContext 为知识库生成Embedding，ctx取消时停止
+func (kb *KnowledgeBase) EnsureEmbeddingsContext(ctx context.Context) error {
 	if kb.embedder == nil {
 		return fmt.Errorf("embedder 未配置，无法生成向量")
 	}
 
-	rows, err := kb.db.Query(`SELECT id, description, signature, example FROM api_docs WHERE embedding IS NULL OR embedding = ''`)
+	rows, err := kb.db.QueryContext(ctx, `SELECT id, description, signature, example FROM api_docs WHERE embedding IS NULL OR embedding = ''`)
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
 
+	type pending struct {
+		id   int
+		text string
+	}
+	var todo []pending
 	for rows.Next() {
 		var id int
 		var desc, sig, example string
 		if err := rows.Scan(&id, &desc, &sig, &example); err != nil {
 			continue
 		}
+		todo = append(todo, pending{id: id, text: strings.Join([]string{desc, sig, example}, "\n")})
+	}
+	rows.Close()
 
-		text := strings.Join([]string{desc, sig, example}, "\n")
-		vector, err := kb.embedder.Embed(text)
+	for _, item := range todo {
+		vector, err := kb.embed(ctx, item.text)
 		if err != nil {
 			return err
 		}
 
-		if err := kb.saveEmbedding(id, vector); err != nil {
+		if err := kb.saveEmbedding(item.id, vector); err != nil {
 			return err
 		}
 	}
@@ -204,6 +263,17 @@ func (kb *KnowledgeBase) EnsureEmbeddings() error {
 	return nil
 }
 
+// embed 调用Embedding模型，支持取消时传入ctx
+func (kb *KnowledgeBase) embed(ctx context.Context, text string) ([]float32, error) {
+	if e, ok := kb.embedder.(ContextEmbedder); ok {
+		return e.EmbedContext(ctx, text)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return kb.embedder.Embed(text)
+}
+
 func (kb *KnowledgeBase) saveEmbedding(id int, embedding []float32) error {
 	data, err := json.Marshal(embedding)
 	if err != nil {
@@ -267,7 +337,14 @@ func cosineSimilarity(a, b []float32) float64 {
 	return dot / denominator
 }
 
-// BuildDefaultKnowledgeBase 构建默认知识库
+// defaultKnowledgeVersion 默认条目的版本，保存在知识库的 user_version 中。
+// 修改BuildDefaultKnowledgeBase中的条目后需要递增，已有的知识库在下次启动时更新
+const defaultKnowledgeVersion = 1
+
+// removedDefaultModules 旧版本默认条目中已移除的模块，升级旧知识库时删除
+var removedDefaultModules = []string{"opencv"}
+
+// BuildDefaultKnowledgeBase 构建默认知识库，已有的默认条目被替换为当前版本
 func BuildDefaultKnowledgeBase(kb *KnowledgeBase) error {
 	fmt.Println("🔧 开始构建默认知识库...")
 	apis := []APIDoc{
@@ -322,6 +399,16 @@ func BuildDefaultKnowledgeBase(kb *KnowledgeBase) error {
 			Example:     "motion.Home()",
 			Keywords:    "主页 home 首页",
 		},
+		{
+			Module:      "motion",
+			Function:    "Recents",
+			Description: "点击多任务键（最近任务）",
+			Signature:   "func Recents()",
+			Parameters:  "无",
+			Return:      "无",
+			Example:     "motion.Recents()",
+			Keywords:    "多任务 最近任务 任务键 recents 切换应用",
+		},
 
 		// UIACC API
 		{
@@ -384,17 +471,35 @@ func BuildDefaultKnowledgeBase(kb *KnowledgeBase) error {
 			Example:     "uiacc.New().Editable(true).FindOnce().SetText(\"Hello\")",
 			Keywords:    "输入 input 文本 text 设置",
 		},
-
-		// OpenCV API
 		{
-			Module:      "opencv",
-			Function:    "FindImage",
-			Description: "在屏幕中查找匹配的图片模板",
-			Signature:   "func FindImage(x1, y1, x2, y2 int, template *[]byte, isGray bool, scalingFactor, sim float32) (int, int)",
-			Parameters:  "x1,y1: 搜索区域左上角, x2,y2: 搜索区域右下角, template: 模板图片字节, isGray: 是否灰度, scalingFactor: 缩放因子, sim: 相似度",
-			Return:      "(int, int): 找到的坐标，未找到返回(-1, -1)",
-			Example:     "x, y := opencv.FindImage(0, 0, 0, 0, &templateBytes, false, 1.0, 0.8)",
-			Keywords:    "图像 图片 模板 匹配 find image template",
+			Module:      "uiacc",
+			Function:    "Scrollable",
+			Description: "按是否可滚动查找控件，常用于定位列表",
+			Signature:   "func (a *Uiacc) Scrollable(value bool) *Uiacc",
+			Parameters:  "value: 是否可滚动",
+			Return:      "*Uiacc: 链式调用返回选择器",
+			Example:     "list := uiacc.New().Scrollable(true).FindOnce()",
+			Keywords:    "滚动 列表 scrollable list",
+		},
+		{
+			Module:      "uiacc",
+			Function:    "ScrollForward",
+			Description: "对控件执行向前滚动，配合查找实现滚动直到目标出现",
+			Signature:   "func (u *UiObject) ScrollForward() bool",
+			Parameters:  "无",
+			Return:      "bool: 是否滚动成功，滚动到底时返回false",
+			Example:     "for i := 0; i < 10; i++ {\n\tif uiacc.New().Text(\"设置\").FindOnce() != nil {\n\t\tbreak\n\t}\n\tlist := uiacc.New().Scrollable(true).FindOnce()\n\tif list == nil || !list.ScrollForward() {\n\t\tbreak\n\t}\n}",
+			Keywords:    "滚动 滚动查找 下滑 翻页 scroll forward 直到",
+		},
+		{
+			Module:      "uiacc",
+			Function:    "GetBounds",
+			Description: "获取控件的屏幕边界和中心坐标",
+			Signature:   "func (u *UiObject) GetBounds() Rect",
+			Parameters:  "无",
+			Return:      "Rect: 包含Left、Top、Right、Bottom、CenterX、CenterY",
+			Example:     "bounds := obj.GetBounds()\nmotion.LongClick(bounds.CenterX, bounds.CenterY, 1000)",
+			Keywords:    "边界 坐标 中心 bounds 位置",
 		},
 
 		// PPOCR API
@@ -430,6 +535,26 @@ func BuildDefaultKnowledgeBase(kb *KnowledgeBase) error {
 			Example:     "img := images.CaptureScreen(0, 0, 0, 0)",
 			Keywords:    "截图 屏幕 capture screen",
 		},
+		{
+			Module:      "images",
+			Function:    "FindColor",
+			Description: "在屏幕区域内查找颜色，返回第一个匹配点的坐标",
+			Signature:   "func FindColor(x1, y1, x2, y2 int, colorStr string, sim float32, dir int) (int, int)",
+			Parameters:  "x1,y1,x2,y2: 查找区域，全0表示全屏, colorStr: 十六进制颜色如FF0000，可用|分隔多个颜色, sim: 相似度, dir: 查找方向",
+			Return:      "(int, int): 找到的坐标，未找到返回(-1, -1)",
+			Example:     "x, y := images.FindColor(0, 0, 0, 0, \"FF0000\", 0.9, 0)",
+			Keywords:    "颜色 找色 取色 色值 color find",
+		},
+		{
+			Module:      "images",
+			Function:    "Save",
+			Description: "将图像保存为文件，格式由扩展名决定",
+			Signature:   "func Save(img *image.NRGBA, path string, quality int) bool",
+			Parameters:  "img: 图像对象, path: 保存路径, quality: jpg质量(1-100)",
+			Return:      "bool: 是否保存成功",
+			Example:     "img := images.CaptureScreen(0, 0, 0, 0)\nimages.Save(img, \"/sdcard/shot.png\", 100)",
+			Keywords:    "截图 保存 截屏 screenshot save",
+		},
 
 		// App API
 		{
@@ -460,7 +585,37 @@ func BuildDefaultKnowledgeBase(kb *KnowledgeBase) error {
 			Parameters:  "packageName: 应用包名",
 			Return:      "无",
 			Example:     "app.ForceStop(\"com.example.app\")",
-			Keywords:    "停止 stop 关闭",
+			Keywords:    "停止 强制停止 stop 关闭 kill",
+		},
+		{
+			Module:      "app",
+			Function:    "Clear",
+			Description: "清除应用数据",
+			Signature:   "func Clear(packageName string)",
+			Parameters:  "packageName: 应用包名",
+			Return:      "无",
+			Example:     "app.Clear(\"com.example.app\")",
+			Keywords:    "清除数据 清空数据 重置 clear data",
+		},
+		{
+			Module:      "app",
+			Function:    "Install",
+			Description: "安装设备上的apk文件",
+			Signature:   "func Install(path string)",
+			Parameters:  "path: 设备上apk文件路径",
+			Return:      "无",
+			Example:     "app.Install(\"/sdcard/app.apk\")",
+			Keywords:    "安装 install apk",
+		},
+		{
+			Module:      "app",
+			Function:    "Uninstall",
+			Description: "卸载应用",
+			Signature:   "func Uninstall(packageName string)",
+			Parameters:  "packageName: 应用包名",
+			Return:      "无",
+			Example:     "app.Uninstall(\"com.example.app\")\nif !app.IsUninstalled(\"com.example.app\") {\n\treturn fmt.Errorf(\"卸载失败\")\n}",
+			Keywords:    "卸载 删除应用 uninstall",
 		},
 
 		// IME API
@@ -485,6 +640,18 @@ func BuildDefaultKnowledgeBase(kb *KnowledgeBase) error {
 			Keywords:    "剪切板 clipboard",
 		},
 
+		// Device API
+		{
+			Module:      "device",
+			Function:    "SetMusicVolume",
+			Description: "设置媒体音量",
+			Signature:   "func SetMusicVolume(volume int)",
+			Parameters:  "volume: 音量值",
+			Return:      "无",
+			Example:     "device.SetMusicVolume(5)",
+			Keywords:    "音量 媒体音量 静音 volume mute",
+		},
+
 		// Utils API
 		{
 			Module:      "utils",
@@ -496,35 +663,124 @@ func BuildDefaultKnowledgeBase(kb *KnowledgeBase) error {
 			Example:     "utils.Sleep(1000)",
 			Keywords:    "等待 sleep 延时 delay",
 		},
+		// Steps API（生成脚本上报步骤结果）
+		{
+			Module:      "steps",
+			Function:    "RunAll",
+			Description: "按顺序执行测试步骤并上报每个步骤的结构化结果，遇到第一个失败的步骤时停止",
+			Signature:   "func RunAll(list []Step) error",
+			Parameters:  "list: 步骤列表，每个步骤包含Name和Run func() error",
+			Return:      "第一个失败步骤的错误，全部通过时为nil",
+			Example:     "err := steps.RunAll([]steps.Step{{Name: \"启动应用\", Run: step1}})\nif err != nil {\n\tos.Exit(1)\n}",
+			Keywords:    "步骤 step 执行 结果 上报 测试流程",
+		},
+		{
+			Module:      "steps",
+			Function:    "Run",
+			Description: "执行单个测试步骤并上报开始、结束事件和耗时",
+			Signature:   "func Run(name string, fn func() error) error",
+			Parameters:  "name: 步骤名称, fn: 步骤内容",
+			Return:      "fn返回的错误",
+			Example:     "err := steps.Run(\"点击登录\", func() error {\n\tmotion.Click(100, 200, 1)\n\treturn nil\n})",
+			Keywords:    "步骤 step 执行",
+		},
+		{
+			Module:      "steps",
+			Function:    "Assert",
+			Description: "上报断言结果，条件不成立时返回错误",
+			Signature:   "func Assert(cond bool, format string, args ...interface{}) error",
+			Parameters:  "cond: 断言条件, format/args: 断言描述",
+			Return:      "条件不成立时返回断言失败的错误",
+			Example:     "return steps.Assert(obj != nil, \"找到按钮: %s\", \"登录\")",
+			Keywords:    "断言 验证 检查 assert verify check",
+		},
+		{
+			Module:      "steps",
+			Function:    "Screenshot",
+			Description: "上报当前步骤保存的截图路径",
+			Signature:   "func Screenshot(path string)",
+			Parameters:  "path: 截图文件路径",
+			Return:      "无",
+			Example:     "steps.Screenshot(\"/sdcard/step1.png\")",
+			Keywords:    "截图 screenshot 截屏",
+		},
+	}
+
+	return kb.replaceDefaults(apis)
+}
+
+// replaceDefaults 在一个事务中删除旧的默认条目、写入apis并记录版本
+func (kb *KnowledgeBase) replaceDefaults(apis []APIDoc) error {
+	tx, err := kb.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var version int
+	if err := tx.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM api_docs WHERE builtin = 1`); err != nil {
+		return err
+	}
+	// 版本0的知识库中默认条目没有标记，按模块和函数名删除
+	if version == 0 {
+		for _, api := range apis {
+			if _, err := tx.Exec(`DELETE FROM api_docs WHERE builtin = 0 AND module = ? AND function = ?`, api.Module, api.Function); err != nil {
+				return err
+			}
+		}
+		for _, module := range removedDefaultModules {
+			if _, err := tx.Exec(`DELETE FROM api_docs WHERE module = ?`, module); err != nil {
+				return err
+			}
+		}
 	}
 
 	for _, api := range apis {
-		if err := kb.AddAPI(api); err != nil {
+		_, err := tx.Exec(`
+		INSERT INTO api_docs (module, function, description, signature, parameters, return_type, example, keywords, builtin)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, 1)`,
+			api.Module, api.Function, api.Description, api.Signature,
+			api.Parameters, api.Return, api.Example, api.Keywords)
+		if err != nil {
 			return fmt.Errorf("添加API失败 %s.%s: %v", api.Module, api.Function, err)
 		}
 	}
-
-	return nil
+	if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, defaultKnowledgeVersion)); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // GetContext 获取上下文信息（用于RAG）
 func (kb *KnowledgeBase) GetContext(query string) (string, error) {
-	var docs []APIDoc
-	var err error
-
-	if kb.embedder != nil {
-		if err := kb.EnsureEmbeddings(); err != nil {
-			return "", err
-		}
-		docs, err = kb.SearchWithEmbeddings(query, 5)
-	} else {
-		docs, err = kb.Search(query, 5)
-	}
+	return kb.RetrieveContext(context.Background(), query)
+}
 
+// RetrieveContext 获取上下文信息（用于RAG），ctx取消时中断向量化
+func (kb *KnowledgeBase) RetrieveContext(ctx context.Context, query string) (string, error) {
+	docs, err := kb.RetrieveDocs(ctx, query)
 	if err != nil {
 		return "", err
 	}
+	return FormatContext(docs), nil
+}
+
+// RetrieveDocs 检索与查询最相关的API文档，配置了embedder时使用向量检索
+func (kb *KnowledgeBase) RetrieveDocs(ctx context.Context, query string) ([]APIDoc, error) {
+	if kb.embedder != nil {
+		if err := kb.EnsureEmbeddingsContext(ctx); err != nil {
+			return nil, err
+		}
+		return kb.searchWithEmbeddings(ctx, query, 5)
+	}
+	return kb.Search(query, 5)
+}
 
+// FormatContext 将API文档格式化为提示词中的上下文
+func FormatContext(docs []APIDoc) string {
 	var context strings.Builder
 	context.WriteString("相关API文档:\n\n")
 	for i, doc := range docs {
@@ -535,17 +791,20 @@ func (kb *KnowledgeBase) GetContext(query string) (string, error) {
 		context.WriteString(fmt.Sprintf("   返回: %s\n", doc.Return))
 		context.WriteString(fmt.Sprintf("   示例: %s\n\n", doc.Example))
 	}
-
-	return context.String(), nil
+	return context.String()
 }
 
 // SearchWithEmbeddings 使用向量检索相关API
 func (kb *KnowledgeBase) SearchWithEmbeddings(query string, limit int) ([]APIDoc, error) {
+	return kb.searchWithEmbeddings(context.Background(), query, limit)
+}
+
+func (kb *KnowledgeBase) searchWithEmbeddings(ctx context.Context, query string, limit int) ([]APIDoc, error) {
 	if kb.embedder == nil {
 		return kb.Search(query, limit)
 	}
 
-	vector, err := kb.embedder.Embed(query)
+	vector, err := kb.embed(ctx, query)
 	if err != nil {
 		return nil, err
 	}
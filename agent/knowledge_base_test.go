@@ -0,0 +1,89 @@
+package agent
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// countDocs 返回知识库中满足条件的条目数
+func countDocs(t *testing.T, kb *KnowledgeBase, where string, args ...interface{}) int {
+	t.Helper()
+	var n int
+	if err := kb.db.QueryRow(`SELECT COUNT(*) FROM api_docs WHERE `+where, args...).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestKnowledgeBaseUpgradesDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kb.db")
+
+	// 旧版本的知识库：没有builtin列，包含已移除的opencv条目、缺少steps条目，另有用户添加的条目
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+	CREATE TABLE api_docs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		module TEXT NOT NULL,
+		function TEXT NOT NULL,
+		description TEXT,
+		signature TEXT,
+		parameters TEXT,
+		return_type TEXT,
+		example TEXT,
+		keywords TEXT,
+		embedding TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	INSERT INTO api_docs (module, function, description, keywords) VALUES
+		('motion', 'Click', '旧的点击说明', 'click'),
+		('opencv', 'FindImage', '查找图片', 'image'),
+		('custom', 'Login', '项目自己的登录封装', 'login');
+	`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kb, err := NewKnowledgeBase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kb.Close()
+	if err := kb.EnsureDefaults(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := countDocs(t, kb, `module = 'opencv'`); n != 0 {
+		t.Errorf("%d stale opencv entries left", n)
+	}
+	if n := countDocs(t, kb, `module = 'motion' AND function = 'Click'`); n != 1 {
+		t.Errorf("got %d motion.Click entries, want 1", n)
+	}
+	if n := countDocs(t, kb, `module = 'steps'`); n == 0 {
+		t.Error("new default entries were not added")
+	}
+	if n := countDocs(t, kb, `module = 'custom' AND builtin = 0`); n != 1 {
+		t.Error("user entry was removed")
+	}
+
+	// 版本未变化时不再写入
+	total := countDocs(t, kb, `1 = 1`)
+	if err := kb.EnsureDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	if n := countDocs(t, kb, `1 = 1`); n != total {
+		t.Errorf("EnsureDefaults on an up-to-date knowledge base changed %d entries to %d", total, n)
+	}
+
+	// 重复构建替换默认条目而不是追加
+	if err := BuildDefaultKnowledgeBase(kb); err != nil {
+		t.Fatal(err)
+	}
+	if n := countDocs(t, kb, `1 = 1`); n != total {
+		t.Errorf("rebuilding defaults changed %d entries to %d", total, n)
+	}
+}
@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// defaultRequestTimeout 不带ctx的方法（Generate、Embed）的请求超时。
+// 客户端本身不设超时，带ctx的调用由各阶段的超时控制
+const defaultRequestTimeout = 2 * time.Minute
+
+// ChatMessage 对话消息，Role为 system、user 或 assistant
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// LLMBackend 大模型后端接口，Ollama和OpenAI兼容服务（llama.cpp server、vLLM、LM Studio等）都实现该接口
+type LLMBackend interface {
+	// ModelName 推理模型名称，用于选择针对模型的提示词模板
+	ModelName() string
+	// GenerateContext 根据提示词生成内容
+	GenerateContext(ctx context.Context, prompt string) (string, error)
+	// GenerateStream 流式生成，通过onToken回调增量片段并返回完整内容
+	GenerateStream(ctx context.Context, prompt string, onToken TokenFunc) (string, error)
+	// Chat 多轮对话，onToken非空时流式返回
+	Chat(ctx context.Context, messages []ChatMessage, onToken TokenFunc) (string, error)
+
+	Embedder
+	ContextEmbedder
+}
+
+// ModelSwitcher 可在运行中切换推理模型的后端
+type ModelSwitcher interface {
+	SetModel(model string)
+}
+
+// LLMConfig 大模型后端配置
+type LLMConfig struct {
+	Backend    string // ollama（默认）或 openai
+	BaseURL    string
+	Model      string
+	EmbedModel string
+	APIKey     string // 仅OpenAI兼容服务使用
+}
+
+// NewLLMBackend 按配置创建大模型后端
+func NewLLMBackend(cfg LLMConfig) (LLMBackend, error) {
+	switch strings.ToLower(cfg.Backend) {
+	case "", "ollama":
+		return NewOllamaClient(cfg.BaseURL, cfg.Model, cfg.EmbedModel), nil
+	case "openai":
+		return NewOpenAIClient(cfg.BaseURL, cfg.APIKey, cfg.Model, cfg.EmbedModel), nil
+	default:
+		return nil, fmt.Errorf("不支持的LLM后端: %s（可选 ollama, openai）", cfg.Backend)
+	}
+}
+
+var (
+	_ LLMBackend    = (*OllamaClient)(nil)
+	_ LLMBackend    = (*OpenAIClient)(nil)
+	_ ModelSwitcher = (*OllamaClient)(nil)
+	_ ModelSwitcher = (*OpenAIClient)(nil)
+)
@@ -1,65 +1,267 @@
 package agent
 
 import (
+	"context"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 )
 
+// DefaultMemoryBudget 对话记忆的默认token预算，足够容纳最近几轮的代码
+const DefaultMemoryBudget = 3000
+
+// DefaultMemoryMaxAge 未被引用的对话记忆的默认保留时长
+const DefaultMemoryMaxAge = 30 * 24 * time.Hour
+
+// keepRecentMessages 总结时至少原样保留的最近消息数，即最近一轮的查询和结果
+const keepRecentMessages = 2
+
 // Message 对话消息
 type Message struct {
-	Role      string
-	Content   string
-	Timestamp time.Time
+	Role      string    `json:"role"`
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
 }
 
-// ConversationMemory 多轮对话记忆
+// Summarizer 将较早的对话与已有摘要合并为新的摘要
+type Summarizer func(ctx context.Context, summary string, messages []Message) (string, error)
+
+// ConversationMemory 多轮对话记忆，可在多个goroutine间共享。
+// 超出token预算时较早的消息被总结为摘要，最近一轮始终原样保留；
+// 关联MemoryStore时每条消息和摘要都写入数据库，重启后可按会话ID恢复
 type ConversationMemory struct {
-	history []Message
-	limit   int
+	mu         sync.Mutex
+	history    []Message
+	summary    string
+	budget     int
+	store      *MemoryStore
+	sessionID  string
+	summarize  Summarizer
+	compacting bool // 正在总结较早的对话，期间不再开始新的总结
+	generation int  // 每次清空时递增，用于丢弃清空前开始的总结
 }
 
-// NewConversationMemory 创建记忆
-func NewConversationMemory(limit int) *ConversationMemory {
-	if limit <= 0 {
-		limit = 5
+// NewConversationMemory 创建只保存在内存中的记忆，budget为token预算，不大于0时使用默认值
+func NewConversationMemory(budget int) *ConversationMemory {
+	if budget <= 0 {
+		budget = DefaultMemoryBudget
 	}
-	return &ConversationMemory{
-		history: make([]Message, 0, limit),
-		limit:   limit,
+	return &ConversationMemory{budget: budget}
+}
+
+// OpenConversationMemory 从记忆库恢复会话的记忆，之后的修改同步写入记忆库
+func OpenConversationMemory(store *MemoryStore, sessionID string, budget int) (*ConversationMemory, error) {
+	m := NewConversationMemory(budget)
+	summary, history, err := store.Load(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("读取会话 %s 的对话记忆失败: %w", sessionID, err)
 	}
+	m.store, m.sessionID = store, sessionID
+	m.summary, m.history = summary, history
+	return m, nil
+}
+
+// SetSummarizer 设置超出预算时的总结方式，未设置或总结失败时只保留较早查询的摘录
+func (m *ConversationMemory) SetSummarizer(summarize Summarizer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.summarize = summarize
 }
 
-// AddMessage 添加记录
-func (m *ConversationMemory) AddMessage(role, content string) {
+// AddMessage 添加记录，超出预算时总结较早的对话，返回写入记忆库的错误
+func (m *ConversationMemory) AddMessage(role, content string) error {
+	return m.AddMessageContext(context.Background(), role, content)
+}
+
+// AddMessageContext 添加记录，超出预算时总结较早的对话，ctx取消时总结退回到摘录。
+// 返回写入记忆库的错误
+func (m *ConversationMemory) AddMessageContext(ctx context.Context, role, content string) error {
 	if strings.TrimSpace(content) == "" {
-		return
+		return nil
 	}
-	m.history = append(m.history, Message{
+	msg := Message{
 		Role:      role,
 		Content:   strings.TrimSpace(content),
 		Timestamp: time.Now(),
-	})
-	if len(m.history) > m.limit {
-		m.history = m.history[len(m.history)-m.limit:]
 	}
+	m.mu.Lock()
+	if m.store != nil {
+		if err := m.store.Append(m.sessionID, msg); err != nil {
+			m.mu.Unlock()
+			return err
+		}
+	}
+	m.history = append(m.history, msg)
+	m.mu.Unlock()
+	return m.compact(ctx)
+}
+
+// compact 超出预算时将较早的消息总结为摘要。在锁内取出较早的消息，总结时不持有锁，
+// 其他goroutine可以继续读写记忆；总结期间记忆被清空时丢弃结果。
+// 保留的最近消息不超过预算的一半，摘要失败时退回到较早查询的摘录
+func (m *ConversationMemory) compact(ctx context.Context) error {
+	m.mu.Lock()
+	if m.compacting || m.tokens() <= m.budget {
+		m.mu.Unlock()
+		return nil
+	}
+	keep := m.olderCount()
+	if keep == 0 {
+		m.mu.Unlock()
+		return nil
+	}
+	older := append([]Message(nil), m.history[:keep]...)
+	previous, summarize, generation := m.summary, m.summarize, m.generation
+	m.compacting = true
+	m.mu.Unlock()
+
+	var summary string
+	if summarize != nil {
+		var err error
+		if summary, err = summarize(ctx, previous, older); err != nil {
+			summary = ""
+		}
+	}
+	if strings.TrimSpace(summary) == "" {
+		summary = excerptSummary(previous, older, m.budget/4)
+	}
+	summary = strings.TrimSpace(summary)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.compacting = false
+	if m.generation != generation {
+		return nil
+	}
+	// 总结期间新增的消息在older之后，一并保留
+	recent := append([]Message(nil), m.history[keep:]...)
+	if m.store != nil {
+		if err := m.store.Replace(m.sessionID, summary, recent); err != nil {
+			return err
+		}
+	}
+	m.summary, m.history = summary, recent
+	return nil
+}
+
+// olderCount 返回需要总结的较早消息数，使保留的最近消息不超过预算的一半，调用时持有m.mu
+func (m *ConversationMemory) olderCount() int {
+	keep, used := len(m.history), 0
+	for keep > 0 {
+		tokens := EstimateTokens(m.history[keep-1].Content)
+		if len(m.history)-keep >= keepRecentMessages && used+tokens > m.budget/2 {
+			break
+		}
+		used += tokens
+		keep--
+	}
+	return keep
+}
+
+// tokens 摘要和消息的估计token数
+func (m *ConversationMemory) tokens() int {
+	total := EstimateTokens(m.summary)
+	for _, msg := range m.history {
+		total += EstimateTokens(msg.Content)
+	}
+	return total
+}
+
+// excerptSummary 不经过LLM的摘要：在已有摘要后追加每轮查询及其状态，超出limit时丢弃最早的行
+func excerptSummary(summary string, messages []Message, limit int) string {
+	var lines []string
+	if summary != "" {
+		lines = strings.Split(summary, "\n")
+	}
+	for _, msg := range messages {
+		line := truncateRunes(firstLine(msg.Content), 80)
+		if msg.Role == "user" {
+			lines = append(lines, "- "+line)
+		} else {
+			lines = append(lines, "  "+line)
+		}
+	}
+	for len(lines) > 1 && EstimateTokens(strings.Join(lines, "\n")) > limit {
+		lines = lines[1:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "..."
+}
+
+// EstimateTokens 粗略估计文本的token数：汉字等非ASCII字符各计1个，ASCII字符每4个计1个
+func EstimateTokens(text string) int {
+	ascii, other := 0, 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return other + (ascii+3)/4
 }
 
 // ContextString 返回上下文
 func (m *ConversationMemory) ContextString() string {
-	if len(m.history) == 0 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.history) == 0 && m.summary == "" {
 		return ""
 	}
 	var builder strings.Builder
 	builder.WriteString("对话上下文:\n")
+	if m.summary != "" {
+		builder.WriteString(fmt.Sprintf("[较早对话的摘要]\n%s\n", m.summary))
+	}
 	for _, msg := range m.history {
 		builder.WriteString(fmt.Sprintf("[%s] %s\n", msg.Role, msg.Content))
 	}
 	return builder.String()
 }
 
+// Messages 返回记忆中未被总结的消息副本
+func (m *ConversationMemory) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.history...)
+}
+
+// Summary 返回较早对话的摘要
+func (m *ConversationMemory) Summary() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.summary
+}
+
+// SessionID 返回关联的会话ID，只保存在内存中时为空
+func (m *ConversationMemory) SessionID() string {
+	return m.sessionID
+}
+
+// Clear 清空记忆，同时删除记忆库中的记录
+func (m *ConversationMemory) Clear() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.history, m.summary = nil, ""
+	m.generation++
+	if m.store != nil {
+		return m.store.Delete(m.sessionID)
+	}
+	return nil
+}
+
 // LastUserQuery 返回最近的用户消息
 func (m *ConversationMemory) LastUserQuery() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	for i := len(m.history) - 1; i >= 0; i-- {
 		if m.history[i].Role == "user" {
 			return m.history[i].Content
@@ -68,3 +270,35 @@ func (m *ConversationMemory) LastUserQuery() string {
 	return ""
 }
 
+// ResultMemory 将执行结果整理为记忆中的assistant消息：状态、失败原因和生成的代码，
+// 以便后续查询（如"和之前一样，但在设置页面"）可以在之前的代码基础上修改
+func ResultMemory(result *TestResult, err error) string {
+	var builder strings.Builder
+	if result == nil {
+		builder.WriteString("状态: 失败\n")
+		if err != nil {
+			builder.WriteString(fmt.Sprintf("失败原因: %v\n", err))
+		}
+		return builder.String()
+	}
+
+	if result.Success && err == nil {
+		builder.WriteString("状态: 成功\n")
+	} else {
+		builder.WriteString("状态: 失败\n")
+		reason := result.Error
+		if reason == "" && err != nil {
+			reason = err.Error()
+		}
+		if reason != "" {
+			builder.WriteString(fmt.Sprintf("失败原因: %s\n", truncateRunes(strings.TrimSpace(reason), 500)))
+		}
+	}
+	if failed := FailedStep(result.Steps); failed != nil {
+		builder.WriteString(fmt.Sprintf("失败步骤: %d「%s」%s\n", failed.Index, failed.Name, failed.Message))
+	}
+	if result.Code != "" {
+		builder.WriteString("生成的代码:\n```go\n" + strings.TrimSpace(result.Code) + "\n```\n")
+	}
+	return builder.String()
+}
@@ -0,0 +1,206 @@
+package agent
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// MemoryStore 对话记忆库，按会话ID保存消息和较早对话的摘要
+type MemoryStore struct {
+	db *sql.DB
+}
+
+// DefaultMemoryPath 返回知识库同目录下的默认对话记忆库路径
+func DefaultMemoryPath(kbPath string) string {
+	return filepath.Join(filepath.Dir(kbPath), "conversation_memory.db")
+}
+
+// OpenMemoryStore 打开（不存在时创建）对话记忆库
+func OpenMemoryStore(dbPath string) (*MemoryStore, error) {
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite3", dbPath+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &MemoryStore{db: db}
+	if err := s.initDB(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// initDB 初始化数据库
+func (s *MemoryStore) initDB() error {
+	createTableSQL := `
+	CREATE TABLE IF NOT EXISTS memory_messages (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id TEXT NOT NULL,
+		role TEXT NOT NULL,
+		content TEXT NOT NULL,
+		timestamp INTEGER NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_memory_session ON memory_messages(session_id, id);
+
+	CREATE TABLE IF NOT EXISTS memory_summaries (
+		session_id TEXT PRIMARY KEY,
+		summary TEXT NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+	`
+
+	_, err := s.db.Exec(createTableSQL)
+	return err
+}
+
+// Close 关闭数据库
+func (s *MemoryStore) Close() error {
+	return s.db.Close()
+}
+
+// Load 读取会话的摘要和消息，会话不存在时返回空
+func (s *MemoryStore) Load(sessionID string) (string, []Message, error) {
+	var summary string
+	err := s.db.QueryRow(`SELECT summary FROM memory_summaries WHERE session_id = ?`, sessionID).Scan(&summary)
+	if err != nil && err != sql.ErrNoRows {
+		return "", nil, err
+	}
+
+	rows, err := s.db.Query(`
+	SELECT role, content, timestamp FROM memory_messages
+	WHERE session_id = ? ORDER BY id`, sessionID)
+	if err != nil {
+		return "", nil, err
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		var msg Message
+		var ts int64
+		if err := rows.Scan(&msg.Role, &msg.Content, &ts); err != nil {
+			return "", nil, err
+		}
+		msg.Timestamp = time.Unix(0, ts)
+		messages = append(messages, msg)
+	}
+	return summary, messages, rows.Err()
+}
+
+// Append 追加一条消息
+func (s *MemoryStore) Append(sessionID string, msg Message) error {
+	_, err := s.db.Exec(`
+	INSERT INTO memory_messages (session_id, role, content, timestamp)
+	VALUES (?, ?, ?, ?)`, sessionID, msg.Role, msg.Content, msg.Timestamp.UnixNano())
+	return err
+}
+
+// Replace 用摘要和保留的消息替换会话的全部记忆，用于总结较早的对话后写回
+func (s *MemoryStore) Replace(sessionID, summary string, messages []Message) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceMemory(tx, sessionID, summary, messages); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Copy 将一个会话的记忆复制到另一个会话，目标会话原有的记忆被覆盖
+func (s *MemoryStore) Copy(fromID, toID string) error {
+	summary, messages, err := s.Load(fromID)
+	if err != nil {
+		return err
+	}
+	return s.Replace(toID, summary, messages)
+}
+
+// Delete 删除会话的记忆
+func (s *MemoryStore) Delete(sessionID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceMemory(tx, sessionID, "", nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Prune 删除最后更新早于before且不在keep中的会话记忆，返回删除的会话数
+func (s *MemoryStore) Prune(before time.Time, keep map[string]bool) (int, error) {
+	rows, err := s.db.Query(`
+	SELECT session_id, MAX(updated) FROM (
+		SELECT session_id, timestamp AS updated FROM memory_messages
+		UNION ALL
+		SELECT session_id, updated_at FROM memory_summaries
+	) GROUP BY session_id`)
+	if err != nil {
+		return 0, err
+	}
+	var expired []string
+	for rows.Next() {
+		var sessionID string
+		var updated int64
+		if err := rows.Scan(&sessionID, &updated); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if !keep[sessionID] && time.Unix(0, updated).Before(before) {
+			expired = append(expired, sessionID)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	for _, sessionID := range expired {
+		if err := replaceMemory(tx, sessionID, "", nil); err != nil {
+			return 0, err
+		}
+	}
+	return len(expired), tx.Commit()
+}
+
+func replaceMemory(tx *sql.Tx, sessionID, summary string, messages []Message) error {
+	if _, err := tx.Exec(`DELETE FROM memory_messages WHERE session_id = ?`, sessionID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM memory_summaries WHERE session_id = ?`, sessionID); err != nil {
+		return err
+	}
+	for _, msg := range messages {
+		if _, err := tx.Exec(`
+		INSERT INTO memory_messages (session_id, role, content, timestamp)
+		VALUES (?, ?, ?, ?)`, sessionID, msg.Role, msg.Content, msg.Timestamp.UnixNano()); err != nil {
+			return err
+		}
+	}
+	if summary != "" {
+		if _, err := tx.Exec(`
+		INSERT INTO memory_summaries (session_id, summary, updated_at)
+		VALUES (?, ?, ?)`, sessionID, summary, time.Now().UnixNano()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
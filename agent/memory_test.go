@@ -0,0 +1,250 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	cases := map[string]int{"": 0, "abcd": 1, "abcde": 2, "点击登录": 4, "点击 ok": 3}
+	for text, want := range cases {
+		if got := EstimateTokens(text); got != want {
+			t.Errorf("EstimateTokens(%q) = %d, want %d", text, got, want)
+		}
+	}
+}
+
+// addTurns 添加n轮查询和带代码的结果，每轮约60个token
+func addTurns(m *ConversationMemory, from, n int) {
+	for i := from; i < from+n; i++ {
+		m.AddMessage("user", fmt.Sprintf("查询%d", i))
+		m.AddMessage("assistant", fmt.Sprintf("状态: 成功\n生成的代码:\n%s", strings.Repeat("x", 200)))
+	}
+}
+
+func TestConversationMemoryExcerpt(t *testing.T) {
+	m := NewConversationMemory(200)
+	addTurns(m, 1, 6)
+
+	messages := m.Messages()
+	if len(messages) < keepRecentMessages || messages[len(messages)-2].Content != "查询6" {
+		t.Fatalf("latest turn not kept verbatim: %+v", messages)
+	}
+	if m.tokens() > 200 {
+		t.Errorf("memory uses %d tokens, budget 200", m.tokens())
+	}
+	summary := m.Summary()
+	if !strings.Contains(summary, "- 查询") || strings.Contains(summary, "xxxx") {
+		t.Errorf("excerpt summary = %q", summary)
+	}
+	if context := m.ContextString(); !strings.Contains(context, "[较早对话的摘要]") || !strings.Contains(context, "[user] 查询6") {
+		t.Errorf("context = %q", context)
+	}
+
+	// 单条消息超出预算时仍原样保留最近一轮
+	m.AddMessage("assistant", strings.Repeat("y", 2000))
+	if messages := m.Messages(); messages[len(messages)-1].Content != strings.Repeat("y", 2000) {
+		t.Error("oversized latest message was dropped")
+	}
+}
+
+func TestConversationMemorySummarizer(t *testing.T) {
+	m := NewConversationMemory(200)
+	var calls []string
+	m.SetSummarizer(func(ctx context.Context, summary string, messages []Message) (string, error) {
+		calls = append(calls, summary)
+		if messages[0].Role != "user" {
+			return "", fmt.Errorf("older messages should start with a query: %+v", messages[0])
+		}
+		return fmt.Sprintf("摘要%d（%s起）", len(calls), messages[0].Content), nil
+	})
+	addTurns(m, 1, 4)
+
+	if len(calls) == 0 {
+		t.Fatal("summarizer was not called")
+	}
+	if len(calls) > 1 && !strings.HasPrefix(calls[1], "摘要1") {
+		t.Errorf("second summary should extend the first, got previous %q", calls[1])
+	}
+	if want := fmt.Sprintf("摘要%d", len(calls)); !strings.HasPrefix(m.Summary(), want) {
+		t.Errorf("summary = %q, want %s", m.Summary(), want)
+	}
+
+	// 总结失败时退回到摘录
+	m.SetSummarizer(func(context.Context, string, []Message) (string, error) {
+		return "", errors.New("llm down")
+	})
+	addTurns(m, 5, 3)
+	if !strings.Contains(m.Summary(), "- 查询5") {
+		t.Errorf("fallback summary = %q", m.Summary())
+	}
+}
+
+func TestConversationMemorySummarizesWithoutLock(t *testing.T) {
+	m := NewConversationMemory(200)
+	entered, release := make(chan struct{}), make(chan struct{})
+	m.SetSummarizer(func(ctx context.Context, summary string, messages []Message) (string, error) {
+		close(entered)
+		<-release
+		return "摘要", nil
+	})
+	addTurns(m, 1, 2)
+
+	done := make(chan error)
+	go func() { done <- m.AddMessage("user", strings.Repeat("z", 400)) }()
+	<-entered
+	// 总结进行中时其他调用不会阻塞
+	if err := m.AddMessage("assistant", "总结期间的结果"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(m.ContextString(), "总结期间的结果") {
+		t.Error("message added during summarizing is missing")
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	messages := m.Messages()
+	if m.Summary() != "摘要" || messages[len(messages)-1].Content != "总结期间的结果" {
+		t.Errorf("summary = %q, messages = %+v", m.Summary(), messages)
+	}
+
+	// 总结期间清空时丢弃总结结果
+	m = NewConversationMemory(200)
+	entered, release = make(chan struct{}), make(chan struct{})
+	m.SetSummarizer(func(context.Context, string, []Message) (string, error) {
+		close(entered)
+		<-release
+		return "过期的摘要", nil
+	})
+	addTurns(m, 1, 1)
+	go func() { done <- m.AddMessage("user", strings.Repeat("z", 1000)) }()
+	<-entered
+	if err := m.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	<-done
+	if m.Summary() != "" || len(m.Messages()) != 0 {
+		t.Errorf("cleared memory was overwritten: %q %+v", m.Summary(), m.Messages())
+	}
+}
+
+func TestConversationMemoryContext(t *testing.T) {
+	m := NewConversationMemory(200)
+	m.SetSummarizer(func(ctx context.Context, summary string, messages []Message) (string, error) {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		return "LLM摘要", nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 1; i <= 4; i++ {
+		m.AddMessageContext(ctx, "user", fmt.Sprintf("查询%d", i))
+		m.AddMessageContext(ctx, "assistant", strings.Repeat("x", 200))
+	}
+	// 取消后总结退回到摘录
+	if summary := m.Summary(); summary == "" || strings.Contains(summary, "LLM摘要") {
+		t.Errorf("summary with a cancelled ctx = %q", summary)
+	}
+}
+
+func TestConversationMemoryStoreError(t *testing.T) {
+	store, err := OpenMemoryStore(filepath.Join(t.TempDir(), "memory.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := OpenConversationMemory(store, "s1", 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+	if err := m.AddMessage("user", "查询"); err == nil {
+		t.Error("AddMessage on a closed store should fail")
+	}
+}
+
+func TestConversationMemoryPersistence(t *testing.T) {
+	store, err := OpenMemoryStore(filepath.Join(t.TempDir(), "memory.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	m, err := OpenConversationMemory(store, "s1", 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addTurns(m, 1, 5)
+
+	reopened, err := OpenConversationMemory(store, "s1", 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Summary() != m.Summary() || reopened.ContextString() != m.ContextString() {
+		t.Errorf("reopened memory differs:\n%s\nvs\n%s", reopened.ContextString(), m.ContextString())
+	}
+
+	if err := store.Copy("s1", "s2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if cleared, _ := OpenConversationMemory(store, "s1", 200); cleared.ContextString() != "" {
+		t.Errorf("cleared memory = %q", cleared.ContextString())
+	}
+	if copied, _ := OpenConversationMemory(store, "s2", 200); copied.ContextString() != reopened.ContextString() {
+		t.Errorf("copied memory = %q", copied.ContextString())
+	}
+}
+
+func TestResultMemory(t *testing.T) {
+	result := &TestResult{
+		Code:  "package main\n",
+		Error: "执行失败: exit status 1",
+		Steps: []StepResult{{Index: 2, Name: "验证首页", Status: "fail", Message: "断言失败"}},
+	}
+	content := ResultMemory(result, nil)
+	for _, want := range []string{"状态: 失败", "失败原因: 执行失败: exit status 1", "失败步骤: 2「验证首页」断言失败", "```go\npackage main\n```"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("ResultMemory missing %q:\n%s", want, content)
+		}
+	}
+	if content := ResultMemory(nil, context.Canceled); !strings.Contains(content, "失败原因: context canceled") {
+		t.Errorf("ResultMemory(nil) = %q", content)
+	}
+}
+
+func TestPruneMemory(t *testing.T) {
+	ag := newPipelineAgent(t, NewFakeExecutor(nil), nil)
+	old := []Message{{Role: "user", Content: "很久以前的查询", Timestamp: time.Now().Add(-2 * DefaultMemoryMaxAge)}}
+	for _, id := range []string{"saved", "orphan"} {
+		if err := ag.memory.Replace(id, "", old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ag.memory.Append("fresh", Message{Role: "user", Content: "刚才的查询", Timestamp: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSessionStore(ag.Options().WorkspaceDir).Save("demo", &Session{ID: "saved"}); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := ag.PruneMemory()
+	if err != nil || n != 1 {
+		t.Fatalf("PruneMemory = %d, %v, want 1 session removed", n, err)
+	}
+	for id, want := range map[string]int{"saved": 1, "orphan": 0, "fresh": 1} {
+		if _, messages, _ := ag.memory.Load(id); len(messages) != want {
+			t.Errorf("session %s has %d messages, want %d", id, len(messages), want)
+		}
+	}
+}
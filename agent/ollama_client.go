@@ -2,11 +2,12 @@ package agent
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	"time"
+	"strings"
 )
 
 // OllamaClient 与本地 Ollama 模型交互
@@ -14,7 +15,8 @@ type OllamaClient struct {
 	BaseURL    string
 	Model      string
 	EmbedModel string
-	client     *http.Client
+	// client 不设整体超时，由ctx（各阶段的超时）控制取消
+	client *http.Client
 }
 
 // NewOllamaClient 创建客户端
@@ -32,12 +34,20 @@ func NewOllamaClient(baseURL, model, embedModel string) *OllamaClient {
 		BaseURL:    baseURL,
 		Model:      model,
 		EmbedModel: embedModel,
-		client: &http.Client{
-			Timeout: 120 * time.Second,
-		},
+		client:     &http.Client{},
 	}
 }
 
+// ModelName 推理模型名称
+func (c *OllamaClient) ModelName() string {
+	return c.Model
+}
+
+// SetModel 切换推理模型，向量模型不变
+func (c *OllamaClient) SetModel(model string) {
+	c.Model = model
+}
+
 type ollamaGenerateRequest struct {
 	Model  string `json:"model"`
 	Prompt string `json:"prompt"`
@@ -46,11 +56,19 @@ type ollamaGenerateRequest struct {
 
 type ollamaGenerateResponse struct {
 	Response string `json:"response"`
+	Done     bool   `json:"done"`
 	Error    string `json:"error"`
 }
 
-// Generate 调用Llama生成内容
+// Generate 调用Llama生成内容，超时为defaultRequestTimeout
 func (c *OllamaClient) Generate(prompt string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultRequestTimeout)
+	defer cancel()
+	return c.GenerateContext(ctx, prompt)
+}
+
+// GenerateContext 调用Llama生成内容，ctx取消时中断请求
+func (c *OllamaClient) GenerateContext(ctx context.Context, prompt string) (string, error) {
 	req := ollamaGenerateRequest{
 		Model:  c.Model,
 		Prompt: prompt,
@@ -58,18 +76,12 @@ func (c *OllamaClient) Generate(prompt string) (string, error) {
 	}
 
 	body, _ := json.Marshal(req)
-	resp, err := c.client.Post(fmt.Sprintf("%s/api/generate", c.BaseURL), "application/json", bytes.NewReader(body))
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	data, err := io.ReadAll(resp.Body)
+	data, status, err := c.post(ctx, "/api/generate", body)
 	if err != nil {
 		return "", err
 	}
 
-	if resp.StatusCode >= 400 {
+	if status >= 400 {
 		return "", fmt.Errorf("ollama generate error: %s", string(data))
 	}
 
@@ -85,6 +97,166 @@ func (c *OllamaClient) Generate(prompt string) (string, error) {
 	return result.Response, nil
 }
 
+// TokenFunc 流式生成时接收每个增量片段的回调
+type TokenFunc func(token string)
+
+// StreamChunk 流式生成通过通道发送的片段，Err非空时为最后一个片段
+type StreamChunk struct {
+	Token string
+	Err   error
+}
+
+// GenerateStream 以流式方式调用Llama生成内容，逐块解析NDJSON并通过onToken回调增量片段，
+// 返回完整内容；ctx取消时立即中断请求
+func (c *OllamaClient) GenerateStream(ctx context.Context, prompt string, onToken TokenFunc) (string, error) {
+	req := ollamaGenerateRequest{
+		Model:  c.Model,
+		Prompt: prompt,
+		Stream: true,
+	}
+
+	body, _ := json.Marshal(req)
+	resp, err := c.postStream(ctx, "/api/generate", body)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var full strings.Builder
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var chunk ollamaGenerateResponse
+		if err := decoder.Decode(&chunk); err != nil {
+			if err == io.EOF {
+				break
+			}
+			if ctx.Err() != nil {
+				return full.String(), ctx.Err()
+			}
+			return full.String(), err
+		}
+		if chunk.Error != "" {
+			return full.String(), fmt.Errorf("ollama generate error: %s", chunk.Error)
+		}
+		if chunk.Response != "" {
+			full.WriteString(chunk.Response)
+			if onToken != nil {
+				onToken(chunk.Response)
+			}
+		}
+		if chunk.Done {
+			break
+		}
+	}
+	return full.String(), nil
+}
+
+// GenerateChan 以通道形式返回流式生成的片段，生成结束或出错后关闭通道
+func (c *OllamaClient) GenerateChan(ctx context.Context, prompt string) <-chan StreamChunk {
+	ch := make(chan StreamChunk)
+	go func() {
+		defer close(ch)
+		_, err := c.GenerateStream(ctx, prompt, func(token string) {
+			select {
+			case ch <- StreamChunk{Token: token}:
+			case <-ctx.Done():
+			}
+		})
+		if err != nil {
+			select {
+			case ch <- StreamChunk{Err: err}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return ch
+}
+
+type ollamaChatRequest struct {
+	Model    string        `json:"model"`
+	Messages []ChatMessage `json:"messages"`
+	Stream   bool          `json:"stream"`
+}
+
+type ollamaChatResponse struct {
+	Message ChatMessage `json:"message"`
+	Done    bool        `json:"done"`
+	Error   string      `json:"error"`
+}
+
+// Chat 多轮对话，onToken非空时以流式方式逐块返回
+func (c *OllamaClient) Chat(ctx context.Context, messages []ChatMessage, onToken TokenFunc) (string, error) {
+	req := ollamaChatRequest{
+		Model:    c.Model,
+		Messages: messages,
+		Stream:   onToken != nil,
+	}
+	body, _ := json.Marshal(req)
+
+	if onToken == nil {
+		data, status, err := c.post(ctx, "/api/chat", body)
+		if err != nil {
+			return "", err
+		}
+		if status >= 400 {
+			return "", fmt.Errorf("ollama chat error: %s", string(data))
+		}
+		var result ollamaChatResponse
+		if err := json.Unmarshal(data, &result); err != nil {
+			return "", err
+		}
+		if result.Error != "" {
+			return "", fmt.Errorf("ollama chat error: %s", result.Error)
+		}
+		return result.Message.Content, nil
+	}
+
+	resp, err := c.postStream(ctx, "/api/chat", body)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var full strings.Builder
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var chunk ollamaChatResponse
+		if err := decoder.Decode(&chunk); err != nil {
+			if err == io.EOF {
+				break
+			}
+			if ctx.Err() != nil {
+				return full.String(), ctx.Err()
+			}
+			return full.String(), err
+		}
+		if chunk.Error != "" {
+			return full.String(), fmt.Errorf("ollama chat error: %s", chunk.Error)
+		}
+		if chunk.Message.Content != "" {
+			full.WriteString(chunk.Message.Content)
+			onToken(chunk.Message.Content)
+		}
+		if chunk.Done {
+			break
+		}
+	}
+	return full.String(), nil
+}
+
+type tokenFuncKey struct{}
+
+// WithTokenFunc 返回携带流式回调的ctx，代码生成和修复时会把LLM输出实时交给该回调
+func WithTokenFunc(ctx context.Context, fn TokenFunc) context.Context {
+	return context.WithValue(ctx, tokenFuncKey{}, fn)
+}
+
+// tokenFuncFrom 取出ctx中的流式回调
+func tokenFuncFrom(ctx context.Context) TokenFunc {
+	fn, _ := ctx.Value(tokenFuncKey{}).(TokenFunc)
+	return fn
+}
+
 type ollamaEmbedRequest struct {
 	Model string `json:"model"`
 	Input string `json:"input"`
@@ -95,26 +267,27 @@ type ollamaEmbedResponse struct {
 	Error     string    `json:"error"`
 }
 
-// Embed 生成文本向量
+// Embed 生成文本向量，超时为defaultRequestTimeout
 func (c *OllamaClient) Embed(text string) ([]float32, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultRequestTimeout)
+	defer cancel()
+	return c.EmbedContext(ctx, text)
+}
+
+// EmbedContext 生成文本向量，ctx取消时中断请求
+func (c *OllamaClient) EmbedContext(ctx context.Context, text string) ([]float32, error) {
 	req := ollamaEmbedRequest{
 		Model: c.EmbedModel,
 		Input: text,
 	}
 
 	body, _ := json.Marshal(req)
-	resp, err := c.client.Post(fmt.Sprintf("%s/api/embeddings", c.BaseURL), "application/json", bytes.NewReader(body))
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	data, err := io.ReadAll(resp.Body)
+	data, status, err := c.post(ctx, "/api/embeddings", body)
 	if err != nil {
 		return nil, err
 	}
 
-	if resp.StatusCode >= 400 {
+	if status >= 400 {
 		return nil, fmt.Errorf("ollama embed error: %s", string(data))
 	}
 
@@ -130,3 +303,43 @@ func (c *OllamaClient) Embed(text string) ([]float32, error) {
 	return result.Embedding, nil
 }
 
+// post 发送JSON请求并读取完整响应
+func (c *OllamaClient) post(ctx context.Context, path string, body []byte) ([]byte, int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, resp.StatusCode, nil
+}
+
+// postStream 发送流式请求，返回未读取的响应，状态码异常时返回错误
+func (c *OllamaClient) postStream(ctx context.Context, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("ollama %s error: %s", strings.TrimPrefix(path, "/api/"), string(data))
+	}
+	return resp, nil
+}
@@ -0,0 +1,105 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOllamaGenerateStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ollamaGenerateRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if !req.Stream {
+			t.Error("stream request sent with stream=false")
+		}
+		for _, token := range []string{"package ", "main", "\n"} {
+			fmt.Fprintf(w, `{"response": %q, "done": false}`+"\n", token)
+			w.(http.Flusher).Flush()
+		}
+		fmt.Fprintln(w, `{"response": "", "done": true}`)
+	}))
+	defer srv.Close()
+
+	client := NewOllamaClient(srv.URL, "test", "")
+	var tokens []string
+	full, err := client.GenerateStream(context.Background(), "prompt", func(token string) {
+		tokens = append(tokens, token)
+	})
+	if err != nil {
+		t.Fatalf("GenerateStream: %v", err)
+	}
+	if full != "package main\n" || len(tokens) != 3 {
+		t.Errorf("GenerateStream = %q with tokens %q", full, tokens)
+	}
+
+	var joined strings.Builder
+	for chunk := range client.GenerateChan(context.Background(), "prompt") {
+		if chunk.Err != nil {
+			t.Fatalf("GenerateChan: %v", chunk.Err)
+		}
+		joined.WriteString(chunk.Token)
+	}
+	if joined.String() != full {
+		t.Errorf("GenerateChan = %q, want %q", joined.String(), full)
+	}
+}
+
+func TestOllamaGenerateStreamCancel(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"response": "package", "done": false}`)
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client := NewOllamaClient(srv.URL, "test", "")
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.GenerateStream(ctx, "prompt", func(string) { cancel() })
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("GenerateStream error = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("GenerateStream did not stop after cancel")
+	}
+}
+
+func TestOllamaGenerateUsesContextDeadline(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+			fmt.Fprintln(w, `{"response": "late", "done": true}`)
+		}
+	}))
+	defer srv.Close()
+
+	// 客户端不设整体超时，生成阶段可配置的超时才是唯一的限制
+	client := NewOllamaClient(srv.URL, "test", "")
+	if client.client.Timeout != 0 {
+		t.Errorf("http client timeout = %s, want none", client.client.Timeout)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.GenerateContext(ctx, "prompt"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GenerateContext error = %v, want the context deadline", err)
+	}
+}
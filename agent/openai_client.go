@@ -0,0 +1,203 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// OpenAIClient 与OpenAI兼容接口交互，适用于llama.cpp server、vLLM、LM Studio等本地服务
+type OpenAIClient struct {
+	BaseURL    string // 包含 /v1 前缀，如 http://localhost:8080/v1
+	APIKey     string
+	Model      string
+	EmbedModel string
+	// client 不设整体超时，由ctx（各阶段的超时）控制取消
+	client *http.Client
+}
+
+// NewOpenAIClient 创建客户端
+func NewOpenAIClient(baseURL, apiKey, model, embedModel string) *OpenAIClient {
+	if baseURL == "" {
+		baseURL = "http://localhost:8080/v1"
+	}
+	if embedModel == "" {
+		embedModel = model
+	}
+	return &OpenAIClient{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		APIKey:     apiKey,
+		Model:      model,
+		EmbedModel: embedModel,
+		client:     &http.Client{},
+	}
+}
+
+// ModelName 推理模型名称
+func (c *OpenAIClient) ModelName() string {
+	return c.Model
+}
+
+// SetModel 切换推理模型，向量模型不变
+func (c *OpenAIClient) SetModel(model string) {
+	c.Model = model
+}
+
+type openAIChatRequest struct {
+	Model    string        `json:"model,omitempty"`
+	Messages []ChatMessage `json:"messages"`
+	Stream   bool          `json:"stream"`
+}
+
+type openAIChatResponse struct {
+	Choices []struct {
+		Message ChatMessage `json:"message"`
+		Delta   ChatMessage `json:"delta"`
+	} `json:"choices"`
+	Error *openAIError `json:"error"`
+}
+
+type openAIError struct {
+	Message string `json:"message"`
+}
+
+// GenerateContext 以单条用户消息调用对话接口生成内容
+func (c *OpenAIClient) GenerateContext(ctx context.Context, prompt string) (string, error) {
+	return c.Chat(ctx, []ChatMessage{{Role: "user", Content: prompt}}, nil)
+}
+
+// GenerateStream 以单条用户消息流式生成内容
+func (c *OpenAIClient) GenerateStream(ctx context.Context, prompt string, onToken TokenFunc) (string, error) {
+	return c.Chat(ctx, []ChatMessage{{Role: "user", Content: prompt}}, onToken)
+}
+
+// Chat 调用 /chat/completions，onToken非空时解析SSE流逐块返回
+func (c *OpenAIClient) Chat(ctx context.Context, messages []ChatMessage, onToken TokenFunc) (string, error) {
+	req := openAIChatRequest{
+		Model:    c.Model,
+		Messages: messages,
+		Stream:   onToken != nil,
+	}
+	body, _ := json.Marshal(req)
+
+	resp, err := c.do(ctx, "/chat/completions", body)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if onToken == nil {
+		var result openAIChatResponse
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return "", err
+		}
+		if result.Error != nil {
+			return "", fmt.Errorf("openai chat error: %s", result.Error.Message)
+		}
+		if len(result.Choices) == 0 {
+			return "", fmt.Errorf("openai chat error: 响应中没有choices")
+		}
+		return result.Choices[0].Message.Content, nil
+	}
+
+	var full strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+		var chunk openAIChatResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return full.String(), err
+		}
+		if chunk.Error != nil {
+			return full.String(), fmt.Errorf("openai chat error: %s", chunk.Error.Message)
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			full.WriteString(chunk.Choices[0].Delta.Content)
+			onToken(chunk.Choices[0].Delta.Content)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if ctx.Err() != nil {
+			return full.String(), ctx.Err()
+		}
+		return full.String(), err
+	}
+	return full.String(), nil
+}
+
+type openAIEmbedRequest struct {
+	Model string `json:"model,omitempty"`
+	Input string `json:"input"`
+}
+
+type openAIEmbedResponse struct {
+	Data []struct {
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+	Error *openAIError `json:"error"`
+}
+
+// Embed 生成文本向量，超时为defaultRequestTimeout
+func (c *OpenAIClient) Embed(text string) ([]float32, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultRequestTimeout)
+	defer cancel()
+	return c.EmbedContext(ctx, text)
+}
+
+// EmbedContext 调用 /embeddings 生成文本向量，ctx取消时中断请求
+func (c *OpenAIClient) EmbedContext(ctx context.Context, text string) ([]float32, error) {
+	body, _ := json.Marshal(openAIEmbedRequest{Model: c.EmbedModel, Input: text})
+	resp, err := c.do(ctx, "/embeddings", body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result openAIEmbedResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if result.Error != nil {
+		return nil, fmt.Errorf("openai embed error: %s", result.Error.Message)
+	}
+	if len(result.Data) == 0 {
+		return nil, fmt.Errorf("openai embed error: 响应中没有向量")
+	}
+	return result.Data[0].Embedding, nil
+}
+
+// do 发送JSON请求，状态码异常时返回错误
+func (c *OpenAIClient) do(ctx context.Context, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("openai %s error: %s", strings.TrimPrefix(path, "/"), string(data))
+	}
+	return resp, nil
+}
@@ -0,0 +1,60 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOpenAIClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("Authorization = %q", got)
+		}
+		switch r.URL.Path {
+		case "/v1/chat/completions":
+			var req openAIChatRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			if !req.Stream {
+				fmt.Fprintf(w, `{"choices": [{"message": {"role": "assistant", "content": "echo: %s"}}]}`, req.Messages[0].Content)
+				return
+			}
+			for _, token := range []string{"package", " main"} {
+				fmt.Fprintf(w, "data: {\"choices\": [{\"delta\": {\"content\": %q}}]}\n\n", token)
+			}
+			fmt.Fprint(w, "data: [DONE]\n\n")
+		case "/v1/embeddings":
+			fmt.Fprint(w, `{"data": [{"embedding": [0.5, 1.5]}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	backend, err := NewLLMBackend(LLMConfig{Backend: "openai", BaseURL: srv.URL + "/v1/", APIKey: "secret", Model: "local"})
+	if err != nil {
+		t.Fatalf("NewLLMBackend: %v", err)
+	}
+
+	if got, err := backend.GenerateContext(context.Background(), "hi"); err != nil || got != "echo: hi" {
+		t.Errorf("GenerateContext = %q, %v", got, err)
+	}
+
+	var tokens []string
+	got, err := backend.GenerateStream(context.Background(), "hi", func(token string) { tokens = append(tokens, token) })
+	if err != nil || got != "package main" || len(tokens) != 2 {
+		t.Errorf("GenerateStream = %q (tokens %q), %v", got, tokens, err)
+	}
+
+	vec, err := backend.Embed("hi")
+	if err != nil || len(vec) != 2 || vec[1] != 1.5 {
+		t.Errorf("Embed = %v, %v", vec, err)
+	}
+
+	if _, err := NewLLMBackend(LLMConfig{Backend: "gemini"}); err == nil {
+		t.Error("NewLLMBackend accepted an unknown backend")
+	}
+}
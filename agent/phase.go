@@ -0,0 +1,104 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Phase 流水线阶段
+type Phase string
+
+const (
+	PhaseEmbed    Phase = "embed"    // 知识库向量化与检索
+	PhaseGenerate Phase = "generate" // 代码生成与修复
+	PhaseBuild    Phase = "build"    // 编译
+	PhasePush     Phase = "push"     // 推送到设备
+	PhaseRun      Phase = "run"      // 设备端执行
+)
+
+// PhaseTimeouts 各阶段超时时间，0使用默认值，负数表示不限制
+type PhaseTimeouts struct {
+	Embed    time.Duration
+	Generate time.Duration
+	Build    time.Duration
+	Push     time.Duration
+	Run      time.Duration
+}
+
+func (t *PhaseTimeouts) normalize() {
+	if t.Embed == 0 {
+		t.Embed = time.Minute
+	}
+	if t.Generate == 0 {
+		t.Generate = 3 * time.Minute
+	}
+	if t.Build == 0 {
+		t.Build = 2 * time.Minute
+	}
+	if t.Push == 0 {
+		t.Push = time.Minute
+	}
+	if t.Run == 0 {
+		t.Run = 5 * time.Minute
+	}
+}
+
+// get 返回阶段的超时时间
+func (t PhaseTimeouts) get(phase Phase) time.Duration {
+	switch phase {
+	case PhaseEmbed:
+		return t.Embed
+	case PhaseGenerate:
+		return t.Generate
+	case PhaseBuild:
+		return t.Build
+	case PhasePush:
+		return t.Push
+	case PhaseRun:
+		return t.Run
+	}
+	return 0
+}
+
+// TimeoutError 某个阶段超过了配置的超时时间
+type TimeoutError struct {
+	Phase   Phase
+	Timeout time.Duration
+	Err     error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("阶段 %s 超时（%v）: %v", e.Phase, e.Timeout, e.Err)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// runPhase 在阶段超时时间内执行fn，超时返回*TimeoutError
+func runPhase(ctx context.Context, timeouts PhaseTimeouts, phase Phase, fn func(ctx context.Context) error) error {
+	timeout := timeouts.get(phase)
+	phaseCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		phaseCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	err := fn(phaseCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(phaseCtx.Err(), context.DeadlineExceeded) {
+		return &TimeoutError{Phase: phase, Timeout: timeout, Err: err}
+	}
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("阶段 %s 已取消: %w", phase, ctx.Err())
+	}
+	return err
+}
+
+// isInterrupted 错误是否由超时或取消引起，这类错误需要返回给调用方
+func isInterrupted(err error) bool {
+	var timeoutErr *TimeoutError
+	return errors.As(err, &timeoutErr) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,41 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunPhaseTimeout(t *testing.T) {
+	timeouts := PhaseTimeouts{Run: 10 * time.Millisecond}
+	err := runPhase(context.Background(), timeouts, PhaseRun, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("expected *TimeoutError, got %v", err)
+	}
+	if timeoutErr.Phase != PhaseRun {
+		t.Errorf("Phase = %s, want %s", timeoutErr.Phase, PhaseRun)
+	}
+}
+
+func TestRunPhaseCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := runPhase(ctx, PhaseTimeouts{Build: time.Minute}, PhaseBuild, func(ctx context.Context) error {
+		return ctx.Err()
+	})
+
+	var timeoutErr *TimeoutError
+	if errors.As(err, &timeoutErr) {
+		t.Fatalf("cancellation reported as timeout: %v", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
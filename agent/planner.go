@@ -0,0 +1,201 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TestStep 测试计划中的单个步骤
+type TestStep struct {
+	Index  int    // 步骤序号，从1开始
+	Text   string // 步骤对应的原始描述
+	Intent Intent // 步骤意图
+}
+
+// TestPlan 由一条自然语言查询拆分出的有序测试步骤
+type TestPlan struct {
+	Query string
+	Steps []TestStep
+}
+
+func (p *TestPlan) String() string {
+	var builder strings.Builder
+	for _, step := range p.Steps {
+		builder.WriteString(fmt.Sprintf("步骤%d: %s\n", step.Index, step.Text))
+		for _, line := range strings.Split(strings.TrimSpace(step.Intent.String()), "\n") {
+			builder.WriteString("  " + line + "\n")
+		}
+	}
+	return builder.String()
+}
+
+// Plan 将复合查询拆分为有序的测试步骤
+func (cg *CodeGenerator) Plan(query string) *TestPlan {
+	plan := &TestPlan{Query: query}
+	for _, clause := range splitClauses(query) {
+		index := len(plan.Steps) + 1
+		intent := ParseIntent(clause)
+		// 未指定保存路径的截图按步骤序号命名，避免相互覆盖
+		if intent.Action == "screenshot" && intent.Value == "" {
+			intent.Value = fmt.Sprintf("/sdcard/genie_step%d.png", index)
+		}
+		plan.Steps = append(plan.Steps, TestStep{
+			Index:  index,
+			Text:   clause,
+			Intent: intent,
+		})
+	}
+	return plan
+}
+
+// clauseSeparators 步骤之间的分隔标点
+var clauseSeparators = map[rune]bool{
+	'，': true, ',': true, '；': true, ';': true, '。': true, '\n': true,
+}
+
+// clauseConnectors 步骤之间的连接词
+var clauseConnectors = []string{
+	"然后", "接着", "随后", "之后", "最后",
+	" and then ", " then ", " after that ", " finally ",
+}
+
+// clausePrefixes 步骤开头可去除的修饰词，只在后接分隔符或操作词时去除，
+// 避免截断属于步骤内容的词，如 再见、first-run
+var clausePrefixes = []string{
+	"首先", "先", "再次", "再", "并且", "并", "and", "then", "first", "finally",
+}
+
+// quotePairs 引号和括号，其中的分隔符不拆分步骤
+var quotePairs = map[rune]rune{
+	'"': '"', '\'': '\'', '“': '”', '‘': '’', '「': '」', '『': '』', '(': ')', '（': '）',
+}
+
+// splitClauses 按标点和连接词拆分查询，忽略引号和括号内的分隔符
+func splitClauses(query string) []string {
+	var clauses []string
+	var current strings.Builder
+	var closing []rune
+
+	flush := func() {
+		clause := trimClause(current.String())
+		if clause != "" {
+			clauses = append(clauses, clause)
+		}
+		current.Reset()
+	}
+
+	for i := 0; i < len(query); {
+		r, size := utf8.DecodeRuneInString(query[i:])
+
+		if len(closing) > 0 {
+			if r == closing[len(closing)-1] && isQuoteClose(query, i, size) {
+				closing = closing[:len(closing)-1]
+			} else if c, ok := quotePairs[r]; ok && r != '"' && r != '\'' {
+				closing = append(closing, c)
+			}
+			current.WriteString(query[i : i+size])
+			i += size
+			continue
+		}
+
+		if c, ok := quotePairs[r]; ok && (r != '\'' || !isApostrophe(lastRune(query[:i]), nextRune(query[i+size:]))) {
+			closing = append(closing, c)
+			current.WriteString(query[i : i+size])
+			i += size
+			continue
+		}
+
+		if clauseSeparators[r] && !isCoordinateComma(query, i, size) {
+			flush()
+			i += size
+			continue
+		}
+
+		if n := matchConnector(query[i:]); n > 0 {
+			flush()
+			i += n
+			continue
+		}
+
+		current.WriteString(query[i : i+size])
+		i += size
+	}
+	flush()
+
+	return clauses
+}
+
+// isCoordinateComma 两侧都是数字的逗号属于坐标，如 点击100, 200
+func isCoordinateComma(query string, i, size int) bool {
+	if r, _ := utf8.DecodeRuneInString(query[i:]); r != ',' && r != '，' {
+		return false
+	}
+	before := strings.TrimRight(query[:i], " ")
+	after := strings.TrimLeft(query[i+size:], " ")
+	return before != "" && after != "" &&
+		isDigit(before[len(before)-1]) && isDigit(after[0])
+}
+
+// isQuoteClose 英文单引号为撇号时不结束引号，如 'it's me'
+func isQuoteClose(query string, i, size int) bool {
+	return query[i] != '\'' || !isApostrophe(lastRune(query[:i]), nextRune(query[i+size:]))
+}
+
+// isApostrophe 英文单引号夹在两个拉丁字母之间时为撇号，如 don't、it's；
+// 后面是数字或汉字时仍是引号，如 长按'消息'3秒
+func isApostrophe(prev, next rune) bool {
+	return unicode.Is(unicode.Latin, prev) && unicode.Is(unicode.Latin, next)
+}
+
+func nextRune(s string) rune {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r
+}
+
+func lastRune(s string) rune {
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return r
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func matchConnector(s string) int {
+	for _, conn := range clauseConnectors {
+		if len(s) >= len(conn) && strings.EqualFold(s[:len(conn)], conn) {
+			return len(conn)
+		}
+	}
+	return 0
+}
+
+func trimClause(clause string) string {
+	clause = strings.TrimSpace(clause)
+	for trimmed := true; trimmed; {
+		trimmed = false
+		for _, prefix := range clausePrefixes {
+			if len(clause) > len(prefix) && strings.EqualFold(clause[:len(prefix)], prefix) &&
+				prefixDelimited(clause[len(prefix):]) {
+				clause = strings.TrimLeft(clause[len(prefix):], " \t、:：")
+				trimmed = true
+			}
+		}
+	}
+	return clause
+}
+
+// prefixDelimited 判断修饰词之后是否为分隔符（空白、冒号、顿号）或操作词，如 再点击、then click
+func prefixDelimited(rest string) bool {
+	r, _ := utf8.DecodeRuneInString(rest)
+	if unicode.IsSpace(r) || strings.ContainsRune("、:：", r) {
+		return true
+	}
+	if !isHan(r) {
+		return false
+	}
+	lex, _ := longestMatch([]rune(rest))
+	return lex != nil && lex.action != ""
+}
@@ -0,0 +1,160 @@
+package agent
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitClauses(t *testing.T) {
+	cases := []struct {
+		query string
+		want  []string
+	}{
+		{
+			query: "启动com.example.app，点击登录按钮，输入'admin'，验证页面出现'主页'",
+			want:  []string{"启动com.example.app", "点击登录按钮", "输入'admin'", "验证页面出现'主页'"},
+		},
+		{
+			query: "在坐标(100, 200)点击然后等待5秒",
+			want:  []string{"在坐标(100, 200)点击", "等待5秒"},
+		},
+		{
+			query: "输入\"a,b\"；再点击确定按钮",
+			want:  []string{"输入\"a,b\"", "点击确定按钮"},
+		},
+		{
+			query: "launch com.example.app then click \"Login\"",
+			want:  []string{"launch com.example.app", "click \"Login\""},
+		},
+		{
+			query: "点击登录按钮",
+			want:  []string{"点击登录按钮"},
+		},
+		{
+			query: "点击100, 200，然后从300,800滑到300,200",
+			want:  []string{"点击100, 200", "从300,800滑到300,200"},
+		},
+		// 单词中的单引号是撇号，不开始或结束引号
+		{
+			query: "tap 'it's me', then wait 2 seconds, don't skip",
+			want:  []string{"tap 'it's me'", "wait 2 seconds", "don't skip"},
+		},
+		// 引号后紧跟数字或汉字时仍结束引号
+		{
+			query: "长按'消息'3秒，然后点击'OK'",
+			want:  []string{"长按'消息'3秒", "点击'OK'"},
+		},
+		{
+			query: "点击'确定'2次，再验证'成功'",
+			want:  []string{"点击'确定'2次", "验证'成功'"},
+		},
+		// 修饰词只在后接分隔符或操作词时去除
+		{
+			query: "再见页面出现后截图；再点击确定；then: tap OK；first-run向导",
+			want:  []string{"再见页面出现后截图", "点击确定", "tap OK", "first-run向导"},
+		},
+	}
+
+	for _, tc := range cases {
+		got := splitClauses(tc.query)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("splitClauses(%q) = %q, want %q", tc.query, got, tc.want)
+		}
+	}
+}
+
+func TestGenerateCodeMultiStep(t *testing.T) {
+	cg := NewCodeGenerator(nil)
+	plan := cg.Plan("启动应用\"com.example.app\"，点击\"登录\"按钮，验证页面出现\"主页\"文字，等待3秒")
+	if len(plan.Steps) != 4 {
+		t.Fatalf("expected 4 steps, got %d", len(plan.Steps))
+	}
+
+	code := cg.generateCode(plan, "")
+	file, err := parser.ParseFile(token.NewFileSet(), "generated.go", code, 0)
+	if err != nil {
+		t.Fatalf("generated code does not parse: %v\n%s", err, code)
+	}
+
+	for i := 1; i <= len(plan.Steps); i++ {
+		if !strings.Contains(code, fmt.Sprintf("func step%d() error", i)) {
+			t.Errorf("missing step%d function", i)
+		}
+	}
+
+	// 每个导入的包都必须被使用
+	for _, imp := range file.Imports {
+		path := strings.Trim(imp.Path.Value, "\"")
+		name := path[strings.LastIndex(path, "/")+1:]
+		if !strings.Contains(code, name+".") {
+			t.Errorf("import %s is not used", path)
+		}
+	}
+}
+
+func TestGenerateCodeExtendedActions(t *testing.T) {
+	validator := NewScriptValidator(newTestKnowledgeBase(t), findModuleRoot("."))
+	cg := NewCodeGenerator(nil)
+	plan := cg.Plan("安装'/sdcard/demo.apk'；清除数据com.example.app；长按(300, 400)两秒；长按'相册'；" +
+		"返回桌面；打开最近任务；按返回键；向下滚动直到出现'关于手机'；复制'123'到剪贴板；" +
+		"验证(100,200)的颜色为#FF0000；点击颜色#1E90FF；音量设为8；截图；强制停止com.example.app；卸载com.example.app")
+
+	code := cg.generateCode(plan, "")
+	diags, err := validator.Validate(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diags) > 0 {
+		t.Fatalf("generated code has diagnostics:\n%s\n%s", FormatDiagnostics(diags), code)
+	}
+
+	for _, want := range []string{
+		`app.Install("/sdcard/demo.apk")`,
+		`app.Clear("com.example.app")`,
+		"motion.LongClick(300, 400, 2000)",
+		"motion.LongClick(bounds.CenterX, bounds.CenterY, 1000)",
+		"motion.Home()",
+		"motion.Recents()",
+		"motion.Back()",
+		"list.ScrollForward()",
+		`ime.SetClipText("123")`,
+		`images.FindColor(100, 200, 101, 201, "FF0000", 0.9, 0)`,
+		`images.FindColor(0, 0, 0, 0, "1E90FF", 0.9, 0)`,
+		"device.SetMusicVolume(8)",
+		`steps.Screenshot("/sdcard/genie_step13.png")`,
+		`app.ForceStop("com.example.app")`,
+		`app.IsUninstalled("com.example.app")`,
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated code missing %s", want)
+		}
+	}
+	if strings.Contains(code, "未识别的操作类型") || strings.Contains(code, "（需要指定") {
+		t.Errorf("every step should produce real code:\n%s", code)
+	}
+}
+
+func TestGenerateCodeImageSteps(t *testing.T) {
+	validator := NewScriptValidator(newTestKnowledgeBase(t), findModuleRoot("."))
+	cg := NewCodeGenerator(nil)
+	plan := cg.Plan("点击icon.png，验证图片'/sdcard/logo.png'存在")
+
+	code := cg.generateCode(plan, "")
+	diags, err := validator.Validate(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diags) > 0 {
+		t.Fatalf("generated code has diagnostics:\n%s\n%s", FormatDiagnostics(diags), code)
+	}
+	// 没有图像匹配API，图像步骤执行时明确失败
+	for _, path := range []string{"icon.png", "/sdcard/logo.png"} {
+		if !strings.Contains(code, fmt.Sprintf("不支持图像模板匹配: %%s，请改用文字、控件或坐标定位\", %q)", path)) {
+			t.Errorf("image step for %s should fail explicitly:\n%s", path, code)
+		}
+	}
+}
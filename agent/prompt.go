@@ -0,0 +1,181 @@
+package agent
+
+import (
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+//go:embed prompts/*.tmpl
+var defaultPrompts embed.FS
+
+// 提示词模板名称
+const (
+	PromptGenerate  = "generate"
+	PromptRepair    = "repair"
+	PromptSummarize = "summarize"
+)
+
+// maxPromptExamples few-shot示例的最大数量
+const maxPromptExamples = 3
+
+// PromptExample few-shot示例，来自检索到的API文档的Example字段
+type PromptExample struct {
+	API         string
+	Description string
+	Code        string
+}
+
+// PromptData 渲染提示词模板时可用的变量
+type PromptData struct {
+	Query        string          // 用户需求
+	Intent       string          // 解析出的测试步骤
+	Steps        []TestStep      // 测试步骤列表
+	APIContext   string          // 检索到的API文档
+	Memory       string          // 对话记忆
+	Examples     []PromptExample // few-shot示例
+	Code         string          // 待修复的代码（repair）
+	Diagnostics  string          // 编译错误（repair）
+	Conversation string          // 待总结的较早对话（summarize）
+	Limit        int             // 摘要的最大字数（summarize）
+}
+
+// PromptStore 提示词模板库。按以下顺序查找模板，命中即用：
+//
+//	<dir>/<模型名>/<name>.tmpl  针对某个模型的覆盖
+//	<dir>/<name>.tmpl           工作目录中的通用模板
+//	内置默认模板
+//
+// 模板在每次渲染时读取，修改后无需重新编译或重启。
+type PromptStore struct {
+	dir string
+}
+
+// NewPromptStore 创建模板库，dir为空时只使用内置模板
+func NewPromptStore(dir string) *PromptStore {
+	return &PromptStore{dir: dir}
+}
+
+// Dir 返回模板目录
+func (ps *PromptStore) Dir() string {
+	return ps.dir
+}
+
+// modelDirs 返回模型对应的覆盖目录名，如 "llama3.2:latest" 依次尝试 "llama3.2_latest" 和 "llama3.2"
+func modelDirs(model string) []string {
+	if model == "" {
+		return nil
+	}
+	replacer := strings.NewReplacer(":", "_", "/", "_", "\\", "_")
+	dirs := []string{replacer.Replace(model)}
+	if idx := strings.Index(model, ":"); idx > 0 {
+		dirs = append(dirs, replacer.Replace(model[:idx]))
+	}
+	return dirs
+}
+
+// Source 返回模板内容及其来源（文件路径或 "builtin"）
+func (ps *PromptStore) Source(name, model string) (string, string, error) {
+	if ps.dir != "" {
+		var candidates []string
+		for _, dir := range modelDirs(model) {
+			candidates = append(candidates, filepath.Join(ps.dir, dir, name+".tmpl"))
+		}
+		candidates = append(candidates, filepath.Join(ps.dir, name+".tmpl"))
+		for _, path := range candidates {
+			data, err := os.ReadFile(path)
+			if err == nil {
+				return string(data), path, nil
+			}
+			if !os.IsNotExist(err) {
+				return "", path, err
+			}
+		}
+	}
+
+	data, err := defaultPrompts.ReadFile("prompts/" + name + ".tmpl")
+	if err != nil {
+		return "", "", fmt.Errorf("提示词模板不存在: %s", name)
+	}
+	return string(data), "builtin", nil
+}
+
+// Version 返回模板内容的短哈希，模板修改后版本随之变化
+func (ps *PromptStore) Version(name, model string) string {
+	source, _, err := ps.Source(name, model)
+	if err != nil {
+		return ""
+	}
+	return hashParts("prompt", source)[:12]
+}
+
+// Render 渲染指定模板
+func (ps *PromptStore) Render(name, model string, data PromptData) (string, error) {
+	source, origin, err := ps.Source(name, model)
+	if err != nil {
+		return "", err
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(source)
+	if err != nil {
+		return "", fmt.Errorf("解析提示词模板失败(%s): %v", origin, err)
+	}
+	var builder strings.Builder
+	if err := tmpl.Execute(&builder, data); err != nil {
+		return "", fmt.Errorf("渲染提示词模板失败(%s): %v", origin, err)
+	}
+	return builder.String(), nil
+}
+
+// ExportDefaults 将内置模板写入模板目录，已存在的文件不会被覆盖，返回新写入的文件
+func (ps *PromptStore) ExportDefaults() ([]string, error) {
+	if ps.dir == "" {
+		return nil, fmt.Errorf("未配置提示词模板目录")
+	}
+	if err := os.MkdirAll(ps.dir, 0755); err != nil {
+		return nil, err
+	}
+	entries, err := defaultPrompts.ReadDir("prompts")
+	if err != nil {
+		return nil, err
+	}
+
+	var written []string
+	for _, entry := range entries {
+		path := filepath.Join(ps.dir, entry.Name())
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		data, err := defaultPrompts.ReadFile("prompts/" + entry.Name())
+		if err != nil {
+			return written, err
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return written, err
+		}
+		written = append(written, path)
+	}
+	return written, nil
+}
+
+// promptExamples 从API文档的Example字段提取few-shot示例
+func promptExamples(docs []APIDoc) []PromptExample {
+	var examples []PromptExample
+	for _, doc := range docs {
+		code := strings.TrimSpace(doc.Example)
+		if code == "" {
+			continue
+		}
+		examples = append(examples, PromptExample{
+			API:         doc.Module + "." + doc.Function,
+			Description: doc.Description,
+			Code:        code,
+		})
+		if len(examples) == maxPromptExamples {
+			break
+		}
+	}
+	return examples
+}
@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPromptStore(t *testing.T) {
+	dir := t.TempDir()
+	store := NewPromptStore(dir)
+	docs := []APIDoc{
+		{Module: "uiacc", Function: "Text", Description: "按文本查找控件", Example: "uiacc.New().Text(\"登录\").Click()"},
+		{Module: "utils", Function: "Sleep", Description: "等待"},
+	}
+	data := PromptData{
+		Query:      "点击登录按钮",
+		Intent:     "1. 点击登录按钮",
+		APIContext: FormatContext(docs),
+		Examples:   promptExamples(docs),
+	}
+
+	prompt, err := store.Render(PromptGenerate, "llama3.2:latest", data)
+	if err != nil {
+		t.Fatalf("Render builtin: %v", err)
+	}
+	for _, want := range []string{"点击登录按钮", "uiacc.Text", "uiacc.New().Text(\"登录\").Click()", "package main"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("builtin prompt missing %q:\n%s", want, prompt)
+		}
+	}
+	if len(data.Examples) != 1 {
+		t.Errorf("promptExamples returned %d examples, want 1", len(data.Examples))
+	}
+
+	written, err := store.ExportDefaults()
+	if err != nil || len(written) != 3 {
+		t.Fatalf("ExportDefaults wrote %v (err %v)", written, err)
+	}
+	os.WriteFile(filepath.Join(dir, "generate.tmpl"), []byte("通用: {{.Query}}"), 0644)
+	os.MkdirAll(filepath.Join(dir, "llama3.2"), 0755)
+	os.WriteFile(filepath.Join(dir, "llama3.2", "generate.tmpl"), []byte("llama: {{.Query}}"), 0644)
+
+	if got, _ := store.Render(PromptGenerate, "llama3.2:latest", data); got != "llama: 点击登录按钮" {
+		t.Errorf("model override rendered %q", got)
+	}
+	if got, _ := store.Render(PromptGenerate, "qwen2.5-coder", data); got != "通用: 点击登录按钮" {
+		t.Errorf("workspace template rendered %q", got)
+	}
+
+	os.WriteFile(filepath.Join(dir, "repair.tmpl"), []byte("{{.Unknown}}"), 0644)
+	if _, err := store.Render(PromptRepair, "", data); err == nil {
+		t.Error("Render accepted a template with an unknown variable")
+	}
+}
@@ -0,0 +1,723 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"go/format"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 录制时手势分类的阈值
+const (
+	// longPressThreshold 按住不动超过该时长为长按，与安卓默认的长按时间一致
+	longPressThreshold = 500 * time.Millisecond
+	// minRecordedDelay 小于该间隔的停顿不生成等待
+	minRecordedDelay = 100 * time.Millisecond
+)
+
+// GestureKind 录制到的手势类型
+type GestureKind string
+
+const (
+	GestureTap       GestureKind = "tap"
+	GestureLongPress GestureKind = "long_press"
+	GestureSwipe     GestureKind = "swipe"
+)
+
+// Gesture 一次完整的单指手势，坐标为录制设备的屏幕像素
+type Gesture struct {
+	Kind     GestureKind   `json:"kind"`
+	Start    Point         `json:"start"`
+	End      Point         `json:"end"`
+	At       time.Duration `json:"at"`       // 按下的时间，相对第一个事件
+	Duration time.Duration `json:"duration"` // 按下到抬起的时长
+	Delay    time.Duration `json:"delay"`    // 与上一个手势抬起之间的间隔
+	Selector *UISelector   `json:"selector,omitempty"`
+}
+
+// ScreenSize 屏幕分辨率
+type ScreenSize struct {
+	Width, Height int
+}
+
+// ParseScreenSize 解析 1080x2340 格式的分辨率
+func ParseScreenSize(value string) (ScreenSize, error) {
+	w, h, ok := strings.Cut(strings.TrimSpace(value), "x")
+	width, errW := strconv.Atoi(w)
+	height, errH := strconv.Atoi(h)
+	if !ok || errW != nil || errH != nil || width <= 0 || height <= 0 {
+		return ScreenSize{}, fmt.Errorf("无效的屏幕尺寸: %s（格式如 1080x2340）", value)
+	}
+	return ScreenSize{Width: width, Height: height}, nil
+}
+
+// TouchAxis 触摸屏一个坐标轴的取值范围
+type TouchAxis struct {
+	Min, Max int
+}
+
+// TouchPanel 触摸屏输入设备及其原始坐标范围，来自 getevent -lp
+type TouchPanel struct {
+	Device string
+	X, Y   TouchAxis
+}
+
+// Size 触摸屏原始坐标范围对应的尺寸
+func (p TouchPanel) Size() ScreenSize {
+	return ScreenSize{Width: p.X.Max - p.X.Min + 1, Height: p.Y.Max - p.Y.Min + 1}
+}
+
+var (
+	panelDevicePattern = regexp.MustCompile(`^add device \d+: (\S+)`)
+	panelAxisPattern   = regexp.MustCompile(`(ABS_MT_POSITION_[XY]|ABS_[XY])\s*:\s*value -?\d+, min (-?\d+), max (-?\d+)`)
+	geteventPattern    = regexp.MustCompile(`^\[\s*([\d.]+)\]\s+(?:(/dev/\S+):\s+)?(\S+)\s+(\S+)\s+(\S+)`)
+)
+
+// ParseTouchPanel 从 getevent -lp 的输出中找出触摸屏，优先使用多点触控坐标轴
+func ParseTouchPanel(output string) (TouchPanel, bool) {
+	var device string
+	panels := make(map[string]*TouchPanel)
+	multiTouch := make(map[string]bool)
+	var order []string
+	for _, line := range strings.Split(output, "\n") {
+		if m := panelDevicePattern.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+			device = m[1]
+			continue
+		}
+		m := panelAxisPattern.FindStringSubmatch(line)
+		if m == nil || device == "" {
+			continue
+		}
+		min, _ := strconv.Atoi(m[2])
+		max, _ := strconv.Atoi(m[3])
+		isMT := strings.HasPrefix(m[1], "ABS_MT_")
+		if multiTouch[device] && !isMT {
+			continue
+		}
+		panel, ok := panels[device]
+		if !ok {
+			panel = &TouchPanel{Device: device}
+			panels[device] = panel
+			order = append(order, device)
+		}
+		multiTouch[device] = multiTouch[device] || isMT
+		if strings.HasSuffix(m[1], "X") {
+			panel.X = TouchAxis{Min: min, Max: max}
+		} else {
+			panel.Y = TouchAxis{Min: min, Max: max}
+		}
+	}
+
+	var found *TouchPanel
+	for _, device := range order {
+		panel := panels[device]
+		if panel.X.Max <= panel.X.Min || panel.Y.Max <= panel.Y.Min {
+			continue
+		}
+		if found == nil || multiTouch[device] && !multiTouch[found.Device] {
+			found = panel
+		}
+	}
+	if found == nil {
+		return TouchPanel{}, false
+	}
+	return *found, true
+}
+
+// GestureRecognizer 逐行解析 getevent -lt 的输出并识别单指手势，只跟踪第一个手指（slot 0）
+type GestureRecognizer struct {
+	Panel  TouchPanel // 触摸屏坐标范围，Device非空时只处理该设备的事件
+	Screen ScreenSize // 录制设备的屏幕尺寸
+
+	origin   float64 // 第一个事件的时间戳（秒），为负表示尚未开始
+	slot     int
+	x, y     int // 当前原始坐标
+	touching bool
+	pressed  bool // 本帧收到按下
+	released bool // 本帧收到抬起
+
+	start    Point
+	last     Point
+	startAt  time.Duration
+	maxDist  float64
+	lastUpAt time.Duration
+	hasUp    bool
+}
+
+// NewGestureRecognizer 创建手势识别器，panel为零值时原始坐标按屏幕像素处理
+func NewGestureRecognizer(panel TouchPanel, screen ScreenSize) *GestureRecognizer {
+	return &GestureRecognizer{Panel: panel, Screen: screen, origin: -1}
+}
+
+// Feed 处理一行输出，一个手势结束时返回该手势
+func (r *GestureRecognizer) Feed(line string) (*Gesture, bool) {
+	m := geteventPattern.FindStringSubmatch(strings.TrimSpace(line))
+	if m == nil {
+		return nil, false
+	}
+	if r.Panel.Device != "" && m[2] != "" && m[2] != r.Panel.Device {
+		return nil, false
+	}
+	seconds, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return nil, false
+	}
+	if r.origin < 0 {
+		r.origin = seconds
+	}
+	at := time.Duration((seconds - r.origin) * float64(time.Second))
+	typ, code, value := m[3], m[4], parseEventValue(m[5])
+
+	switch typ {
+	case "EV_ABS":
+		switch code {
+		case "ABS_MT_SLOT":
+			r.slot = value
+		case "ABS_MT_TRACKING_ID":
+			if r.slot != 0 {
+				break
+			}
+			if value < 0 {
+				r.released = true
+			} else {
+				r.pressed = true
+			}
+		case "ABS_MT_POSITION_X", "ABS_X":
+			if r.slot == 0 {
+				r.x = value
+			}
+		case "ABS_MT_POSITION_Y", "ABS_Y":
+			if r.slot == 0 {
+				r.y = value
+			}
+		}
+	case "EV_KEY":
+		if code == "BTN_TOUCH" {
+			if value == 0 {
+				r.released = true
+			} else {
+				r.pressed = true
+			}
+		}
+	case "EV_SYN":
+		if code == "SYN_REPORT" {
+			return r.frame(at)
+		}
+	}
+	return nil, false
+}
+
+// frame 在SYN_REPORT时提交一帧：处理按下、移动和抬起
+func (r *GestureRecognizer) frame(at time.Duration) (*Gesture, bool) {
+	pressed, released := r.pressed, r.released
+	r.pressed, r.released = false, false
+
+	p := r.toScreen(r.x, r.y)
+	if !r.touching {
+		if !pressed || released {
+			return nil, false
+		}
+		r.touching = true
+		r.start, r.last, r.startAt, r.maxDist = p, p, at, 0
+		return nil, false
+	}
+
+	r.last = p
+	r.maxDist = math.Max(r.maxDist, math.Hypot(float64(p.X-r.start.X), float64(p.Y-r.start.Y)))
+	if !released {
+		return nil, false
+	}
+	r.touching = false
+
+	g := &Gesture{Start: r.start, End: r.last, At: r.startAt, Duration: at - r.startAt}
+	if r.hasUp {
+		g.Delay = r.startAt - r.lastUpAt
+	}
+	r.lastUpAt, r.hasUp = at, true
+
+	switch {
+	case r.maxDist > r.tapSlop():
+		g.Kind = GestureSwipe
+	case g.Duration >= longPressThreshold:
+		g.Kind = GestureLongPress
+		g.End = g.Start
+	default:
+		g.Kind = GestureTap
+		g.End = g.Start
+	}
+	return g, true
+}
+
+// tapSlop 手指移动不超过该距离（像素）时视为点击或长按
+func (r *GestureRecognizer) tapSlop() float64 {
+	return math.Max(10, float64(r.Screen.Width)/40)
+}
+
+// toScreen 将触摸屏原始坐标换算为屏幕像素
+func (r *GestureRecognizer) toScreen(x, y int) Point {
+	size := r.Panel.Size()
+	if r.Panel.X.Max <= r.Panel.X.Min || r.Screen.Width == 0 || size == r.Screen {
+		return Point{X: x - r.Panel.X.Min, Y: y - r.Panel.Y.Min}
+	}
+	return Point{
+		X: (x - r.Panel.X.Min) * r.Screen.Width / size.Width,
+		Y: (y - r.Panel.Y.Min) * r.Screen.Height / size.Height,
+	}
+}
+
+// parseEventValue 解析事件值：DOWN/UP或十六进制（ffffffff为-1）
+func parseEventValue(value string) int {
+	switch value {
+	case "DOWN":
+		return 1
+	case "UP":
+		return 0
+	}
+	v, err := strconv.ParseUint(value, 16, 32)
+	if err != nil {
+		return 0
+	}
+	return int(int32(v))
+}
+
+// UISelector 定位控件的uiacc选择条件
+type UISelector struct {
+	By    string `json:"by"` // text, desc, id
+	Value string `json:"value"`
+}
+
+// uiNode uiautomator dump 导出的控件节点
+type uiNode struct {
+	Text       string   `xml:"text,attr"`
+	ResourceID string   `xml:"resource-id,attr"`
+	Desc       string   `xml:"content-desc,attr"`
+	Clickable  bool     `xml:"clickable,attr"`
+	Bounds     string   `xml:"bounds,attr"`
+	Nodes      []uiNode `xml:"node"`
+}
+
+// UIDump 解析后的界面控件树
+type UIDump struct {
+	nodes []uiNodeBounds
+}
+
+type uiNodeBounds struct {
+	node                     *uiNode
+	left, top, right, bottom int
+}
+
+var boundsPattern = regexp.MustCompile(`^\[(-?\d+),(-?\d+)\]\[(-?\d+),(-?\d+)\]$`)
+
+// ParseUIDump 解析 uiautomator dump 导出的XML
+func ParseUIDump(data []byte) (*UIDump, error) {
+	var root struct {
+		Nodes []uiNode `xml:"node"`
+	}
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("解析界面控件树失败: %w", err)
+	}
+	dump := &UIDump{}
+	var walk func(nodes []uiNode)
+	walk = func(nodes []uiNode) {
+		for i := range nodes {
+			n := &nodes[i]
+			if m := boundsPattern.FindStringSubmatch(n.Bounds); m != nil {
+				b := uiNodeBounds{node: n}
+				b.left, _ = strconv.Atoi(m[1])
+				b.top, _ = strconv.Atoi(m[2])
+				b.right, _ = strconv.Atoi(m[3])
+				b.bottom, _ = strconv.Atoi(m[4])
+				dump.nodes = append(dump.nodes, b)
+			}
+			walk(n.Nodes)
+		}
+	}
+	walk(root.Nodes)
+	return dump, nil
+}
+
+// SelectorAt 返回包含坐标的最小控件的选择条件，依次尝试文本、描述和资源ID，
+// 只使用在界面中唯一的值；找不到可用的条件时返回nil
+func (d *UIDump) SelectorAt(p Point) *UISelector {
+	if d == nil {
+		return nil
+	}
+	var best *uiNodeBounds
+	for i := range d.nodes {
+		b := &d.nodes[i]
+		if p.X < b.left || p.X >= b.right || p.Y < b.top || p.Y >= b.bottom {
+			continue
+		}
+		n := b.node
+		if n.Text == "" && n.Desc == "" && n.ResourceID == "" {
+			continue
+		}
+		if best == nil || b.area() < best.area() {
+			best = b
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	for _, s := range []UISelector{
+		{By: "text", Value: best.node.Text},
+		{By: "desc", Value: best.node.Desc},
+		{By: "id", Value: best.node.ResourceID},
+	} {
+		if s.Value != "" && d.count(s) == 1 {
+			return &s
+		}
+	}
+	return nil
+}
+
+func (b *uiNodeBounds) area() int {
+	return (b.right - b.left) * (b.bottom - b.top)
+}
+
+// count 统计匹配选择条件的控件数
+func (d *UIDump) count(s UISelector) int {
+	n := 0
+	for _, b := range d.nodes {
+		switch {
+		case s.By == "text" && b.node.Text == s.Value,
+			s.By == "desc" && b.node.Desc == s.Value,
+			s.By == "id" && b.node.ResourceID == s.Value:
+			n++
+		}
+	}
+	return n
+}
+
+// RecordOptions 录制选项
+type RecordOptions struct {
+	// Screen 录制设备的屏幕尺寸。实时录制时为零值则读取 wm size，
+	// 回放日志时为零值则使用触摸屏的坐标范围
+	Screen ScreenSize
+	// UIDump 回放日志时用于把点击解析为控件的界面控件树
+	UIDump *UIDump
+	// DumpDir 实时录制时保存界面控件树的目录，为空时不解析控件
+	DumpDir string
+	// Log 实时录制时保存 getevent 的原始输出，之后可作为回放输入
+	Log io.Writer
+	// OnGesture 每识别出一个手势时调用
+	OnGesture func(Gesture)
+}
+
+// Recording 录制结果
+type Recording struct {
+	Screen   ScreenSize
+	Gestures []Gesture
+}
+
+// ReplayGetevent 从保存的 getevent 输出中识别手势。日志中包含 getevent -lp 的输出时
+// 据此换算坐标，否则原始坐标按屏幕像素处理
+func ReplayGetevent(r io.Reader, opts RecordOptions) (*Recording, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	panel, ok := ParseTouchPanel(string(data))
+	screen := opts.Screen
+	if screen.Width == 0 {
+		if !ok {
+			return nil, fmt.Errorf("日志中没有触摸屏坐标范围（getevent -lp），需要指定屏幕尺寸")
+		}
+		screen = panel.Size()
+	}
+
+	recording := &Recording{Screen: screen}
+	recognizer := NewGestureRecognizer(panel, screen)
+	for _, line := range strings.Split(string(data), "\n") {
+		g, ok := recognizer.Feed(line)
+		if !ok {
+			continue
+		}
+		if g.Kind == GestureTap {
+			g.Selector = opts.UIDump.SelectorAt(g.Start)
+		}
+		recording.Gestures = append(recording.Gestures, *g)
+		if opts.OnGesture != nil {
+			opts.OnGesture(*g)
+		}
+	}
+	return recording, nil
+}
+
+// ScreenSize 通过 wm size 读取屏幕尺寸，有覆盖尺寸时使用覆盖尺寸
+func (e *AndroidExecutor) ScreenSize(ctx context.Context) (ScreenSize, error) {
+	output, err := e.shell(ctx, "wm size").CombinedOutput()
+	if err != nil {
+		return ScreenSize{}, fmt.Errorf("读取屏幕尺寸失败: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	var size ScreenSize
+	for _, line := range strings.Split(string(output), "\n") {
+		_, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		if s, err := ParseScreenSize(value); err == nil {
+			size = s // Override size 在 Physical size 之后
+		}
+	}
+	if size.Width == 0 {
+		return ScreenSize{}, fmt.Errorf("无法解析屏幕尺寸: %s", strings.TrimSpace(string(output)))
+	}
+	return size, nil
+}
+
+// Record 实时录制设备上的触摸操作，直到ctx取消。每个手势结束后在后台导出界面控件树，
+// 下一次点击按上一个手势之后导出的控件树解析为控件，导出未完成时等待
+func (e *AndroidExecutor) Record(ctx context.Context, opts RecordOptions) (*Recording, error) {
+	panelOutput, err := e.shell(ctx, "getevent -lp").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("读取输入设备失败: %w: %s", err, strings.TrimSpace(string(panelOutput)))
+	}
+	panel, ok := ParseTouchPanel(string(panelOutput))
+	if !ok {
+		return nil, fmt.Errorf("没有找到触摸屏输入设备")
+	}
+	screen := opts.Screen
+	if screen.Width == 0 {
+		if screen, err = e.ScreenSize(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Log != nil {
+		opts.Log.Write(panelOutput)
+	}
+
+	dumps := newUIDumper(e.DumpUI, opts.DumpDir)
+	if opts.DumpDir != "" {
+		if err := os.MkdirAll(opts.DumpDir, 0755); err != nil {
+			return nil, err
+		}
+		dumps.refresh(ctx)
+		dumps.wait()
+	}
+
+	cmd := e.shell(ctx, "getevent -lt")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("启动getevent失败: %w", err)
+	}
+	// 只结束本地adb进程时设备端的getevent会继续运行
+	defer killProcesses(context.WithoutCancel(ctx), e.shell, "getevent -lt")
+
+	recording := &Recording{Screen: screen}
+	var lastGesture time.Time // 上一个手势识别完成的时间，之前导出的控件树已过期
+	recognizer := NewGestureRecognizer(panel, screen)
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if opts.Log != nil {
+			fmt.Fprintln(opts.Log, line)
+		}
+		g, ok := recognizer.Feed(line)
+		if !ok {
+			continue
+		}
+		if g.Kind == GestureTap {
+			g.Selector = dumps.since(lastGesture).SelectorAt(g.Start)
+		}
+		lastGesture = time.Now()
+		recording.Gestures = append(recording.Gestures, *g)
+		if opts.OnGesture != nil {
+			opts.OnGesture(*g)
+		}
+		if opts.DumpDir != "" {
+			dumps.refresh(ctx)
+		}
+	}
+	cmd.Wait()
+	dumps.wait()
+	if ctx.Err() == nil {
+		return recording, fmt.Errorf("getevent意外退出")
+	}
+	return recording, nil
+}
+
+// uiDumper 在后台导出界面控件树，同一时间只有一次导出。
+// 每次导出记录开始的时间，用于判断控件树是否在某个手势之后导出
+type uiDumper struct {
+	dumpUI func(ctx context.Context, localPath string) error
+	dir    string
+
+	mu      sync.Mutex
+	done    *sync.Cond // 一次导出结束时广播
+	running sync.WaitGroup
+	busy    bool
+	dirty   bool // 导出期间又有新的手势，结束后需要重新导出
+	count   int
+	current *UIDump
+	taken   time.Time // current开始导出的时间
+}
+
+func newUIDumper(dumpUI func(ctx context.Context, localPath string) error, dir string) *uiDumper {
+	d := &uiDumper{dumpUI: dumpUI, dir: dir}
+	d.done = sync.NewCond(&d.mu)
+	return d
+}
+
+// refresh 在后台导出一次控件树。已有导出在进行时，其开始时间早于本次手势，
+// 结束后再导出一次
+func (d *uiDumper) refresh(ctx context.Context) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.busy {
+		d.dirty = true
+		return
+	}
+	d.start(ctx)
+}
+
+// start 开始一次导出，调用时持有d.mu
+func (d *uiDumper) start(ctx context.Context) {
+	d.busy = true
+	d.dirty = false
+	d.count++
+	d.running.Add(1)
+	go d.dump(ctx, filepath.Join(d.dir, fmt.Sprintf("ui-%03d.xml", d.count)), time.Now())
+}
+
+func (d *uiDumper) dump(ctx context.Context, path string, started time.Time) {
+	defer d.running.Done()
+	var dump *UIDump
+	if err := d.dumpUI(ctx, path); err == nil {
+		if data, err := os.ReadFile(path); err == nil {
+			dump, _ = ParseUIDump(data)
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.busy = false
+	if dump != nil {
+		d.current = dump
+		d.taken = started
+	}
+	if d.dirty && ctx.Err() == nil {
+		d.start(ctx)
+	}
+	d.done.Broadcast()
+}
+
+// since 返回在t之后开始导出的控件树，导出进行中时等待其结束，没有时返回nil
+func (d *uiDumper) since(t time.Time) *UIDump {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for {
+		if d.current != nil && !d.taken.Before(t) {
+			return d.current
+		}
+		if !d.busy {
+			return nil
+		}
+		d.done.Wait()
+	}
+}
+
+func (d *uiDumper) wait() {
+	d.running.Wait()
+}
+
+// Script 生成回放录制操作的AutoGo脚本。坐标按录制时的屏幕尺寸记录，
+// 回放时用device.Width/Height等比换算到当前设备；能解析为控件的点击优先按控件点击
+func (r *Recording) Script() (string, error) {
+	var body strings.Builder
+	usesUIACC, usesUtils := false, false
+	for i, g := range r.Gestures {
+		name, code := g.step()
+		if g.Delay >= minRecordedDelay {
+			usesUtils = true
+		}
+		if g.Selector != nil {
+			usesUIACC = true
+		}
+		body.WriteString(fmt.Sprintf("\t\t{Name: %q, Run: func() error {\n", fmt.Sprintf("%d. %s", i+1, name)))
+		if g.Delay >= minRecordedDelay {
+			body.WriteString(fmt.Sprintf("\t\t\tutils.Sleep(%d)\n", g.Delay.Milliseconds()))
+		}
+		body.WriteString(code)
+		body.WriteString("\t\t\treturn nil\n\t\t}},\n")
+	}
+
+	var code strings.Builder
+	code.WriteString("package main\n\n")
+	code.WriteString("import (\n\t\"fmt\"\n\t\"os\"\n\n")
+	code.WriteString(fmt.Sprintf("\t\"%sdevice\"\n", modulePath))
+	code.WriteString(fmt.Sprintf("\t\"%smotion\"\n", modulePath))
+	code.WriteString(fmt.Sprintf("\t\"%ssteps\"\n", modulePath))
+	if usesUIACC {
+		code.WriteString(fmt.Sprintf("\t\"%suiacc\"\n", modulePath))
+	}
+	if usesUtils {
+		code.WriteString(fmt.Sprintf("\t\"%sutils\"\n", modulePath))
+	}
+	code.WriteString(")\n\n")
+	code.WriteString("// 录制时的屏幕尺寸，回放时按当前设备的device.Width/Height等比换算坐标\n")
+	code.WriteString(fmt.Sprintf("const recordedWidth, recordedHeight = %d, %d\n\n", r.Screen.Width, r.Screen.Height))
+	code.WriteString("func main() {\n")
+	code.WriteString("\tfmt.Println(\"开始回放录制的操作...\")\n\n")
+	code.WriteString("\terr := steps.RunAll([]steps.Step{\n")
+	code.WriteString(body.String())
+	code.WriteString("\t})\n")
+	code.WriteString("\tif err != nil {\n")
+	code.WriteString("\t\tfmt.Printf(\"❌ %v\\n\", err)\n")
+	code.WriteString("\t\tos.Exit(1)\n")
+	code.WriteString("\t}\n\n")
+	code.WriteString("\tfmt.Println(\"回放完成\")\n")
+	code.WriteString("}\n\n")
+	code.WriteString("// sx 将录制时的横坐标换算到当前设备\n")
+	code.WriteString("func sx(x int) int {\n\tif device.Width == 0 {\n\t\treturn x\n\t}\n\treturn x * device.Width / recordedWidth\n}\n\n")
+	code.WriteString("// sy 将录制时的纵坐标换算到当前设备\n")
+	code.WriteString("func sy(y int) int {\n\tif device.Height == 0 {\n\t\treturn y\n\t}\n\treturn y * device.Height / recordedHeight\n}\n")
+
+	formatted, err := format.Source([]byte(code.String()))
+	if err != nil {
+		return code.String(), fmt.Errorf("格式化录制脚本失败: %w", err)
+	}
+	return string(formatted), nil
+}
+
+// step 返回手势对应的步骤名称和代码
+func (g Gesture) step() (string, string) {
+	var code bytes.Buffer
+	ms := g.Duration.Milliseconds()
+	switch g.Kind {
+	case GestureLongPress:
+		code.WriteString(fmt.Sprintf("\t\t\tmotion.LongClick(sx(%d), sy(%d), %d)\n", g.Start.X, g.Start.Y, ms))
+		return fmt.Sprintf("长按%s %dms", g.Start, ms), code.String()
+	case GestureSwipe:
+		code.WriteString(fmt.Sprintf("\t\t\tmotion.Swipe(sx(%d), sy(%d), sx(%d), sy(%d), %d)\n", g.Start.X, g.Start.Y, g.End.X, g.End.Y, ms))
+		return fmt.Sprintf("滑动%s→%s", g.Start, g.End), code.String()
+	}
+
+	click := fmt.Sprintf("motion.Click(sx(%d), sy(%d), 1)", g.Start.X, g.Start.Y)
+	if g.Selector == nil {
+		code.WriteString("\t\t\t" + click + "\n")
+		return fmt.Sprintf("点击%s", g.Start), code.String()
+	}
+	method := map[string]string{"text": "Text", "desc": "Desc", "id": "Id"}[g.Selector.By]
+	// 找不到控件时退回录制时的坐标
+	code.WriteString(fmt.Sprintf("\t\t\tif obj := uiacc.New().%s(%q).FindOnce(); obj != nil {\n", method, g.Selector.Value))
+	code.WriteString("\t\t\t\tobj.Click()\n")
+	code.WriteString("\t\t\t} else {\n")
+	code.WriteString("\t\t\t\t" + click + "\n")
+	code.WriteString("\t\t\t}\n")
+	return fmt.Sprintf("点击「%s」", g.Selector.Value), code.String()
+}
@@ -0,0 +1,260 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// recordedLog getevent -lp 加 getevent -lt 的输出：触摸屏坐标范围0-4095，
+// 依次为点击、长按和上滑，中间夹杂其他设备的按键事件
+const recordedLog = `add device 1: /dev/input/event0
+  name:     "gpio-keys"
+  events:
+    KEY (0001): KEY_VOLUMEDOWN        KEY_VOLUMEUP
+add device 2: /dev/input/event2
+  name:     "touchscreen"
+  events:
+    KEY (0001): BTN_TOUCH
+    ABS (0003): ABS_MT_SLOT           : value 0, min 0, max 9, fuzz 0, flat 0, resolution 0
+                ABS_MT_POSITION_X     : value 0, min 0, max 4095, fuzz 0, flat 0, resolution 0
+                ABS_MT_POSITION_Y     : value 0, min 0, max 4095, fuzz 0, flat 0, resolution 0
+                ABS_MT_TRACKING_ID    : value 0, min 0, max 65535, fuzz 0, flat 0, resolution 0
+[   100.000000] /dev/input/event2: EV_ABS       ABS_MT_TRACKING_ID   00000001
+[   100.000000] /dev/input/event2: EV_ABS       ABS_MT_POSITION_X    00000800
+[   100.000000] /dev/input/event2: EV_ABS       ABS_MT_POSITION_Y    00000800
+[   100.000000] /dev/input/event2: EV_KEY       BTN_TOUCH            DOWN
+[   100.000000] /dev/input/event2: EV_SYN       SYN_REPORT           00000000
+[   100.050000] /dev/input/event2: EV_ABS       ABS_MT_POSITION_X    00000802
+[   100.050000] /dev/input/event2: EV_SYN       SYN_REPORT           00000000
+[   100.100000] /dev/input/event2: EV_ABS       ABS_MT_TRACKING_ID   ffffffff
+[   100.100000] /dev/input/event2: EV_KEY       BTN_TOUCH            UP
+[   100.100000] /dev/input/event2: EV_SYN       SYN_REPORT           00000000
+[   101.000000] /dev/input/event0: EV_KEY       KEY_VOLUMEUP         DOWN
+[   101.000000] /dev/input/event0: EV_SYN       SYN_REPORT           00000000
+[   102.100000] /dev/input/event2: EV_ABS       ABS_MT_TRACKING_ID   00000002
+[   102.100000] /dev/input/event2: EV_ABS       ABS_MT_POSITION_X    00000400
+[   102.100000] /dev/input/event2: EV_ABS       ABS_MT_POSITION_Y    00000400
+[   102.100000] /dev/input/event2: EV_KEY       BTN_TOUCH            DOWN
+[   102.100000] /dev/input/event2: EV_SYN       SYN_REPORT           00000000
+[   102.900000] /dev/input/event2: EV_ABS       ABS_MT_TRACKING_ID   ffffffff
+[   102.900000] /dev/input/event2: EV_KEY       BTN_TOUCH            UP
+[   102.900000] /dev/input/event2: EV_SYN       SYN_REPORT           00000000
+[   103.400000] /dev/input/event2: EV_ABS       ABS_MT_TRACKING_ID   00000003
+[   103.400000] /dev/input/event2: EV_ABS       ABS_MT_POSITION_X    00000800
+[   103.400000] /dev/input/event2: EV_ABS       ABS_MT_POSITION_Y    00000c00
+[   103.400000] /dev/input/event2: EV_KEY       BTN_TOUCH            DOWN
+[   103.400000] /dev/input/event2: EV_SYN       SYN_REPORT           00000000
+[   103.500000] /dev/input/event2: EV_ABS       ABS_MT_SLOT          00000001
+[   103.500000] /dev/input/event2: EV_ABS       ABS_MT_TRACKING_ID   00000004
+[   103.500000] /dev/input/event2: EV_ABS       ABS_MT_POSITION_X    00000100
+[   103.500000] /dev/input/event2: EV_ABS       ABS_MT_SLOT          00000000
+[   103.500000] /dev/input/event2: EV_ABS       ABS_MT_POSITION_Y    00000800
+[   103.500000] /dev/input/event2: EV_SYN       SYN_REPORT           00000000
+[   103.700000] /dev/input/event2: EV_ABS       ABS_MT_POSITION_Y    00000400
+[   103.700000] /dev/input/event2: EV_SYN       SYN_REPORT           00000000
+[   103.700000] /dev/input/event2: EV_ABS       ABS_MT_TRACKING_ID   ffffffff
+[   103.700000] /dev/input/event2: EV_KEY       BTN_TOUCH            UP
+[   103.700000] /dev/input/event2: EV_SYN       SYN_REPORT           00000000
+`
+
+const recordedUI = `<?xml version='1.0' encoding='UTF-8' standalone='yes' ?>
+<hierarchy rotation="0">
+  <node index="0" text="" resource-id="" class="android.widget.FrameLayout" content-desc="" clickable="false" bounds="[0,0][1080,2340]">
+    <node index="0" text="" resource-id="com.example:id/form" class="android.widget.LinearLayout" content-desc="" clickable="false" bounds="[0,800][1080,1600]">
+      <node index="0" text="登录" resource-id="com.example:id/login" class="android.widget.Button" content-desc="" clickable="true" bounds="[340,1100][740,1240]" />
+      <node index="1" text="登录" resource-id="" class="android.widget.TextView" content-desc="" clickable="false" bounds="[0,200][1080,300]" />
+    </node>
+  </node>
+</hierarchy>`
+
+func TestParseTouchPanel(t *testing.T) {
+	panel, ok := ParseTouchPanel(recordedLog)
+	if !ok {
+		t.Fatal("touch panel not found")
+	}
+	want := TouchPanel{Device: "/dev/input/event2", X: TouchAxis{Max: 4095}, Y: TouchAxis{Max: 4095}}
+	if panel != want {
+		t.Errorf("panel = %+v, want %+v", panel, want)
+	}
+	if _, ok := ParseTouchPanel("add device 1: /dev/input/event0\n"); ok {
+		t.Error("found a touch panel without axes")
+	}
+}
+
+func TestParseScreenSize(t *testing.T) {
+	if size, err := ParseScreenSize(" 1080x2340\n"); err != nil || size != (ScreenSize{1080, 2340}) {
+		t.Errorf("ParseScreenSize = %v, %v", size, err)
+	}
+	for _, value := range []string{"", "1080", "0x100", "axb"} {
+		if _, err := ParseScreenSize(value); err == nil {
+			t.Errorf("ParseScreenSize(%q) should fail", value)
+		}
+	}
+}
+
+func TestReplayGetevent(t *testing.T) {
+	dump, err := ParseUIDump([]byte(recordedUI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seen int
+	recording, err := ReplayGetevent(strings.NewReader(recordedLog), RecordOptions{
+		Screen:    ScreenSize{Width: 1080, Height: 2340},
+		UIDump:    dump,
+		OnGesture: func(Gesture) { seen++ },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Gesture{
+		{Kind: GestureTap, Start: Point{540, 1170}, End: Point{540, 1170}, Duration: 100 * time.Millisecond,
+			Selector: &UISelector{By: "id", Value: "com.example:id/login"}},
+		{Kind: GestureLongPress, Start: Point{270, 585}, End: Point{270, 585}, At: 2100 * time.Millisecond,
+			Duration: 800 * time.Millisecond, Delay: 2000 * time.Millisecond},
+		{Kind: GestureSwipe, Start: Point{540, 1755}, End: Point{540, 585}, At: 3400 * time.Millisecond,
+			Duration: 300 * time.Millisecond, Delay: 500 * time.Millisecond},
+	}
+	if len(recording.Gestures) != len(want) || seen != len(want) {
+		t.Fatalf("got %d gestures (%d callbacks), want %d: %+v", len(recording.Gestures), seen, len(want), recording.Gestures)
+	}
+	for i, g := range recording.Gestures {
+		w := want[i]
+		if g.Kind != w.Kind || g.Start != w.Start || g.End != w.End ||
+			!closeTo(g.At, w.At) || !closeTo(g.Duration, w.Duration) || !closeTo(g.Delay, w.Delay) {
+			t.Errorf("gesture %d = %+v, want %+v", i+1, g, w)
+		}
+		if (g.Selector == nil) != (w.Selector == nil) || g.Selector != nil && *g.Selector != *w.Selector {
+			t.Errorf("gesture %d selector = %+v, want %+v", i+1, g.Selector, w.Selector)
+		}
+	}
+
+	code, err := recording.Script()
+	if err != nil {
+		t.Fatal(err)
+	}
+	diags, err := NewScriptValidator(newTestKnowledgeBase(t), findModuleRoot(".")).Validate(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diags) > 0 {
+		t.Fatalf("recorded script has diagnostics:\n%s\n%s", FormatDiagnostics(diags), code)
+	}
+	for _, call := range []string{
+		"const recordedWidth, recordedHeight = 1080, 2340",
+		`uiacc.New().Id("com.example:id/login").FindOnce()`,
+		"motion.Click(sx(540), sy(1170), 1)",
+		"utils.Sleep(2000)",
+		"motion.LongClick(sx(270), sy(585), 800)",
+		"motion.Swipe(sx(540), sy(1755), sx(540), sy(585), 300)",
+	} {
+		if !strings.Contains(code, call) {
+			t.Errorf("recorded script missing %q:\n%s", call, code)
+		}
+	}
+}
+
+func TestReplayGeteventWithoutPanel(t *testing.T) {
+	log := recordedLog[strings.Index(recordedLog, "["):]
+	if _, err := ReplayGetevent(strings.NewReader(log), RecordOptions{}); err == nil {
+		t.Error("replay without a panel or screen size should fail")
+	}
+	recording, err := ReplayGetevent(strings.NewReader(log), RecordOptions{Screen: ScreenSize{4096, 4096}})
+	if err != nil || len(recording.Gestures) != 3 || recording.Gestures[0].Start != (Point{2048, 2048}) {
+		t.Errorf("raw replay = %+v, %v", recording, err)
+	}
+}
+
+func TestSelectorAt(t *testing.T) {
+	dump, err := ParseUIDump([]byte(recordedUI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := dump.SelectorAt(Point{500, 250}); s != nil {
+		t.Errorf("duplicate text without id resolved to %+v", s)
+	}
+	if s := dump.SelectorAt(Point{100, 900}); s == nil || *s != (UISelector{By: "id", Value: "com.example:id/form"}) {
+		t.Errorf("layout selector = %+v", s)
+	}
+	if s := (*UIDump)(nil).SelectorAt(Point{}); s != nil {
+		t.Errorf("nil dump selector = %+v", s)
+	}
+}
+
+// blockingDumps 返回一个导出函数：第n次导出写入只有“界面n”文字的控件树，并等待release后才结束
+func blockingDumps(release <-chan struct{}) (func(ctx context.Context, path string) error, *int32) {
+	var calls int32
+	return func(ctx context.Context, path string) error {
+		n := atomic.AddInt32(&calls, 1)
+		<-release
+		xml := fmt.Sprintf(`<hierarchy><node text="界面%d" resource-id="" content-desc="" bounds="[0,0][1080,2340]" /></hierarchy>`, n)
+		return os.WriteFile(path, []byte(xml), 0644)
+	}, &calls
+}
+
+// screenAt 返回控件树在屏幕中央解析出的文字
+func screenAt(dump *UIDump) string {
+	if s := dump.SelectorAt(Point{500, 500}); s != nil {
+		return s.Value
+	}
+	return ""
+}
+
+func TestUIDumperWaitsForDumpAfterGesture(t *testing.T) {
+	ctx := context.Background()
+	release := make(chan struct{})
+	dumpUI, calls := blockingDumps(release)
+	d := newUIDumper(dumpUI, t.TempDir())
+
+	d.refresh(ctx)
+	release <- struct{}{}
+	d.wait()
+	if got := screenAt(d.since(time.Time{})); got != "界面1" {
+		t.Fatalf("initial screen = %q", got)
+	}
+
+	// 手势后的导出进行中时，点击等待这次导出而不是使用上一个界面
+	gesture := time.Now()
+	d.refresh(ctx)
+	resolved := make(chan string)
+	go func() { resolved <- screenAt(d.since(gesture)) }()
+	select {
+	case got := <-resolved:
+		t.Fatalf("tap resolved against %q before the pending dump finished", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+	release <- struct{}{}
+	if got := <-resolved; got != "界面2" {
+		t.Errorf("tap resolved against %q, want 界面2", got)
+	}
+
+	// 导出期间又有手势时，结束后再导出一次
+	d.refresh(ctx)
+	gesture = time.Now()
+	d.refresh(ctx)
+	release <- struct{}{}
+	release <- struct{}{}
+	d.wait()
+	if n := atomic.LoadInt32(calls); n != 4 {
+		t.Errorf("dumped %d times, want 4", n)
+	}
+	if got := screenAt(d.since(gesture)); got != "界面4" {
+		t.Errorf("tap after the second gesture resolved against %q, want 界面4", got)
+	}
+
+	// 没有手势之后的控件树时不解析为控件
+	if dump := d.since(time.Now()); dump != nil {
+		t.Errorf("stale dump used: %q", screenAt(dump))
+	}
+}
+
+// closeTo 比较由浮点时间戳换算出的时长
+func closeTo(a, b time.Duration) bool {
+	d := a - b
+	return d > -time.Millisecond && d < time.Millisecond
+}
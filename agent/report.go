@@ -5,23 +5,48 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 )
 
 // TestReport 自动化测试报告
 type TestReport struct {
-	Query            string        `json:"query"`
-	CodePath         string        `json:"code_path"`
-	BinaryPath       string        `json:"binary_path"`
-	CompileOutput    string        `json:"compile_output"`
-	ExecutionOutput  string        `json:"execution_output"`
-	ExecutionError   string        `json:"execution_error,omitempty"`
-	Success          bool          `json:"success"`
-	Duration         time.Duration `json:"duration"`
-	Timestamp        time.Time     `json:"timestamp"`
-	AutoExecuted     bool          `json:"auto_executed"`
-	AndroidDeviceLog string        `json:"android_device_log,omitempty"`
+	Query            string         `json:"query"`
+	CodePath         string         `json:"code_path"`
+	BinaryPath       string         `json:"binary_path"`
+	CompileOutput    string         `json:"compile_output"`
+	ExecutionOutput  string         `json:"execution_output"`
+	ExecutionError   string         `json:"execution_error,omitempty"`
+	Success          bool           `json:"success"`
+	Duration         time.Duration  `json:"duration"`
+	Timestamp        time.Time      `json:"timestamp"`
+	AutoExecuted     bool           `json:"auto_executed"`
+	AndroidDeviceLog string         `json:"android_device_log,omitempty"`
+	BuildAttempts    []BuildAttempt `json:"build_attempts,omitempty"`
+	BuildEnv         []string       `json:"build_env,omitempty"`
+	BuildCommand     string         `json:"build_command,omitempty"`
+	Screenshots      []string       `json:"screenshots,omitempty"`
+	UIDumps          []string       `json:"ui_dumps,omitempty"`
+	ExitCode         *int           `json:"exit_code,omitempty"`
+	ExitReason       string         `json:"exit_reason,omitempty"`
+	Steps            []StepResult   `json:"steps,omitempty"`
+	Cache            *CacheInfo     `json:"cache,omitempty"`
+	RunDir           string         `json:"run_dir,omitempty"`
+	DeviceResults    []DeviceResult `json:"device_results,omitempty"`
+	// GenerationFallback LLM生成失败、改用模板生成的原因
+	GenerationFallback string `json:"generation_fallback,omitempty"`
+}
+
+// BuildAttempt 一次编译尝试，首次编译之后的尝试都使用LLM修复后的代码
+type BuildAttempt struct {
+	Attempt     int    `json:"attempt"`
+	Code        string `json:"code"`
+	Diagnostics string `json:"diagnostics,omitempty"`
+	// ValidationDiagnostics 编译前静态检查发现的问题
+	ValidationDiagnostics []Diagnostic `json:"validation_diagnostics,omitempty"`
+	Success               bool         `json:"success"`
+	RepairError           string       `json:"repair_error,omitempty"`
 }
 
 // Save 保存报告
@@ -29,18 +54,85 @@ func (r *TestReport) Save(reportDir string) (string, error) {
 	if err := os.MkdirAll(reportDir, 0755); err != nil {
 		return "", err
 	}
-	filename := fmt.Sprintf("report-%s.json", r.Timestamp.Format("20060102-150405"))
-	path := filepath.Join(reportDir, filename)
-
 	data, err := json.MarshalIndent(r, "", "  ")
 	if err != nil {
 		return "", err
 	}
 
-	if err := os.WriteFile(path, data, 0644); err != nil {
-		return "", err
+	// 同一秒内的多份报告追加序号，避免并发执行时互相覆盖
+	stamp := r.Timestamp.Format("20060102-150405")
+	for seq := 1; ; seq++ {
+		filename := fmt.Sprintf("report-%s.json", stamp)
+		if seq > 1 {
+			filename = fmt.Sprintf("report-%s-%d.json", stamp, seq)
+		}
+		path := filepath.Join(reportDir, filename)
+
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		_, err = file.Write(data)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return "", err
+		}
+		return path, nil
+	}
+}
+
+// ReportSummary 报告列表中的摘要信息
+type ReportSummary struct {
+	Name      string        `json:"name"`
+	Query     string        `json:"query"`
+	Success   bool          `json:"success"`
+	Duration  time.Duration `json:"duration"`
+	Timestamp time.Time     `json:"timestamp"`
+}
+
+// LoadReport 读取JSON报告
+func LoadReport(path string) (*TestReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var report TestReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// ListReports 列出报告目录中的报告，按时间倒序
+func ListReports(reportDir string) ([]ReportSummary, error) {
+	paths, err := filepath.Glob(filepath.Join(reportDir, "report-*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]ReportSummary, 0, len(paths))
+	for _, path := range paths {
+		report, err := LoadReport(path)
+		if err != nil {
+			continue
+		}
+		summaries = append(summaries, ReportSummary{
+			Name:      filepath.Base(path),
+			Query:     report.Query,
+			Success:   report.Success,
+			Duration:  report.Duration,
+			Timestamp: report.Timestamp,
+		})
 	}
-	return path, nil
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Timestamp.After(summaries[j].Timestamp)
+	})
+	return summaries, nil
 }
 
 // Markdown 返回Markdown格式报告
@@ -50,24 +142,97 @@ func (r *TestReport) Markdown() string {
 	builder.WriteString(fmt.Sprintf("- 时间: %s\n", r.Timestamp.Format("2006-01-02 15:04:05")))
 	builder.WriteString(fmt.Sprintf("- 查询: %s\n", r.Query))
 	builder.WriteString(fmt.Sprintf("- 耗时: %v\n", r.Duration))
-	builder.WriteString(fmt.Sprintf("- 结果: %s\n\n", map[bool]string{true: "✅ 成功", false: "❌ 失败"}[r.Success]))
+	builder.WriteString(fmt.Sprintf("- 结果: %s\n", map[bool]string{true: "✅ 成功", false: "❌ 失败"}[r.Success]))
+	if r.ExitCode != nil {
+		builder.WriteString(fmt.Sprintf("- 退出码: %d（%s）\n", *r.ExitCode, r.ExitReason))
+	}
+	builder.WriteString("\n")
 
+	if r.RunDir != "" {
+		builder.WriteString(fmt.Sprintf("**执行目录**: `%s`\n\n", r.RunDir))
+	}
 	if r.CodePath != "" {
 		builder.WriteString(fmt.Sprintf("**代码文件**: `%s`\n\n", r.CodePath))
 	}
 	if r.BinaryPath != "" {
 		builder.WriteString(fmt.Sprintf("**二进制文件**: `%s`\n\n", r.BinaryPath))
 	}
+	if r.BuildCommand != "" {
+		builder.WriteString(fmt.Sprintf("**编译命令**: `%s`\n\n", r.BuildCommand))
+	}
+	if r.Cache != nil && (r.Cache.CodeHit || r.Cache.BinaryHit) {
+		builder.WriteString(fmt.Sprintf("**缓存**: %s\n\n", r.Cache))
+	}
+	if r.GenerationFallback != "" {
+		builder.WriteString(fmt.Sprintf("**模板生成**: LLM生成失败，%s\n\n", r.GenerationFallback))
+	}
 	if r.CompileOutput != "" {
 		builder.WriteString("## 编译输出\n```\n" + r.CompileOutput + "\n```\n\n")
 	}
+	if len(r.BuildAttempts) > 1 {
+		builder.WriteString("## 编译修复记录\n\n")
+		for _, attempt := range r.BuildAttempts {
+			builder.WriteString(fmt.Sprintf("### 第%d次编译: %s\n\n", attempt.Attempt, map[bool]string{true: "✅ 成功", false: "❌ 失败"}[attempt.Success]))
+			if attempt.Diagnostics != "" {
+				builder.WriteString("```\n" + attempt.Diagnostics + "\n```\n\n")
+			}
+			if attempt.RepairError != "" {
+				builder.WriteString(fmt.Sprintf("修复失败: %s\n\n", attempt.RepairError))
+			}
+		}
+	}
+	if len(r.Steps) > 0 {
+		builder.WriteString("## 测试步骤\n\n| 步骤 | 名称 | 结果 | 耗时 | 说明 |\n|---|---|---|---|---|\n")
+		for _, step := range r.Steps {
+			builder.WriteString(fmt.Sprintf("| %d | %s | %s | %v | %s |\n", step.Index, step.Name, stepStatusIcon(step.Status), step.Duration, step.Message))
+			for _, assertion := range step.Assertions {
+				builder.WriteString(fmt.Sprintf("|  | 断言 | %s |  | %s |\n", map[bool]string{true: "✅", false: "❌"}[assertion.Passed], assertion.Message))
+			}
+		}
+		builder.WriteString("\n")
+	}
+	if len(r.DeviceResults) > 0 {
+		builder.WriteString("## 设备执行结果\n\n| 设备 | 型号 | 结果 | 退出码 | 耗时 | 错误 |\n|---|---|---|---|---|---|\n")
+		for _, dr := range r.DeviceResults {
+			exitCode := "-"
+			if dr.ExitCode != nil {
+				exitCode = fmt.Sprint(*dr.ExitCode)
+			}
+			builder.WriteString(fmt.Sprintf("| %s | %s | %s | %s | %v | %s |\n", dr.Device.Serial, dr.Device.Model,
+				map[bool]string{true: "✅", false: "❌"}[dr.Success], exitCode, dr.Duration.Round(time.Millisecond), dr.Error))
+		}
+		builder.WriteString("\n")
+	}
 	if r.ExecutionOutput != "" {
 		builder.WriteString("## 执行输出\n```\n" + r.ExecutionOutput + "\n```\n\n")
 	}
 	if r.ExecutionError != "" {
 		builder.WriteString("## 错误信息\n```\n" + r.ExecutionError + "\n```\n\n")
 	}
+	if r.AndroidDeviceLog != "" {
+		builder.WriteString("## 设备日志\n```\n" + r.AndroidDeviceLog + "\n```\n\n")
+	}
+	if len(r.Screenshots) > 0 || len(r.UIDumps) > 0 {
+		builder.WriteString("## 现场证据\n\n")
+		for _, path := range r.Screenshots {
+			builder.WriteString(fmt.Sprintf("- 截图: `%s`\n", path))
+		}
+		for _, path := range r.UIDumps {
+			builder.WriteString(fmt.Sprintf("- 界面控件树: `%s`\n", path))
+		}
+		builder.WriteString("\n")
+	}
 
 	return builder.String()
 }
 
+// stepStatusIcon 步骤状态对应的图标
+func stepStatusIcon(status string) string {
+	switch status {
+	case "pass":
+		return "✅"
+	case "fail":
+		return "❌"
+	}
+	return "⚠️ 未完成"
+}
@@ -0,0 +1,380 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ReportFormat 报告输出格式
+type ReportFormat string
+
+const (
+	FormatJSON     ReportFormat = "json"
+	FormatJUnit    ReportFormat = "junit"
+	FormatHTML     ReportFormat = "html"
+	FormatMarkdown ReportFormat = "markdown"
+)
+
+// formatExt 各格式的文件扩展名
+var formatExt = map[ReportFormat]string{
+	FormatJSON:     ".json",
+	FormatJUnit:    ".xml",
+	FormatHTML:     ".html",
+	FormatMarkdown: ".md",
+}
+
+// ParseReportFormats 解析逗号分隔的格式列表，如 "json,junit,html"
+func ParseReportFormats(value string) ([]ReportFormat, error) {
+	var formats []ReportFormat
+	seen := make(map[ReportFormat]bool)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" {
+			continue
+		}
+		format := ReportFormat(item)
+		if item == "md" {
+			format = FormatMarkdown
+		} else if item == "xml" {
+			format = FormatJUnit
+		}
+		if _, ok := formatExt[format]; !ok {
+			return nil, fmt.Errorf("不支持的报告格式: %s（可选 json, junit, html, markdown）", item)
+		}
+		if !seen[format] {
+			seen[format] = true
+			formats = append(formats, format)
+		}
+	}
+	return formats, nil
+}
+
+// SaveFormats 保存JSON报告，并在同目录下以相同文件名写出其他格式，返回所有文件路径
+func (r *TestReport) SaveFormats(reportDir string, formats []ReportFormat) ([]string, error) {
+	jsonPath, err := r.Save(reportDir)
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{jsonPath}
+	base := strings.TrimSuffix(jsonPath, ".json")
+
+	for _, format := range formats {
+		var data []byte
+		switch format {
+		case FormatJSON:
+			continue
+		case FormatJUnit:
+			data, err = r.JUnit()
+		case FormatHTML:
+			data, err = r.HTML()
+		case FormatMarkdown:
+			data = []byte(r.Markdown())
+		}
+		if err != nil {
+			return paths, err
+		}
+		path := base + formatExt[format]
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// finalCode 返回最终编译的代码
+func (r *TestReport) finalCode() string {
+	if len(r.BuildAttempts) > 0 {
+		return r.BuildAttempts[len(r.BuildAttempts)-1].Code
+	}
+	if r.CodePath != "" {
+		if data, err := os.ReadFile(r.CodePath); err == nil {
+			return string(data)
+		}
+	}
+	return ""
+}
+
+// failureMessage 返回失败原因的简要描述
+func (r *TestReport) failureMessage() string {
+	if r.ExecutionError != "" {
+		return r.ExecutionError
+	}
+	if len(r.BuildAttempts) > 0 && !r.BuildAttempts[len(r.BuildAttempts)-1].Success {
+		return "编译失败"
+	}
+	return "测试失败"
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Time     float64          `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Time      float64         `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr,omitempty"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+	SystemErr string        `xml:"system-err,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Body    string `xml:",chardata"`
+}
+
+// junitSuite 将单份报告转换为只含一个用例的testsuite
+func (r *TestReport) junitSuite() junitTestSuite {
+	suite := junitTestSuite{
+		Name:      "genie.agent",
+		Time:      r.Duration.Seconds(),
+		Timestamp: r.Timestamp.Format("2006-01-02T15:04:05"),
+	}
+	// 脚本上报了步骤时每个步骤对应一个testcase，看板可以直接定位失败的步骤
+	for _, step := range r.Steps {
+		tc := junitTestCase{
+			Name:      fmt.Sprintf("步骤%d: %s", step.Index, step.Name),
+			ClassName: "genie.agent." + r.Query,
+			Time:      step.Duration.Seconds(),
+		}
+		if step.Status != "pass" {
+			message := step.Message
+			if step.Status == StepIncomplete {
+				message = "步骤未完成（进程异常退出或超时）"
+			}
+			tc.Failure = &junitFailure{Message: firstLine(message), Body: message}
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+	if len(r.Steps) == 0 || (!r.Success && FailedStep(r.Steps) == nil) {
+		tc := junitTestCase{
+			Name:      r.Query,
+			ClassName: "genie.agent",
+			Time:      r.Duration.Seconds(),
+			SystemOut: r.ExecutionOutput,
+			SystemErr: r.CompileOutput,
+		}
+		if !r.Success {
+			tc.Failure = &junitFailure{
+				Message: firstLine(r.failureMessage()),
+				Body:    r.failureMessage(),
+			}
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+	suite.Tests = len(suite.Cases)
+	for _, tc := range suite.Cases {
+		if tc.Failure != nil {
+			suite.Failures++
+		}
+	}
+	return suite
+}
+
+// JUnit 返回JUnit XML格式报告
+func (r *TestReport) JUnit() ([]byte, error) {
+	return junitXML(junitTestSuites{Suites: []junitTestSuite{r.junitSuite()}})
+}
+
+// JUnit 返回JUnit XML格式的套件汇总，每条用例对应一个testcase
+func (s *SuiteSummary) JUnit() ([]byte, error) {
+	suite := junitTestSuite{
+		Name:      s.Suite,
+		Tests:     s.Total,
+		Failures:  s.Failed,
+		Time:      s.Duration.Seconds(),
+		Timestamp: s.StartedAt.Format("2006-01-02T15:04:05"),
+	}
+	for _, r := range s.Results {
+		tc := junitTestCase{
+			Name:      r.Name,
+			ClassName: "genie.suite." + s.Suite,
+			Time:      r.Duration.Seconds(),
+			SystemOut: fmt.Sprintf("query: %s\nreport: %s", r.Query, r.ReportPath),
+		}
+		if !r.Passed {
+			message := fmt.Sprintf("预期 %s，实际 %s", r.Expect, map[bool]string{true: "pass", false: "fail"}[r.Success])
+			tc.Failure = &junitFailure{Message: message, Body: r.Error}
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+	return junitXML(junitTestSuites{Suites: []junitTestSuite{suite}})
+}
+
+func junitXML(suites junitTestSuites) ([]byte, error) {
+	for _, s := range suites.Suites {
+		suites.Tests += s.Tests
+		suites.Failures += s.Failures
+		suites.Time += s.Time
+	}
+	data, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
+
+func firstLine(s string) string {
+	if idx := strings.Index(s, "\n"); idx != -1 {
+		return s[:idx]
+	}
+	return s
+}
+
+// htmlScreenshot 内嵌到HTML中的截图
+type htmlScreenshot struct {
+	Name string
+	Data template.URL
+}
+
+var reportHTMLTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>测试报告 - {{.Report.Query}}</title>
+<style>
+body { font-family: -apple-system, "PingFang SC", "Microsoft YaHei", sans-serif; margin: 2em auto; max-width: 1000px; color: #222; }
+h1 { font-size: 1.6em; }
+h2 { font-size: 1.2em; border-bottom: 1px solid #ddd; padding-bottom: .3em; margin-top: 1.6em; }
+table.meta td { padding: .2em 1em .2em 0; vertical-align: top; }
+pre { background: #f6f8fa; padding: 1em; overflow-x: auto; white-space: pre-wrap; word-break: break-all; }
+.success { color: #1a7f37; font-weight: bold; }
+.failure { color: #cf222e; font-weight: bold; }
+img { max-width: 100%; border: 1px solid #ddd; margin: .5em 0; }
+</style>
+</head>
+<body>
+<h1>测试报告</h1>
+<table class="meta">
+<tr><td>查询</td><td>{{.Report.Query}}</td></tr>
+<tr><td>结果</td><td>{{if .Report.Success}}<span class="success">✅ 成功</span>{{else}}<span class="failure">❌ 失败</span>{{end}}</td></tr>
+<tr><td>时间</td><td>{{.Report.Timestamp.Format "2006-01-02 15:04:05"}}</td></tr>
+<tr><td>耗时</td><td>{{.Report.Duration}}</td></tr>
+{{with .Report.ExitCode}}<tr><td>退出码</td><td>{{.}}（{{$.Report.ExitReason}}）</td></tr>{{end}}
+{{if .Report.BuildCommand}}<tr><td>编译命令</td><td><code>{{.Report.BuildCommand}}</code></td></tr>{{end}}
+{{with .Report.Cache}}{{if or .CodeHit .BinaryHit}}<tr><td>缓存</td><td>{{.}}</td></tr>{{end}}{{end}}
+{{with .Report.GenerationFallback}}<tr><td>模板生成</td><td>LLM生成失败，{{.}}</td></tr>{{end}}
+</table>
+{{if .Code}}<h2>测试代码</h2>
+<pre>{{.Code}}</pre>{{end}}
+{{if .Report.CompileOutput}}<h2>编译输出</h2>
+<pre>{{.Report.CompileOutput}}</pre>{{end}}
+{{if gt (len .Report.BuildAttempts) 1}}<h2>编译修复记录</h2>
+{{range .Report.BuildAttempts}}<h3>第{{.Attempt}}次编译: {{if .Success}}<span class="success">成功</span>{{else}}<span class="failure">失败</span>{{end}}</h3>
+{{if .Diagnostics}}<pre>{{.Diagnostics}}</pre>{{end}}{{if .RepairError}}<p>修复失败: {{.RepairError}}</p>{{end}}
+{{end}}{{end}}
+{{if .Report.Steps}}<h2>测试步骤</h2>
+<table>
+<tr><th>步骤</th><th>名称</th><th>结果</th><th>耗时</th><th>说明</th></tr>
+{{range .Report.Steps}}<tr><td>{{.Index}}</td><td>{{.Name}}</td><td>{{if eq .Status "pass"}}<span class="success">通过</span>{{else if eq .Status "fail"}}<span class="failure">失败</span>{{else}}<span class="failure">未完成</span>{{end}}</td><td>{{.Duration}}</td><td>{{.Message}}{{range .Assertions}}<br>{{if .Passed}}✅{{else}}❌{{end}} {{.Message}}{{end}}</td></tr>
+{{end}}</table>{{end}}
+{{if .Report.DeviceResults}}<h2>设备执行结果</h2>
+<table>
+<tr><th>设备</th><th>型号</th><th>结果</th><th>退出码</th><th>耗时</th><th>错误</th></tr>
+{{range .Report.DeviceResults}}<tr><td>{{.Device.Serial}}</td><td>{{.Device.Model}}</td><td>{{if .Success}}<span class="success">成功</span>{{else}}<span class="failure">失败</span>{{end}}</td><td>{{with .ExitCode}}{{.}}{{else}}-{{end}}</td><td>{{.Duration}}</td><td>{{.Error}}</td></tr>
+{{end}}</table>{{end}}
+{{if .Report.ExecutionOutput}}<h2>执行输出</h2>
+<pre>{{.Report.ExecutionOutput}}</pre>{{end}}
+{{if .Report.ExecutionError}}<h2>错误信息</h2>
+<pre>{{.Report.ExecutionError}}</pre>{{end}}
+{{if .Report.AndroidDeviceLog}}<h2>设备日志</h2>
+<pre>{{.Report.AndroidDeviceLog}}</pre>{{end}}
+{{if .Screenshots}}<h2>截图</h2>
+{{range .Screenshots}}<figure><img src="{{.Data}}" alt="{{.Name}}"><figcaption>{{.Name}}</figcaption></figure>
+{{end}}{{end}}
+{{if .Report.UIDumps}}<h2>界面控件树</h2>
+<ul>{{range .Report.UIDumps}}<li><code>{{.}}</code></li>{{end}}</ul>{{end}}
+</body>
+</html>
+`))
+
+// HTML 返回自包含的HTML报告，代码、输出和截图都内嵌在文件中
+func (r *TestReport) HTML() ([]byte, error) {
+	var screenshots []htmlScreenshot
+	for _, path := range r.Screenshots {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		mimeType := mime.TypeByExtension(filepath.Ext(path))
+		if mimeType == "" {
+			mimeType = "image/png"
+		}
+		screenshots = append(screenshots, htmlScreenshot{
+			Name: filepath.Base(path),
+			Data: template.URL("data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data)),
+		})
+	}
+
+	var buf bytes.Buffer
+	err := reportHTMLTemplate.Execute(&buf, struct {
+		Report      *TestReport
+		Code        string
+		Screenshots []htmlScreenshot
+	}{r, r.finalCode(), screenshots})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var suiteHTMLTemplate = template.Must(template.New("suite").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>测试套件汇总 - {{.Suite}}</title>
+<style>
+body { font-family: -apple-system, "PingFang SC", "Microsoft YaHei", sans-serif; margin: 2em auto; max-width: 1000px; color: #222; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border: 1px solid #ddd; padding: .4em .6em; text-align: left; vertical-align: top; }
+pre { margin: 0; white-space: pre-wrap; word-break: break-all; }
+.success { color: #1a7f37; font-weight: bold; }
+.failure { color: #cf222e; font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>测试套件汇总: {{.Suite}}</h1>
+<ul>
+<li>时间: {{.StartedAt.Format "2006-01-02 15:04:05"}}</li>
+<li>耗时: {{.Duration}}</li>
+<li>并发: {{.Parallel}}</li>
+<li>结果: 共 {{.Total}} 条，通过 {{.Passed}} 条，失败 {{.Failed}} 条</li>
+</ul>
+<table>
+<tr><th>用例</th><th>查询</th><th>预期</th><th>结果</th><th>耗时</th><th>错误</th></tr>
+{{range .Results}}<tr><td>{{.Name}}</td><td>{{.Query}}</td><td>{{.Expect}}</td><td>{{if .Passed}}<span class="success">✅ 通过</span>{{else}}<span class="failure">❌ 失败</span>{{end}}</td><td>{{.Duration}}</td><td>{{if .Error}}<pre>{{.Error}}</pre>{{end}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// HTML 返回自包含的HTML格式套件汇总
+func (s *SuiteSummary) HTML() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := suiteHTMLTemplate.Execute(&buf, s); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,69 @@
+package agent
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseReportFormats(t *testing.T) {
+	formats, err := ParseReportFormats("json, junit,HTML,md,xml")
+	if err != nil {
+		t.Fatalf("ParseReportFormats: %v", err)
+	}
+	want := []ReportFormat{FormatJSON, FormatJUnit, FormatHTML, FormatMarkdown}
+	if len(formats) != len(want) {
+		t.Fatalf("got %v, want %v", formats, want)
+	}
+	for i := range want {
+		if formats[i] != want[i] {
+			t.Errorf("formats[%d] = %s, want %s", i, formats[i], want[i])
+		}
+	}
+	if _, err := ParseReportFormats("pdf"); err == nil {
+		t.Error("ParseReportFormats accepted an unknown format")
+	}
+}
+
+func TestReportSaveFormats(t *testing.T) {
+	dir := t.TempDir()
+	shot := filepath.Join(dir, "screen.png")
+	if err := os.WriteFile(shot, []byte("\x89PNG fake"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report := &TestReport{
+		Query:          "点击登录按钮",
+		CompileOutput:  "undefined: foo <bar>",
+		ExecutionError: "步骤 1 失败",
+		Timestamp:      time.Now(),
+		BuildAttempts:  []BuildAttempt{{Attempt: 1, Code: "package main\n\nfunc main() {}\n", Success: true}},
+		Screenshots:    []string{shot},
+	}
+	paths, err := report.SaveFormats(filepath.Join(dir, "reports"), []ReportFormat{FormatJSON, FormatJUnit, FormatHTML})
+	if err != nil {
+		t.Fatalf("SaveFormats: %v", err)
+	}
+	if len(paths) != 3 || !strings.HasSuffix(paths[0], ".json") {
+		t.Fatalf("SaveFormats returned %v", paths)
+	}
+
+	data, _ := os.ReadFile(paths[1])
+	var suites junitTestSuites
+	if err := xml.Unmarshal(data, &suites); err != nil {
+		t.Fatalf("invalid JUnit XML: %v\n%s", err, data)
+	}
+	if suites.Tests != 1 || suites.Failures != 1 || suites.Suites[0].Cases[0].Failure == nil {
+		t.Errorf("unexpected JUnit result: %+v", suites)
+	}
+
+	html, _ := os.ReadFile(paths[2])
+	for _, want := range []string{"func main()", "undefined: foo &lt;bar&gt;", "data:image/png;base64,", "步骤 1 失败"} {
+		if !strings.Contains(string(html), want) {
+			t.Errorf("HTML report missing %q", want)
+		}
+	}
+}
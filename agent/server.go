@@ -0,0 +1,354 @@
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server 通过HTTP JSON API提供Agent能力，每个会话拥有独立的、持久化的对话记忆
+type Server struct {
+	agent *Agent
+
+	mu       sync.Mutex
+	sessions map[string]*ConversationMemory
+}
+
+// NewServer 创建HTTP服务
+func NewServer(agent *Agent) *Server {
+	return &Server{
+		agent:    agent,
+		sessions: make(map[string]*ConversationMemory),
+	}
+}
+
+// QueryRequest 查询请求
+type QueryRequest struct {
+	Query     string `json:"query"`
+	SessionID string `json:"session_id,omitempty"`
+}
+
+// QueryResponse 查询响应
+type QueryResponse struct {
+	SessionID string      `json:"session_id"`
+	Result    *TestResult `json:"result,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// StreamEvent 流式查询接口按行输出的事件，Type为 token、result 或 error
+type StreamEvent struct {
+	Type      string      `json:"type"`
+	SessionID string      `json:"session_id,omitempty"`
+	Token     string      `json:"token,omitempty"`
+	Result    *TestResult `json:"result,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// Handler 返回API路由
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/query", s.handleQuery)
+	mux.HandleFunc("POST /api/query/stream", s.handleQueryStream)
+	mux.HandleFunc("GET /api/kb/search", s.handleSearch)
+	mux.HandleFunc("GET /api/reports", s.handleListReports)
+	mux.HandleFunc("GET /api/reports/{name}", s.handleGetReport)
+	mux.HandleFunc("GET /api/history", s.handleHistory)
+	mux.HandleFunc("GET /api/history/trends", s.handleHistoryTrends)
+	mux.HandleFunc("GET /api/history/flaky", s.handleHistoryTrends)
+	mux.HandleFunc("GET /api/history/{id}", s.handleHistoryReport)
+	mux.HandleFunc("DELETE /api/sessions/{id}", s.handleDeleteSession)
+	return mux
+}
+
+// ListenAndServe 启动服务，ctx取消时优雅关闭
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return srv.Shutdown(shutdownCtx)
+	}
+}
+
+// decodeQuery 解析并校验查询请求，失败时已写出错误响应
+func decodeQuery(w http.ResponseWriter, r *http.Request) (QueryRequest, bool) {
+	var req QueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("请求格式错误: %v", err))
+		return req, false
+	}
+	req.Query = strings.TrimSpace(req.Query)
+	if req.Query == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("query不能为空"))
+		return req, false
+	}
+	return req, true
+}
+
+func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeQuery(w, r)
+	if !ok {
+		return
+	}
+
+	sessionID, memory := s.session(req.SessionID)
+	if err := memory.AddMessageContext(r.Context(), "user", req.Query); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("保存对话记忆失败: %v", err))
+		return
+	}
+
+	result, err := s.agent.Run(r.Context(), req.Query, memory.ContextString())
+	rememberResult(r.Context(), memory, result, err)
+	resp := QueryResponse{SessionID: sessionID, Result: result}
+	if err != nil {
+		resp.Error = err.Error()
+		status := http.StatusInternalServerError
+		var timeoutErr *TimeoutError
+		if errors.As(err, &timeoutErr) {
+			status = http.StatusGatewayTimeout
+		}
+		writeJSON(w, status, resp)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleQueryStream 以NDJSON流式返回LLM生成的片段，最后输出执行结果；
+// 客户端断开连接时请求ctx被取消，生成和后续阶段随之停止
+func (s *Server) handleQueryStream(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeQuery(w, r)
+	if !ok {
+		return
+	}
+
+	sessionID, memory := s.session(req.SessionID)
+	if err := memory.AddMessageContext(r.Context(), "user", req.Query); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("保存对话记忆失败: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	send := func(event StreamEvent) {
+		event.SessionID = sessionID
+		encoder.Encode(event)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	ctx := WithTokenFunc(r.Context(), func(token string) {
+		send(StreamEvent{Type: "token", Token: token})
+	})
+	result, err := s.agent.Run(ctx, req.Query, memory.ContextString())
+	rememberResult(r.Context(), memory, result, err)
+	if err != nil {
+		send(StreamEvent{Type: "error", Result: result, Error: err.Error()})
+		return
+	}
+	send(StreamEvent{Type: "result", Result: result})
+}
+
+// rememberResult 将执行结果写入会话记忆。结果已经产生，写入失败时只记录日志
+func rememberResult(ctx context.Context, memory *ConversationMemory, result *TestResult, err error) {
+	if err := memory.AddMessageContext(ctx, "assistant", ResultMemory(result, err)); err != nil {
+		fmt.Printf("[Agent] 保存对话记忆失败: %v\n", err)
+	}
+}
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("缺少参数q"))
+		return
+	}
+	limit := 10
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("limit必须为正整数"))
+			return
+		}
+		limit = n
+	}
+
+	docs, err := s.agent.kb.Search(query, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if docs == nil {
+		docs = []APIDoc{}
+	}
+	writeJSON(w, http.StatusOK, docs)
+}
+
+func (s *Server) handleListReports(w http.ResponseWriter, r *http.Request) {
+	reports, err := ListReports(s.agent.reportDir)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, reports)
+}
+
+func (s *Server) handleGetReport(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if name != filepath.Base(name) || !strings.HasSuffix(name, ".json") {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("无效的报告名称: %s", name))
+		return
+	}
+
+	report, err := LoadReport(filepath.Join(s.agent.reportDir, name))
+	if err != nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("报告不存在: %s", name))
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	filter, err := historyFilterFromQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	entries, err := s.agent.history.List(filter)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+func (s *Server) handleHistoryTrends(w http.ResponseWriter, r *http.Request) {
+	filter, err := historyFilterFromQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var trends []QueryTrend
+	if strings.HasSuffix(r.URL.Path, "/flaky") {
+		trends, err = s.agent.history.Flaky(filter)
+	} else {
+		trends, err = s.agent.history.Trends(filter)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, trends)
+}
+
+func (s *Server) handleHistoryReport(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("无效的记录ID: %s", r.PathValue("id")))
+		return
+	}
+	report, err := s.agent.history.Get(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// historyFilterFromQuery 从URL参数解析历史过滤条件：q, hash, status, since, until, limit
+func historyFilterFromQuery(r *http.Request) (HistoryFilter, error) {
+	values := r.URL.Query()
+	filter := HistoryFilter{
+		Query:     values.Get("q"),
+		QueryHash: values.Get("hash"),
+		Status:    values.Get("status"),
+	}
+	var err error
+	if filter.Since, err = ParseHistoryDate(values.Get("since")); err != nil {
+		return filter, err
+	}
+	if filter.Until, err = ParseHistoryDate(values.Get("until")); err != nil {
+		return filter, err
+	}
+	if v := values.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return filter, fmt.Errorf("limit必须为正整数")
+		}
+		filter.Limit = n
+	}
+	return filter, nil
+}
+
+func (s *Server) handleDeleteSession(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	s.mu.Lock()
+	delete(s.sessions, id)
+	s.mu.Unlock()
+	if err := s.agent.memory.Delete(id); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// session 返回会话记忆，ID为空时创建新会话；服务重启后按ID从对话记忆库恢复
+func (s *Server) session(id string) (string, *ConversationMemory) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id == "" {
+		id = newSessionID()
+	}
+	memory, ok := s.sessions[id]
+	if !ok {
+		var err error
+		if memory, err = s.agent.NewMemory(id); err != nil {
+			fmt.Printf("[Agent] %v\n", err)
+			memory = NewConversationMemory(s.agent.options.MemoryBudget)
+		}
+		s.sessions[id] = memory
+	}
+	return id, memory
+}
+
+func newSessionID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(buf)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
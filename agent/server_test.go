@@ -0,0 +1,80 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestServer(t *testing.T) (*Server, *Agent) {
+	t.Helper()
+	dir := t.TempDir()
+	ag, err := NewAgentWithOptions(filepath.Join(dir, "kb.db"), AgentConfig{
+		WorkspaceDir: filepath.Join(dir, "workspace"),
+		ReportDir:    filepath.Join(dir, "reports"),
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewAgentWithOptions: %v", err)
+	}
+	t.Cleanup(func() { ag.Close() })
+	return NewServer(ag), ag
+}
+
+func TestServerSearchAndReports(t *testing.T) {
+	srv, ag := newTestServer(t)
+	handler := srv.Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/kb/search?q=click", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("search status = %d: %s", rec.Code, rec.Body)
+	}
+	var docs []APIDoc
+	if err := json.Unmarshal(rec.Body.Bytes(), &docs); err != nil || len(docs) == 0 {
+		t.Fatalf("search returned %s (err %v)", rec.Body, err)
+	}
+
+	report := &TestReport{Query: "点击登录按钮", Success: true, Timestamp: time.Now()}
+	path, err := report.Save(ag.reportDir)
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/reports", nil))
+	var summaries []ReportSummary
+	if err := json.Unmarshal(rec.Body.Bytes(), &summaries); err != nil || len(summaries) != 1 {
+		t.Fatalf("list reports returned %s (err %v)", rec.Body, err)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/reports/"+filepath.Base(path), nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "点击登录按钮") {
+		t.Fatalf("get report status = %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/reports/missing.json", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("missing report status = %d, want 404", rec.Code)
+	}
+}
+
+func TestServerQueryValidation(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/query", strings.NewReader(`{"query": "  "}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("empty query status = %d, want 400", rec.Code)
+	}
+
+	id, first := srv.session("")
+	if _, again := srv.session(id); again != first {
+		t.Error("session memory not reused for the same ID")
+	}
+}
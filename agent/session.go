@@ -0,0 +1,189 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 工作目录中的会话和脚本目录
+const (
+	sessionsDir = "sessions"
+	scriptsDir  = "scripts"
+	// AutosaveSession 每轮对话后自动保存的会话名，启动时据此恢复
+	AutosaveSession = "autosave"
+)
+
+// SessionTurn 会话中的一轮执行
+type SessionTurn struct {
+	Query      string        `json:"query"`
+	Code       string        `json:"code,omitempty"`
+	Success    bool          `json:"success"`
+	Error      string        `json:"error,omitempty"`
+	ReportPath string        `json:"report_path,omitempty"`
+	Duration   time.Duration `json:"duration"`
+	Timestamp  time.Time     `json:"timestamp"`
+}
+
+// Session 对话会话，包括执行记录和会话中切换的设置，对话记忆按ID保存在对话记忆库中
+type Session struct {
+	ID          string        `json:"id"`
+	Turns       []SessionTurn `json:"turns"`
+	Devices     DeviceFilter  `json:"devices"`
+	Model       string        `json:"model,omitempty"`
+	AutoExecute bool          `json:"auto_execute"`
+	SavedAt     time.Time     `json:"saved_at"`
+}
+
+// LastTurn 返回最近一次生成了代码的执行
+func (s *Session) LastTurn() *SessionTurn {
+	for i := len(s.Turns) - 1; i >= 0; i-- {
+		if s.Turns[i].Code != "" {
+			return &s.Turns[i]
+		}
+	}
+	return nil
+}
+
+// LastReport 返回最近一次执行的报告路径
+func (s *Session) LastReport() string {
+	for i := len(s.Turns) - 1; i >= 0; i-- {
+		if s.Turns[i].ReportPath != "" {
+			return s.Turns[i].ReportPath
+		}
+	}
+	return ""
+}
+
+// AddResult 记录一次执行的结果
+func (s *Session) AddResult(query string, result *TestResult) {
+	turn := SessionTurn{Query: query, Timestamp: time.Now()}
+	if result != nil {
+		turn.Code = result.Code
+		turn.Success = result.Success
+		turn.Error = result.Error
+		turn.ReportPath = result.ReportPath
+		turn.Duration = result.Duration
+		turn.Timestamp = result.Timestamp
+	}
+	s.Turns = append(s.Turns, turn)
+}
+
+// SessionStore 保存在工作目录中的会话和命名脚本
+type SessionStore struct {
+	dir string
+}
+
+// NewSessionStore 创建会话存储，会话保存在 <workspace>/sessions，脚本保存在 <workspace>/scripts
+func NewSessionStore(workspaceDir string) *SessionStore {
+	return &SessionStore{dir: workspaceDir}
+}
+
+// Save 保存会话
+func (s *SessionStore) Save(name string, session *Session) (string, error) {
+	path, err := s.path(sessionsDir, name, ".json")
+	if err != nil {
+		return "", err
+	}
+	session.SavedAt = time.Now()
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return path, writeFileAtomic(path, data, 0644)
+}
+
+// Load 读取会话，会话不存在时返回的错误满足os.IsNotExist
+func (s *SessionStore) Load(name string) (*Session, error) {
+	path, err := s.path(sessionsDir, name, ".json")
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("解析会话 %s 失败: %w", name, err)
+	}
+	return &session, nil
+}
+
+// Delete 删除会话，会话不存在时不报错
+func (s *SessionStore) Delete(name string) error {
+	path, err := s.path(sessionsDir, name, ".json")
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Sessions 列出保存的会话名
+func (s *SessionStore) Sessions() ([]string, error) {
+	return s.list(sessionsDir, ".json")
+}
+
+// SaveScript 以名称保存脚本
+func (s *SessionStore) SaveScript(name, code string) (string, error) {
+	path, err := s.path(scriptsDir, name, ".go")
+	if err != nil {
+		return "", err
+	}
+	return path, writeFileAtomic(path, []byte(code), 0644)
+}
+
+// LoadScript 读取保存的脚本
+func (s *SessionStore) LoadScript(name string) (string, error) {
+	path, err := s.path(scriptsDir, name, ".go")
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("没有名为 %s 的脚本", name)
+		}
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Scripts 列出保存的脚本名
+func (s *SessionStore) Scripts() ([]string, error) {
+	return s.list(scriptsDir, ".go")
+}
+
+// path 返回名称对应的文件路径，名称不能包含路径
+func (s *SessionStore) path(sub, name, ext string) (string, error) {
+	name = strings.TrimSuffix(strings.TrimSpace(name), ext)
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("无效的名称: %q", name)
+	}
+	return filepath.Join(s.dir, sub, name+ext), nil
+}
+
+func (s *SessionStore) list(sub, ext string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(s.dir, sub))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ext) && !strings.HasPrefix(entry.Name(), ".") {
+			names = append(names, strings.TrimSuffix(entry.Name(), ext))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
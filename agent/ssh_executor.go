@@ -0,0 +1,136 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SSHConfig SSH执行后端的连接配置
+type SSHConfig struct {
+	Target  string   // user@host 或 ~/.ssh/config 中的主机名
+	Port    int      // 0使用默认端口
+	KeyFile string   // 私钥文件，为空时使用ssh默认配置
+	Options []string // 额外的 -o 选项，如 StrictHostKeyChecking=no
+}
+
+// SSHExecutor 通过SSH在远程设备或主机上执行测试二进制，如运行sshd的已root设备或开发板
+type SSHExecutor struct {
+	Config    SSHConfig
+	RemoteDir string
+	SSHPath   string
+	SCPPath   string
+	// KeepBinary 执行结束后保留远程的二进制
+	KeepBinary bool
+}
+
+// NewSSHExecutor 创建SSH执行器
+func NewSSHExecutor(cfg SSHConfig, remoteDir string) *SSHExecutor {
+	if remoteDir == "" {
+		remoteDir = "/tmp"
+	}
+	return &SSHExecutor{
+		Config:    cfg,
+		RemoteDir: remoteDir,
+		SSHPath:   "ssh",
+		SCPPath:   "scp",
+	}
+}
+
+// sshABIs uname -m 到安卓ABI名称的映射，用于按ABI筛选目标
+var sshABIs = map[string]string{
+	"aarch64": "arm64-v8a",
+	"arm64":   "arm64-v8a",
+	"armv7l":  "armeabi-v7a",
+	"armv8l":  "armeabi-v7a",
+	"x86_64":  "x86_64",
+	"i686":    "x86",
+}
+
+// Devices 检查连接并返回唯一的执行目标
+func (e *SSHExecutor) Devices(ctx context.Context) ([]Device, error) {
+	output, err := e.shell(ctx, "uname -m; uname -n").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("ssh连接%s失败: %w: %s", e.Config.Target, err, strings.TrimSpace(string(output)))
+	}
+	fields := strings.Fields(string(output))
+	device := Device{Serial: e.Config.Target, State: "device"}
+	if len(fields) > 0 {
+		device.ABI = sshABIs[fields[0]]
+	}
+	if len(fields) > 1 {
+		device.Model = fields[1]
+	}
+	return []Device{device}, nil
+}
+
+// ForDevice SSH后端只有一个目标，返回自身
+func (e *SSHExecutor) ForDevice(serial string) Executor {
+	return e
+}
+
+// Push 通过scp上传二进制并添加执行权限，返回远程路径
+func (e *SSHExecutor) Push(ctx context.Context, localBinary string) (string, string, error) {
+	remoteBinary := path.Join(e.RemoteDir, filepath.Base(localBinary))
+
+	args := e.options("-P")
+	args = append(args, localBinary, e.Config.Target+":"+remoteBinary)
+	scpCmd := exec.CommandContext(ctx, e.SCPPath, args...)
+	scpCmd.WaitDelay = 5 * time.Second
+	if output, err := scpCmd.CombinedOutput(); err != nil {
+		return "", string(output), fmt.Errorf("scp上传失败: %w", err)
+	}
+
+	if output, err := e.shell(ctx, "chmod +x "+shellQuote(remoteBinary)).CombinedOutput(); err != nil {
+		return "", string(output), fmt.Errorf("ssh chmod失败: %w", err)
+	}
+	return remoteBinary, "", nil
+}
+
+// Run 在远程运行二进制，ctx取消时结束远程的进程树
+func (e *SSHExecutor) Run(ctx context.Context, remoteBinary string) (string, error) {
+	return runShellBinary(ctx, e.shell, "ssh", remoteBinary, func(ctx context.Context) error {
+		return killProcesses(ctx, e.shell, remoteBinary)
+	})
+}
+
+// Cleanup 结束残留的远程进程，未设置KeepBinary时删除上传的二进制
+func (e *SSHExecutor) Cleanup(ctx context.Context, remoteBinary string) error {
+	ctx = context.WithoutCancel(ctx)
+	if err := killProcesses(ctx, e.shell, remoteBinary); err != nil {
+		return err
+	}
+	if e.KeepBinary {
+		return nil
+	}
+	return removeFile(ctx, e.shell, remoteBinary)
+}
+
+// options 返回ssh和scp共用的参数，portFlag为端口参数名（ssh为-p，scp为-P）
+func (e *SSHExecutor) options(portFlag string) []string {
+	// BatchMode 避免等待密码输入导致执行卡住
+	args := []string{"-o", "BatchMode=yes"}
+	for _, opt := range e.Config.Options {
+		args = append(args, "-o", opt)
+	}
+	if e.Config.Port > 0 {
+		args = append(args, portFlag, strconv.Itoa(e.Config.Port))
+	}
+	if e.Config.KeyFile != "" {
+		args = append(args, "-i", e.Config.KeyFile)
+	}
+	return args
+}
+
+// shell 通过ssh在远程执行脚本
+func (e *SSHExecutor) shell(ctx context.Context, script string) *exec.Cmd {
+	args := append(e.options("-p"), e.Config.Target, script)
+	cmd := exec.CommandContext(ctx, e.SSHPath, args...)
+	cmd.WaitDelay = 5 * time.Second
+	return cmd
+}
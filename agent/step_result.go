@@ -0,0 +1,112 @@
+package agent
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/xiaocainiao633/Genie1.0--/steps"
+)
+
+// StepIncomplete 步骤已开始但没有结束事件，通常是进程崩溃、被结束或超时
+const StepIncomplete = "incomplete"
+
+// StepResult 脚本通过steps包上报的单个步骤结果
+type StepResult struct {
+	Index       int               `json:"index"`
+	Name        string            `json:"name"`
+	Status      string            `json:"status"` // pass, fail, incomplete
+	Message     string            `json:"message,omitempty"`
+	Duration    time.Duration     `json:"duration"`
+	Assertions  []AssertionResult `json:"assertions,omitempty"`
+	Screenshots []string          `json:"screenshots,omitempty"`
+}
+
+// AssertionResult 步骤中的一次断言
+type AssertionResult struct {
+	Message string `json:"message"`
+	Passed  bool   `json:"passed"`
+}
+
+// ParseStepEvents 从脚本输出中解析步骤事件，返回去掉事件行后的输出和按顺序排列的步骤结果。
+// 不使用steps包的脚本没有事件，原样返回输出。在steps.Run之外的断言和截图不属于任何步骤，
+// 以普通文本行保留在输出中。
+func ParseStepEvents(output string) (string, []StepResult) {
+	if !strings.Contains(output, steps.EventPrefix) {
+		return output, nil
+	}
+
+	var plain strings.Builder
+	var results []StepResult
+	index := make(map[int]int) // 步骤序号 -> results下标
+	stepFor := func(event steps.Event) *StepResult {
+		i, ok := index[event.Step]
+		if !ok {
+			results = append(results, StepResult{Index: event.Step, Name: event.Name, Status: StepIncomplete})
+			i = len(results) - 1
+			index[event.Step] = i
+		}
+		return &results[i]
+	}
+
+	for _, line := range strings.SplitAfter(output, "\n") {
+		pos := strings.Index(line, steps.EventPrefix)
+		if pos < 0 {
+			plain.WriteString(line)
+			continue
+		}
+		// 事件前的内容是脚本未换行的普通输出
+		if pos > 0 {
+			plain.WriteString(line[:pos] + "\n")
+		}
+		var event steps.Event
+		if err := json.Unmarshal([]byte(strings.TrimSpace(line[pos+len(steps.EventPrefix):])), &event); err != nil {
+			plain.WriteString(line[pos:])
+			continue
+		}
+		if event.Step == 0 {
+			plain.WriteString(runLevelEvent(event))
+			continue
+		}
+		switch event.Type {
+		case steps.EventStepStart:
+			stepFor(event)
+		case steps.EventStepEnd:
+			step := stepFor(event)
+			step.Status = event.Status
+			step.Message = event.Message
+			step.Duration = time.Duration(event.DurationMs) * time.Millisecond
+		case steps.EventAssert:
+			step := stepFor(event)
+			step.Assertions = append(step.Assertions, AssertionResult{Message: event.Message, Passed: event.Status == steps.StatusPass})
+		case steps.EventScreenshot:
+			step := stepFor(event)
+			step.Screenshots = append(step.Screenshots, event.Path)
+		}
+	}
+	return plain.String(), results
+}
+
+// runLevelEvent 将步骤之外的事件转换为输出中的文本行
+func runLevelEvent(event steps.Event) string {
+	switch event.Type {
+	case steps.EventAssert:
+		if event.Status == steps.StatusPass {
+			return "断言通过: " + event.Message + "\n"
+		}
+		return "断言失败: " + event.Message + "\n"
+	case steps.EventScreenshot:
+		return "截图: " + event.Path + "\n"
+	}
+	return ""
+}
+
+// FailedStep 返回第一个失败或未完成的步骤，全部通过时返回nil
+func FailedStep(results []StepResult) *StepResult {
+	for i := range results {
+		if results[i].Status != steps.StatusPass {
+			return &results[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xiaocainiao633/Genie1.0--/steps"
+)
+
+// stepOutput 用steps包生成一段脚本输出：第一步通过，第二步断言失败，第三步开始后进程崩溃
+func stepOutput(t *testing.T) string {
+	t.Helper()
+	var buf bytes.Buffer
+	steps.SetOutput(&buf)
+	t.Cleanup(func() { steps.SetOutput(nil) })
+
+	buf.WriteString("启动测试\n")
+	err := steps.RunAll([]steps.Step{
+		{Name: "启动应用", Run: func() error {
+			buf.WriteString("应用已启动\n")
+			steps.Screenshot("/sdcard/step1.png")
+			return steps.Assert(true, "找到按钮: %s", "登录")
+		}},
+		{Name: "验证首页", Run: func() error {
+			return steps.Assert(false, "首页标题为 %q", "首页")
+		}},
+	})
+	if err == nil {
+		t.Fatal("RunAll should return the failing step's error")
+	}
+	buf.WriteString("进度") // 未换行的普通输出后紧跟事件
+	steps.Run("退出应用", func() error { return nil })
+	out := buf.String()
+	// 去掉最后一个步骤的结束事件，模拟进程中途崩溃
+	return out[:strings.LastIndex(out, steps.EventPrefix)]
+}
+
+func TestParseStepEvents(t *testing.T) {
+	plain, results := ParseStepEvents(stepOutput(t))
+
+	if strings.Contains(plain, steps.EventPrefix) {
+		t.Errorf("plain output still contains events:\n%s", plain)
+	}
+	if plain != "启动测试\n应用已启动\n进度\n" {
+		t.Errorf("plain = %q", plain)
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %d steps, want 3: %+v", len(results), results)
+	}
+
+	first := results[0]
+	if first.Index != 1 || first.Name != "启动应用" || first.Status != steps.StatusPass {
+		t.Errorf("step 1 = %+v", first)
+	}
+	if len(first.Assertions) != 1 || !first.Assertions[0].Passed || first.Assertions[0].Message != "找到按钮: 登录" {
+		t.Errorf("step 1 assertions = %+v", first.Assertions)
+	}
+	if len(first.Screenshots) != 1 || first.Screenshots[0] != "/sdcard/step1.png" {
+		t.Errorf("step 1 screenshots = %v", first.Screenshots)
+	}
+
+	second := results[1]
+	if second.Status != steps.StatusFail || !strings.Contains(second.Message, "断言失败") {
+		t.Errorf("step 2 = %+v", second)
+	}
+	if len(second.Assertions) != 1 || second.Assertions[0].Passed {
+		t.Errorf("step 2 assertions = %+v", second.Assertions)
+	}
+
+	if results[2].Name != "退出应用" || results[2].Status != StepIncomplete {
+		t.Errorf("step 3 = %+v, want incomplete", results[2])
+	}
+	if failed := FailedStep(results); failed == nil || failed.Index != 2 {
+		t.Errorf("FailedStep = %+v, want step 2", failed)
+	}
+}
+
+func TestParseStepEventsWithoutEvents(t *testing.T) {
+	output := "plain output\n"
+	plain, results := ParseStepEvents(output)
+	if plain != output || results != nil {
+		t.Errorf("ParseStepEvents = %q, %v", plain, results)
+	}
+	if FailedStep(nil) != nil {
+		t.Error("FailedStep(nil) should be nil")
+	}
+}
+
+func TestStepsPanic(t *testing.T) {
+	var buf bytes.Buffer
+	steps.SetOutput(&buf)
+	defer steps.SetOutput(nil)
+
+	err := steps.Run("崩溃", func() error { panic("boom") })
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("Run = %v, want panic error", err)
+	}
+	_, results := ParseStepEvents(buf.String())
+	if len(results) != 1 || results[0].Status != steps.StatusFail {
+		t.Errorf("results = %+v", results)
+	}
+}
+
+func TestJUnitSteps(t *testing.T) {
+	report := &TestReport{
+		Query:     "登录",
+		Timestamp: time.Now(),
+		Steps: []StepResult{
+			{Index: 1, Name: "启动应用", Status: steps.StatusPass, Duration: time.Second},
+			{Index: 2, Name: "验证首页", Status: steps.StatusFail, Message: "断言失败: 首页标题"},
+			{Index: 3, Name: "退出应用", Status: StepIncomplete},
+		},
+	}
+	data, err := report.JUnit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var suites junitTestSuites
+	if err := xml.Unmarshal(data, &suites); err != nil {
+		t.Fatalf("invalid JUnit XML: %v", err)
+	}
+	suite := suites.Suites[0]
+	if suite.Tests != 3 || suite.Failures != 2 {
+		t.Errorf("tests=%d failures=%d, want 3 and 2", suite.Tests, suite.Failures)
+	}
+	if suite.Cases[0].Name != "步骤1: 启动应用" || suite.Cases[0].Failure != nil {
+		t.Errorf("case 1 = %+v", suite.Cases[0])
+	}
+	if suite.Cases[2].Failure == nil || !strings.Contains(suite.Cases[2].Failure.Message, "未完成") {
+		t.Errorf("case 3 = %+v", suite.Cases[2])
+	}
+}
+
+func TestPipelineSteps(t *testing.T) {
+	fake := NewFakeExecutor(nil, FakeRun{Output: stepOutput(t), Err: errors.New("signal: killed")})
+	result, report, err := runPipeline(t, newPipelineAgent(t, fake, nil))
+	if err != nil || result.Success {
+		t.Fatalf("Run = %+v, %v", result, err)
+	}
+	if len(result.Steps) != 3 || len(report.Steps) != 3 {
+		t.Fatalf("steps = %d, report %d, want 3", len(result.Steps), len(report.Steps))
+	}
+	if strings.Contains(report.ExecutionOutput, steps.EventPrefix) {
+		t.Errorf("report output still contains events: %q", report.ExecutionOutput)
+	}
+	if want := fmt.Sprintf("步骤 %d「%s」失败", 2, "验证首页"); !strings.Contains(result.Error, want) {
+		t.Errorf("error = %q, want it to name the failing step", result.Error)
+	}
+}
+
+func TestPipelineAssertOutsideSteps(t *testing.T) {
+	var buf bytes.Buffer
+	steps.SetOutput(&buf)
+	t.Cleanup(func() { steps.SetOutput(nil) })
+	steps.Assert(true, "应用已安装")
+	steps.Run("启动应用", func() error { return nil })
+	steps.Screenshot("/sdcard/done.png")
+
+	fake := NewFakeExecutor(nil, FakeRun{Output: buf.String()})
+	result, report, err := runPipeline(t, newPipelineAgent(t, fake, nil))
+	if err != nil || !result.Success {
+		t.Fatalf("Run = %+v, %v", result, err)
+	}
+	if len(report.Steps) != 1 || report.Steps[0].Index != 1 || report.Steps[0].Status != steps.StatusPass {
+		t.Fatalf("steps = %+v, want only the passing step 1", report.Steps)
+	}
+	if !strings.Contains(report.ExecutionOutput, "断言通过: 应用已安装") || !strings.Contains(report.ExecutionOutput, "截图: /sdcard/done.png") {
+		t.Errorf("run-level events missing from output: %q", report.ExecutionOutput)
+	}
+
+	data, err := report.JUnit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var suites junitTestSuites
+	if err := xml.Unmarshal(data, &suites); err != nil {
+		t.Fatalf("invalid JUnit XML: %v", err)
+	}
+	if suite := suites.Suites[0]; suite.Tests != 1 || suite.Failures != 0 {
+		t.Errorf("tests=%d failures=%d, want 1 and 0", suite.Tests, suite.Failures)
+	}
+	if md := report.Markdown(); strings.Contains(md, "未完成") {
+		t.Errorf("markdown reports an incomplete step:\n%s", md)
+	}
+}
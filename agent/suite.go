@@ -0,0 +1,244 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SuiteCase 测试套件中的一条用例
+type SuiteCase struct {
+	Name   string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Query  string   `json:"query" yaml:"query"`
+	Tags   []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Expect string   `json:"expect,omitempty" yaml:"expect,omitempty"` // pass（默认）或 fail
+}
+
+// expectSuccess 用例是否期望执行成功
+func (c SuiteCase) expectSuccess() bool {
+	return !strings.EqualFold(c.Expect, "fail")
+}
+
+// HasAnyTag 用例是否包含任一标签，tags为空时视为匹配
+func (c SuiteCase) HasAnyTag(tags []string) bool {
+	if len(tags) == 0 {
+		return true
+	}
+	for _, want := range tags {
+		for _, tag := range c.Tags {
+			if strings.EqualFold(tag, want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// LoadSuite 读取测试套件，支持 .jsonl（每行一条用例）和 .yaml/.yml
+func LoadSuite(path string) ([]SuiteCase, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cases []SuiteCase
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl":
+		scanner := bufio.NewScanner(strings.NewReader(string(data)))
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" || strings.HasPrefix(text, "#") {
+				continue
+			}
+			var c SuiteCase
+			if err := json.Unmarshal([]byte(text), &c); err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+			}
+			cases = append(cases, c)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	case ".yaml", ".yml":
+		var doc struct {
+			Cases []SuiteCase `yaml:"cases"`
+		}
+		if err := yaml.Unmarshal(data, &doc); err == nil && len(doc.Cases) > 0 {
+			cases = doc.Cases
+		} else if err := yaml.Unmarshal(data, &cases); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("不支持的套件格式: %s（支持 .jsonl, .yaml, .yml）", path)
+	}
+
+	for i := range cases {
+		cases[i].Query = strings.TrimSpace(cases[i].Query)
+		if cases[i].Query == "" {
+			return nil, fmt.Errorf("%s: 第%d条用例缺少query", path, i+1)
+		}
+		if cases[i].Name == "" {
+			cases[i].Name = fmt.Sprintf("case-%d", i+1)
+		}
+	}
+	return cases, nil
+}
+
+// SuiteCaseResult 单条用例的执行结果
+type SuiteCaseResult struct {
+	Name       string        `json:"name"`
+	Query      string        `json:"query"`
+	Tags       []string      `json:"tags,omitempty"`
+	Expect     string        `json:"expect"`
+	Success    bool          `json:"success"` // Agent执行是否成功
+	Passed     bool          `json:"passed"`  // 执行结果是否符合预期
+	Error      string        `json:"error,omitempty"`
+	Duration   time.Duration `json:"duration"`
+	ReportPath string        `json:"report_path,omitempty"`
+}
+
+// SuiteSummary 测试套件汇总
+type SuiteSummary struct {
+	Suite     string            `json:"suite"`
+	StartedAt time.Time         `json:"started_at"`
+	Duration  time.Duration     `json:"duration"`
+	Parallel  int               `json:"parallel"`
+	Total     int               `json:"total"`
+	Passed    int               `json:"passed"`
+	Failed    int               `json:"failed"`
+	Results   []SuiteCaseResult `json:"results"`
+}
+
+// RunSuite 以指定并发度执行套件中的用例，结果顺序与用例顺序一致
+func (a *Agent) RunSuite(ctx context.Context, suite string, cases []SuiteCase, parallel int) *SuiteSummary {
+	if parallel <= 0 {
+		parallel = 1
+	}
+	summary := &SuiteSummary{
+		Suite:     suite,
+		StartedAt: time.Now(),
+		Parallel:  parallel,
+		Total:     len(cases),
+		Results:   make([]SuiteCaseResult, len(cases)),
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				summary.Results[i] = a.runSuiteCase(ctx, cases[i])
+			}
+		}()
+	}
+	for i := range cases {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, r := range summary.Results {
+		if r.Passed {
+			summary.Passed++
+		} else {
+			summary.Failed++
+		}
+	}
+	summary.Duration = time.Since(summary.StartedAt)
+	return summary
+}
+
+func (a *Agent) runSuiteCase(ctx context.Context, c SuiteCase) SuiteCaseResult {
+	result := SuiteCaseResult{
+		Name:   c.Name,
+		Query:  c.Query,
+		Tags:   c.Tags,
+		Expect: map[bool]string{true: "pass", false: "fail"}[c.expectSuccess()],
+	}
+
+	start := time.Now()
+	fmt.Printf("[Suite] 开始执行用例 %s: %s\n", c.Name, c.Query)
+	testResult, err := a.Run(ctx, c.Query, "")
+	result.Duration = time.Since(start)
+	if testResult != nil {
+		result.Success = testResult.Success
+		result.Error = testResult.Error
+		result.ReportPath = testResult.ReportPath
+	}
+	if err != nil {
+		result.Success = false
+		result.Error = err.Error()
+	}
+	result.Passed = result.Success == c.expectSuccess()
+	return result
+}
+
+// Save 保存套件汇总的JSON和Markdown文件，并按formats写出JUnit等其他格式，返回JSON路径
+func (s *SuiteSummary) Save(reportDir string, formats ...ReportFormat) (string, error) {
+	if err := os.MkdirAll(reportDir, 0755); err != nil {
+		return "", err
+	}
+	base := filepath.Join(reportDir, fmt.Sprintf("suite-%s", s.StartedAt.Format("20060102-150405")))
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(base+".json", data, 0644); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(base+".md", []byte(s.Markdown()), 0644); err != nil {
+		return "", err
+	}
+	for _, format := range formats {
+		var data []byte
+		switch format {
+		case FormatJUnit:
+			data, err = s.JUnit()
+		case FormatHTML:
+			data, err = s.HTML()
+		default:
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(base+formatExt[format], data, 0644); err != nil {
+			return "", err
+		}
+	}
+	return base + ".json", nil
+}
+
+// Markdown 返回Markdown格式的汇总
+func (s *SuiteSummary) Markdown() string {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("# 测试套件汇总: %s\n\n", s.Suite))
+	builder.WriteString(fmt.Sprintf("- 时间: %s\n", s.StartedAt.Format("2006-01-02 15:04:05")))
+	builder.WriteString(fmt.Sprintf("- 耗时: %v\n", s.Duration))
+	builder.WriteString(fmt.Sprintf("- 并发: %d\n", s.Parallel))
+	builder.WriteString(fmt.Sprintf("- 结果: 共 %d 条，通过 %d 条，失败 %d 条\n\n", s.Total, s.Passed, s.Failed))
+
+	builder.WriteString("| 用例 | 预期 | 结果 | 耗时 | 报告 |\n")
+	builder.WriteString("| --- | --- | --- | --- | --- |\n")
+	for _, r := range s.Results {
+		status := map[bool]string{true: "✅ 通过", false: "❌ 失败"}[r.Passed]
+		report := "-"
+		if r.ReportPath != "" {
+			report = fmt.Sprintf("[%s](%s)", filepath.Base(r.ReportPath), filepath.Base(r.ReportPath))
+		}
+		builder.WriteString(fmt.Sprintf("| %s | %s | %s | %v | %s |\n", r.Name, r.Expect, status, r.Duration.Round(time.Millisecond), report))
+	}
+	return builder.String()
+}
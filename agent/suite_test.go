@@ -0,0 +1,57 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadSuite(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"smoke.jsonl": `{"name": "login", "query": "点击登录按钮", "tags": ["smoke"]}
+# comment
+{"query": "验证页面出现'主页'", "expect": "fail"}
+`,
+		"smoke.yaml": `cases:
+  - name: login
+    query: 点击登录按钮
+    tags: [smoke]
+  - query: 验证页面出现'主页'
+    expect: fail
+`,
+		"list.yml": `- name: login
+  query: 点击登录按钮
+  tags: [smoke]
+- query: 验证页面出现'主页'
+  expect: fail
+`,
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		cases, err := LoadSuite(path)
+		if err != nil {
+			t.Fatalf("LoadSuite(%s): %v", name, err)
+		}
+		if len(cases) != 2 {
+			t.Fatalf("LoadSuite(%s) returned %d cases, want 2", name, len(cases))
+		}
+		if cases[0].Name != "login" || !cases[0].HasAnyTag([]string{"SMOKE"}) || !cases[0].expectSuccess() {
+			t.Errorf("%s: unexpected first case %+v", name, cases[0])
+		}
+		if cases[1].Name != "case-2" || cases[1].expectSuccess() || cases[1].HasAnyTag([]string{"smoke"}) {
+			t.Errorf("%s: unexpected second case %+v", name, cases[1])
+		}
+	}
+
+	bad := filepath.Join(dir, "bad.jsonl")
+	os.WriteFile(bad, []byte(`{"name": "empty"}`+"\n"), 0644)
+	if _, err := LoadSuite(bad); err == nil {
+		t.Error("LoadSuite accepted a case without query")
+	}
+}
@@ -0,0 +1,291 @@
+package agent
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// modulePath AutoGo模块路径前缀
+const modulePath = "github.com/xiaocainiao633/Genie1.0--/"
+
+// Diagnostic 静态检查发现的问题
+type Diagnostic struct {
+	Severity string `json:"severity"` // error, warning
+	Kind     string `json:"kind"`     // syntax, unknown-module, unknown-function, arg-count, unused-import
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Message  string `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s: %s", d.Line, d.Column, d.Severity, d.Message)
+}
+
+// HasErrors 是否存在错误级别的问题
+func HasErrors(diags []Diagnostic) bool {
+	for _, d := range diags {
+		if d.Severity == "error" {
+			return true
+		}
+	}
+	return false
+}
+
+// FormatDiagnostics 格式化诊断信息，可直接展示给用户或交给LLM
+func FormatDiagnostics(diags []Diagnostic) string {
+	var builder strings.Builder
+	for _, d := range diags {
+		builder.WriteString(d.String() + "\n")
+	}
+	return builder.String()
+}
+
+// ScriptValidator 在编译前对照知识库检查生成脚本调用的AutoGo API
+type ScriptValidator struct {
+	kb         *KnowledgeBase
+	moduleRoot string // 本地模块根目录，用于确认包是否存在，为空时只依据知识库
+}
+
+// NewScriptValidator 创建校验器
+func NewScriptValidator(kb *KnowledgeBase, moduleRoot string) *ScriptValidator {
+	return &ScriptValidator{kb: kb, moduleRoot: moduleRoot}
+}
+
+// apiSignature 函数签名中的参数信息
+type apiSignature struct {
+	params   int
+	variadic bool
+}
+
+// Validate 解析代码并检查语法、AutoGo API调用、参数个数和未使用的导入
+func (v *ScriptValidator) Validate(code string) ([]Diagnostic, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "generated.go", code, 0)
+	if err != nil {
+		if list, ok := err.(scanner.ErrorList); ok {
+			var diags []Diagnostic
+			for _, e := range list {
+				diags = append(diags, Diagnostic{
+					Severity: "error",
+					Kind:     "syntax",
+					Line:     e.Pos.Line,
+					Column:   e.Pos.Column,
+					Message:  e.Msg,
+				})
+			}
+			return diags, nil
+		}
+		return nil, err
+	}
+
+	var diags []Diagnostic
+	report := func(pos token.Pos, severity, kind, format string, args ...interface{}) {
+		p := fset.Position(pos)
+		diags = append(diags, Diagnostic{
+			Severity: severity,
+			Kind:     kind,
+			Line:     p.Line,
+			Column:   p.Column,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	// 导入名 -> 模块名（仅AutoGo模块）
+	modules := make(map[string]string)
+	for _, spec := range file.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		name := importName(spec)
+
+		if !strings.HasPrefix(path, modulePath) {
+			continue
+		}
+		module := strings.TrimPrefix(path, modulePath)
+		if !v.moduleExists(module) {
+			report(spec.Pos(), "error", "unknown-module", "未知模块 %s，该包不存在", module)
+			continue
+		}
+		modules[name] = module
+	}
+
+	used := make(map[string]bool)
+	signatures := make(map[string]map[string]apiSignature)
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.SelectorExpr:
+			if ident, ok := node.X.(*ast.Ident); ok {
+				used[ident.Name] = true
+			}
+		case *ast.CallExpr:
+			sel, ok := node.Fun.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			ident, ok := sel.X.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			module, ok := modules[ident.Name]
+			if !ok {
+				return true
+			}
+
+			if _, ok := signatures[module]; !ok {
+				signatures[module] = v.moduleSignatures(module)
+			}
+			sig, ok := signatures[module][sel.Sel.Name]
+			if !ok {
+				report(sel.Pos(), "error", "unknown-function", "未知函数 %s.%s，知识库和源码中均不存在", module, sel.Sel.Name)
+				return true
+			}
+			if node.Ellipsis.IsValid() {
+				return true
+			}
+			args := len(node.Args)
+			if (sig.variadic && args < sig.params-1) || (!sig.variadic && args != sig.params) {
+				report(node.Pos(), "error", "arg-count", "%s.%s 需要 %d 个参数，实际传入 %d 个", module, sel.Sel.Name, sig.params, args)
+			}
+		}
+		return true
+	})
+
+	for _, spec := range file.Imports {
+		name := importName(spec)
+		if name != "_" && name != "." && !used[name] {
+			report(spec.Pos(), "error", "unused-import", "导入的包 %s 未被使用", spec.Path.Value)
+		}
+	}
+
+	return diags, nil
+}
+
+// importName 返回导入在代码中使用的包名
+func importName(spec *ast.ImportSpec) string {
+	if spec.Name != nil {
+		return spec.Name.Name
+	}
+	path, _ := strconv.Unquote(spec.Path.Value)
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+// moduleExists 判断模块是否存在：有本地源码时以源码为准，否则以知识库为准
+func (v *ScriptValidator) moduleExists(module string) bool {
+	if v.moduleRoot != "" {
+		info, err := os.Stat(filepath.Join(v.moduleRoot, filepath.FromSlash(module)))
+		return err == nil && info.IsDir()
+	}
+	if v.kb == nil {
+		return false
+	}
+	docs, err := v.kb.GetByModule(module)
+	return err == nil && len(docs) > 0
+}
+
+// moduleSignatures 汇总模块的包级函数签名，知识库优先，缺失的从本地源码补充
+func (v *ScriptValidator) moduleSignatures(module string) map[string]apiSignature {
+	result := make(map[string]apiSignature)
+
+	if v.kb != nil {
+		docs, _ := v.kb.GetByModule(module)
+		for _, doc := range docs {
+			if sig, ok := parseSignature(doc.Signature); ok {
+				result[doc.Function] = sig
+			}
+		}
+	}
+
+	if v.moduleRoot == "" {
+		return result
+	}
+	dir := filepath.Join(v.moduleRoot, filepath.FromSlash(module))
+	files, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	for _, path := range files {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.SkipObjectResolution)
+		if err != nil {
+			continue
+		}
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv != nil || !fn.Name.IsExported() {
+				continue
+			}
+			if _, ok := result[fn.Name.Name]; !ok {
+				result[fn.Name.Name] = countParams(fn.Type)
+			}
+		}
+	}
+
+	return result
+}
+
+// parseSignature 解析知识库中的包级函数签名，如 "func Click(x, y, fingerID int)"
+func parseSignature(signature string) (apiSignature, bool) {
+	signature = strings.TrimSpace(signature)
+	if !strings.HasPrefix(signature, "func ") {
+		return apiSignature{}, false
+	}
+	rest := strings.TrimSpace(strings.TrimPrefix(signature, "func "))
+	// 方法签名带有接收者，不属于包级函数
+	if strings.HasPrefix(rest, "(") {
+		return apiSignature{}, false
+	}
+	idx := strings.Index(rest, "(")
+	if idx == -1 {
+		return apiSignature{}, false
+	}
+
+	expr, err := parser.ParseExpr("func" + rest[idx:])
+	if err != nil {
+		return apiSignature{}, false
+	}
+	fnType, ok := expr.(*ast.FuncType)
+	if !ok {
+		return apiSignature{}, false
+	}
+	return countParams(fnType), true
+}
+
+func countParams(fnType *ast.FuncType) apiSignature {
+	var sig apiSignature
+	if fnType.Params == nil {
+		return sig
+	}
+	for _, field := range fnType.Params.List {
+		if len(field.Names) == 0 {
+			sig.params++
+		} else {
+			sig.params += len(field.Names)
+		}
+		if _, ok := field.Type.(*ast.Ellipsis); ok {
+			sig.variadic = true
+		}
+	}
+	return sig
+}
+
+// findModuleRoot 从目录向上查找go.mod所在目录
+func findModuleRoot(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
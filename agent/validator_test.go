@@ -0,0 +1,109 @@
+package agent
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func newTestKnowledgeBase(t *testing.T) *KnowledgeBase {
+	t.Helper()
+	kb, err := NewKnowledgeBase(filepath.Join(t.TempDir(), "kb.db"))
+	if err != nil {
+		t.Fatalf("NewKnowledgeBase: %v", err)
+	}
+	t.Cleanup(func() { kb.Close() })
+	if err := BuildDefaultKnowledgeBase(kb); err != nil {
+		t.Fatalf("BuildDefaultKnowledgeBase: %v", err)
+	}
+	return kb
+}
+
+func TestScriptValidator(t *testing.T) {
+	kb := newTestKnowledgeBase(t)
+	root := findModuleRoot(".")
+	if root == "" {
+		t.Fatal("module root not found")
+	}
+	validator := NewScriptValidator(kb, root)
+
+	cases := []struct {
+		name  string
+		code  string
+		kinds []string
+	}{
+		{
+			name: "valid",
+			code: `package main
+
+import "github.com/xiaocainiao633/Genie1.0--/motion"
+
+func main() {
+	motion.Click(100, 200, 1)
+	motion.Recents()
+}
+`,
+		},
+		{
+			name: "unknown module",
+			code: `package main
+
+import "github.com/xiaocainiao633/Genie1.0--/opencv"
+
+func main() {
+	opencv.FindImage(0, 0, 0, 0, nil, false, 1.0, 0.8)
+}
+`,
+			kinds: []string{"unknown-module"},
+		},
+		{
+			name: "unknown function and arg count",
+			code: `package main
+
+import "github.com/xiaocainiao633/Genie1.0--/motion"
+
+func main() {
+	motion.Tap(1, 2)
+	motion.Click(100, 200)
+}
+`,
+			kinds: []string{"unknown-function", "arg-count"},
+		},
+		{
+			name: "unused import",
+			code: `package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	fmt.Println("ok")
+}
+`,
+			kinds: []string{"unused-import"},
+		},
+		{
+			name:  "syntax error",
+			code:  "package main\n\nfunc main() {\n",
+			kinds: []string{"syntax"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			diags, err := validator.Validate(tc.code)
+			if err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if len(diags) != len(tc.kinds) {
+				t.Fatalf("got %d diagnostics, want %d:\n%s", len(diags), len(tc.kinds), FormatDiagnostics(diags))
+			}
+			for i, kind := range tc.kinds {
+				if diags[i].Kind != kind {
+					t.Errorf("diagnostic %d kind = %s, want %s", i, diags[i].Kind, kind)
+				}
+			}
+		})
+	}
+}
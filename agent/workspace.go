@@ -0,0 +1,182 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 每次执行的产物目录中的文件名
+const (
+	runMetaFile     = "run.json"
+	runSourceFile   = "main.go"
+	runBinaryFile   = "test_binary"
+	runBuildLogFile = "build.log"
+	runDeviceLog    = "device.log"
+	runScreenshots  = "screenshots"
+)
+
+// incompleteRunAge 没有run.json的目录超过该时间视为中断的执行，可以被回收
+const incompleteRunAge = 24 * time.Hour
+
+// RunMeta 执行目录中的元信息，写入run.json
+type RunMeta struct {
+	ID        string        `json:"id"`
+	Query     string        `json:"query"`
+	Success   bool          `json:"success"`
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration"`
+}
+
+// newRunDir 在工作目录的runs下为本次执行创建独立目录
+func newRunDir(workspaceDir string, start time.Time) (string, error) {
+	runsDir := filepath.Join(workspaceDir, "runs")
+	if err := os.MkdirAll(runsDir, 0755); err != nil {
+		return "", err
+	}
+	return os.MkdirTemp(runsDir, start.Format("20060102-150405")+"-")
+}
+
+// runBinaryPath 返回执行目录中二进制的路径。文件名带上执行目录名，
+// 推送到设备端同一目录后，不同执行的二进制不会互相覆盖，结束进程时也不会误杀
+func runBinaryPath(runDir string) string {
+	return filepath.Join(runDir, runBinaryFile+"_"+filepath.Base(runDir))
+}
+
+// writeRunMeta 写入执行目录的元信息
+func writeRunMeta(runDir string, meta RunMeta) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(runDir, runMetaFile), data, 0644)
+}
+
+// RetentionPolicy 工作目录保留策略。满足任一条件的执行会被保留：
+// 属于最近KeepLast次、在MaxAge之内、或失败且KeepFailures为true
+type RetentionPolicy struct {
+	KeepLast     int
+	MaxAge       time.Duration
+	KeepFailures bool
+}
+
+// DefaultRetentionPolicy 默认保留最近20次和7天内的执行，并保留所有失败的执行
+func DefaultRetentionPolicy() RetentionPolicy {
+	return RetentionPolicy{KeepLast: 20, MaxAge: 7 * 24 * time.Hour, KeepFailures: true}
+}
+
+// GCResult 垃圾回收结果
+type GCResult struct {
+	Removed []string `json:"removed"`
+	Kept    int      `json:"kept"`
+	Freed   int64    `json:"freed"`
+	DryRun  bool     `json:"dry_run"`
+}
+
+// String 返回回收结果的简要描述
+func (r *GCResult) String() string {
+	action := "已删除"
+	if r.DryRun {
+		action = "将删除"
+	}
+	return fmt.Sprintf("%s %d 项，释放 %.1f MB，保留 %d 次执行", action, len(r.Removed), float64(r.Freed)/(1<<20), r.Kept)
+}
+
+// workspaceRun 工作目录中的一次执行
+type workspaceRun struct {
+	path     string
+	meta     *RunMeta
+	modTime  time.Time
+	complete bool
+}
+
+// CollectGarbage 按保留策略清理工作目录：runs下的执行目录，以及旧版本平铺在工作目录中的
+// generated_*.go 和 test_binary_* 文件。dryRun为true时只统计不删除。
+func CollectGarbage(workspaceDir string, policy RetentionPolicy, dryRun bool) (*GCResult, error) {
+	result := &GCResult{DryRun: dryRun}
+	now := time.Now()
+
+	entries, err := os.ReadDir(filepath.Join(workspaceDir, "runs"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var runs []workspaceRun
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		run := workspaceRun{path: filepath.Join(workspaceDir, "runs", entry.Name())}
+		if info, err := entry.Info(); err == nil {
+			run.modTime = info.ModTime()
+		}
+		if data, err := os.ReadFile(filepath.Join(run.path, runMetaFile)); err == nil {
+			var meta RunMeta
+			if json.Unmarshal(data, &meta) == nil {
+				run.meta = &meta
+				run.modTime = meta.StartedAt
+				run.complete = true
+			}
+		}
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].modTime.After(runs[j].modTime)
+	})
+
+	for i, run := range runs {
+		age := now.Sub(run.modTime)
+		keep := i < policy.KeepLast ||
+			(policy.MaxAge > 0 && age < policy.MaxAge) ||
+			(policy.KeepFailures && run.complete && !run.meta.Success) ||
+			(!run.complete && age < incompleteRunAge)
+		if keep {
+			result.Kept++
+			continue
+		}
+		if err := result.remove(run.path); err != nil {
+			return result, err
+		}
+	}
+
+	// 旧版本平铺的产物没有执行结果记录，只按时间清理
+	legacy, err := os.ReadDir(workspaceDir)
+	if err != nil && !os.IsNotExist(err) {
+		return result, err
+	}
+	for _, entry := range legacy {
+		name := entry.Name()
+		if entry.IsDir() || !(strings.HasPrefix(name, "generated_") && strings.HasSuffix(name, ".go") || strings.HasPrefix(name, "test_binary_")) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || (policy.MaxAge > 0 && now.Sub(info.ModTime()) < policy.MaxAge) {
+			continue
+		}
+		if err := result.remove(filepath.Join(workspaceDir, name)); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// remove 统计并删除文件或目录
+func (r *GCResult) remove(path string) error {
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				r.Freed += info.Size()
+			}
+		}
+		return nil
+	})
+	r.Removed = append(r.Removed, path)
+	if r.DryRun {
+		return nil
+	}
+	return os.RemoveAll(path)
+}
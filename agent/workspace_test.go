@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCollectGarbage(t *testing.T) {
+	workspace := t.TempDir()
+	now := time.Now()
+
+	makeRun := func(name string, age time.Duration, success bool, withMeta bool) string {
+		dir := filepath.Join(workspace, "runs", name)
+		os.MkdirAll(dir, 0755)
+		os.WriteFile(runBinaryPath(dir), make([]byte, 1024), 0755)
+		if withMeta {
+			writeRunMeta(dir, RunMeta{ID: name, Success: success, StartedAt: now.Add(-age)})
+		} else {
+			os.Chtimes(dir, now.Add(-age), now.Add(-age))
+		}
+		return dir
+	}
+	recent := makeRun("recent", time.Hour, true, true)
+	oldPass := makeRun("old-pass", 10*24*time.Hour, true, true)
+	oldFail := makeRun("old-fail", 10*24*time.Hour, false, true)
+	newest := makeRun("newest", time.Minute, true, true)
+	running := makeRun("running", time.Minute, false, false)
+	crashed := makeRun("crashed", 48*time.Hour, false, false)
+
+	legacy := filepath.Join(workspace, "generated_1.go")
+	os.WriteFile(legacy, []byte("package main"), 0644)
+	os.Chtimes(legacy, now.Add(-30*24*time.Hour), now.Add(-30*24*time.Hour))
+
+	policy := RetentionPolicy{KeepLast: 1, MaxAge: 24 * time.Hour, KeepFailures: true}
+	dry, err := CollectGarbage(workspace, policy, true)
+	if err != nil {
+		t.Fatalf("CollectGarbage dry run: %v", err)
+	}
+	if len(dry.Removed) != 3 {
+		t.Fatalf("dry run would remove %v, want old-pass, crashed and the legacy file", dry.Removed)
+	}
+	if _, err := os.Stat(oldPass); err != nil {
+		t.Fatal("dry run removed files")
+	}
+
+	result, err := CollectGarbage(workspace, policy, false)
+	if err != nil {
+		t.Fatalf("CollectGarbage: %v", err)
+	}
+	if result.Freed < 2048 || result.Kept != 4 {
+		t.Errorf("unexpected result %+v", result)
+	}
+	for _, path := range []string{oldPass, crashed, legacy} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s was not removed", path)
+		}
+	}
+	for _, path := range []string{recent, oldFail, newest, running} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s was removed", path)
+		}
+	}
+
+	// 不保留失败且只保留最近一次时，旧的失败执行也会被清理
+	result, err = CollectGarbage(workspace, RetentionPolicy{KeepLast: 1}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(oldFail); !os.IsNotExist(err) {
+		t.Errorf("old failure kept without KeepFailures: %+v", result)
+	}
+}
+
+func TestRunBinaryPathUnique(t *testing.T) {
+	workspace := t.TempDir()
+	start := time.Now()
+	seen := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		runDir, err := newRunDir(workspace, start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 设备端按文件名存放二进制，同一秒内的执行也必须得到不同的文件名
+		name := filepath.Base(runBinaryPath(runDir))
+		if seen[name] {
+			t.Fatalf("binary name %q reused across runs", name)
+		}
+		seen[name] = true
+	}
+}
@@ -2,4 +2,7 @@ module github.com/xiaocainiao633/Genie1.0--
 
 go 1.24.2
 
-require github.com/mattn/go-sqlite3 v1.14.27
\ No newline at end of file
+require (
+	github.com/mattn/go-sqlite3 v1.14.27
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -1,3 +1,8 @@
+//go:build mcp
+
+// llm-mcp-rag 通过MCP工具调用完成任务的独立示例，依赖OpenAI SDK的工具调用和mcp-go，
+// 二者都不在本模块的go.mod中，因此只在 -tags mcp 时编译。
+// 工具调用不属于agent.LLMBackend的接口范围，示例未迁移到LLMBackend。
 package main
 
 import (
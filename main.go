@@ -1,28 +1,86 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/xiaocainiao633/Genie1.0--/agent"
 )
 
 func main() {
 	var (
-		kbPath       = flag.String("kb", "./knowledge_base.db", "知识库路径")
-		workspace    = flag.String("workspace", "./workspace", "工作目录")
-		reportDir    = flag.String("reports", "./workspace/reports", "报告目录")
-		query        = flag.String("query", "", "单次查询（非交互模式）")
-		initKB       = flag.Bool("init", false, "初始化知识库")
-		useLLM       = flag.Bool("use-llm", true, "启用本地LLM辅助生成")
-		autoExec     = flag.Bool("auto-exec", false, "自动在连接的Android设备上执行")
-		adbPath      = flag.String("adb", "adb", "ADB命令路径")
-		remoteDir    = flag.String("remote", "/data/local/tmp", "设备端执行目录")
-		ollamaBase   = flag.String("ollama-base", "http://localhost:11434", "Ollama服务地址")
-		ollamaModel  = flag.String("ollama-model", "llama3.2:latest", "Ollama推理模型")
-		ollamaEmbed  = flag.String("ollama-embed", "llama3.2:latest", "Ollama向量模型")
+		kbPath      = flag.String("kb", "./knowledge_base.db", "知识库路径")
+		workspace   = flag.String("workspace", "./workspace", "工作目录")
+		reportDir   = flag.String("reports", "./workspace/reports", "报告目录")
+		reportFmt   = flag.String("report-format", "json", "报告格式，逗号分隔: json, junit, html, markdown")
+		query       = flag.String("query", "", "单次查询（非交互模式）")
+		serveAddr   = flag.String("serve", "", "以HTTP API模式运行的监听地址，如 :8080")
+		suitePath   = flag.String("suite", "", "批量执行测试套件文件（.jsonl/.yaml）")
+		suiteTags   = flag.String("tags", "", "只执行包含这些标签的用例，逗号分隔")
+		parallel    = flag.Int("parallel", 1, "测试套件的并发执行数")
+		historyCmd  = flag.String("history", "", "查看报告历史: list, trends, flaky")
+		histQuery   = flag.String("history-query", "", "按查询关键字过滤历史")
+		histStatus  = flag.String("history-status", "", "按结果过滤历史: pass, fail")
+		histSince   = flag.String("history-since", "", "历史起始日期，如 2024-01-02")
+		histUntil   = flag.String("history-until", "", "历史截止日期（不含）")
+		histLimit   = flag.Int("history-limit", 50, "历史记录最大条数")
+		initKB      = flag.Bool("init", false, "初始化知识库")
+		promptDir   = flag.String("prompts", "", "提示词模板目录，默认为 <workspace>/prompts")
+		initPrompts = flag.Bool("init-prompts", false, "将内置提示词模板导出到模板目录后退出")
+		noCache     = flag.Bool("no-cache", false, "禁用代码和编译产物缓存")
+		runGC       = flag.Bool("gc", false, "按保留策略清理工作目录中的执行产物后退出")
+		autoGC      = flag.Bool("auto-gc", false, "每次执行结束后按保留策略清理工作目录")
+		keepRuns    = flag.Int("keep-runs", 20, "保留最近的执行次数")
+		keepDays    = flag.Int("keep-days", 7, "保留最近天数内的执行（0表示不按时间保留）")
+		keepFailed  = flag.Bool("keep-failures", true, "始终保留失败的执行")
+		dryRun      = flag.Bool("dry-run", false, "与-gc一起使用，只列出将被删除的内容")
+		useLLM      = flag.Bool("use-llm", true, "启用本地LLM辅助生成")
+		autoExec    = flag.Bool("auto-exec", false, "自动在连接的Android设备上执行")
+		adbPath     = flag.String("adb", "adb", "ADB命令路径")
+		remoteDir   = flag.String("remote", "", "设备端执行目录，默认adb为/data/local/tmp，ssh为/tmp")
+		keepRemote  = flag.Bool("keep-remote", false, "执行结束后保留推送到设备的二进制")
+		execBackend = flag.String("executor", "adb", "执行后端: adb, host（本机）, ssh")
+		sshTarget   = flag.String("ssh-target", "", "ssh执行后端的目标，如 root@192.168.1.2")
+		sshPort     = flag.Int("ssh-port", 0, "ssh端口，默认22")
+		sshKey      = flag.String("ssh-key", "", "ssh私钥文件")
+		deviceSel   = flag.String("device", "", "目标设备：序列号列表，或筛选表达式如 serial=a,b;model=pixel;abi=arm64-v8a")
+		allDevices  = flag.Bool("all-devices", false, "在所有匹配的设备上并行执行")
+		listDevices = flag.Bool("devices", false, "列出连接的设备后退出")
+		evidence    = flag.String("evidence", "failure", "截图和界面控件树的采集时机: failure, always, never（never时也不采集logcat）")
+		llmBackend  = flag.String("llm", "ollama", "LLM后端: ollama 或 openai（OpenAI兼容服务，如llama.cpp server、vLLM、LM Studio）")
+		openaiBase  = flag.String("openai-base", "http://localhost:8080/v1", "OpenAI兼容服务地址（含/v1）")
+		openaiModel = flag.String("openai-model", "", "OpenAI兼容服务的推理模型")
+		openaiEmbed = flag.String("openai-embed", "", "OpenAI兼容服务的向量模型，默认与推理模型相同")
+		openaiKey   = flag.String("openai-key", os.Getenv("OPENAI_API_KEY"), "OpenAI兼容服务的API Key，默认读取OPENAI_API_KEY")
+		ollamaBase  = flag.String("ollama-base", "http://localhost:11434", "Ollama服务地址")
+		ollamaModel = flag.String("ollama-model", "llama3.2:latest", "Ollama推理模型")
+		ollamaEmbed = flag.String("ollama-embed", "llama3.2:latest", "Ollama向量模型")
+		maxRepair   = flag.Int("repair", agent.DefaultMaxRepairAttempts, "编译失败后LLM修复的最大次数（0表示不修复）")
+		buildABI    = flag.String("abi", "", "目标设备ABI: arm64-v8a, x86_64, x86（设置后交叉编译到安卓）")
+		buildGOOS   = flag.String("goos", "", "编译目标GOOS，默认由ABI推导")
+		buildGOARCH = flag.String("goarch", "", "编译目标GOARCH，默认由ABI推导")
+		buildCGO    = flag.Bool("cgo", false, "编译时启用cgo（使用utils、ppocr等模块时需要）")
+		ndkCC       = flag.String("ndk-cc", "", "NDK clang路径，如 aarch64-linux-android21-clang")
+		ldflags     = flag.String("ldflags", "", "额外的链接参数")
+		embedTO     = flag.Duration("embed-timeout", 0, "知识库检索超时（默认1m）")
+		generateTO  = flag.Duration("generate-timeout", 0, "代码生成超时（默认3m）")
+		buildTO     = flag.Duration("build-timeout", 0, "编译超时（默认2m）")
+		pushTO      = flag.Duration("push-timeout", 0, "推送到设备超时（默认1m）")
+		runTO       = flag.Duration("run-timeout", 0, "设备端执行超时（默认5m）")
+		recordOut   = flag.String("record", "", "录制设备上的触摸操作并生成脚本到该文件，Ctrl+C结束录制")
+		recordInput = flag.String("record-input", "", "与-record一起使用，从保存的getevent输出生成脚本而不连接设备")
+		recordUI    = flag.String("record-ui", "", "与-record-input一起使用，用于将点击解析为控件的界面控件树XML")
+		recordSize  = flag.String("record-size", "", "录制设备的屏幕尺寸，如 1080x2340（默认读取设备或日志）")
+		memoryPath  = flag.String("memory", "", "对话记忆库路径，默认为知识库同目录下的 conversation_memory.db")
+		memoryLimit = flag.Int("memory-budget", agent.DefaultMemoryBudget, "对话记忆的token预算，超出时较早的对话被总结")
+		memoryAge   = flag.Duration("memory-max-age", agent.DefaultMemoryMaxAge, "未被保存的会话引用的对话记忆超过该时长未更新后删除，负数表示不删除")
 	)
 	flag.Parse()
 
@@ -36,30 +94,225 @@ func main() {
 		return
 	}
 
-	var ollamaClient *agent.OllamaClient
+	if *promptDir == "" {
+		*promptDir = filepath.Join(*workspace, "prompts")
+	}
+	if *initPrompts {
+		written, err := agent.NewPromptStore(*promptDir).ExportDefaults()
+		if err != nil {
+			fmt.Printf("导出提示词模板失败: %v\n", err)
+			os.Exit(1)
+		}
+		for _, path := range written {
+			fmt.Println("已导出:", path)
+		}
+		fmt.Printf("提示词模板目录: %s（在 <模型名>/ 子目录中放置同名模板可按模型覆盖）\n", *promptDir)
+		return
+	}
+
+	retention := agent.RetentionPolicy{
+		KeepLast:     *keepRuns,
+		MaxAge:       time.Duration(*keepDays) * 24 * time.Hour,
+		KeepFailures: *keepFailed,
+	}
+	if *runGC {
+		result, err := agent.CollectGarbage(*workspace, retention, *dryRun)
+		if err != nil {
+			fmt.Printf("清理工作目录失败: %v\n", err)
+			os.Exit(1)
+		}
+		for _, path := range result.Removed {
+			fmt.Println("  -", path)
+		}
+		fmt.Println(result)
+		return
+	}
+
+	if *historyCmd != "" {
+		since, err := agent.ParseHistoryDate(*histSince)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		until, err := agent.ParseHistoryDate(*histUntil)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		filter := agent.HistoryFilter{
+			Query:  *histQuery,
+			Status: *histStatus,
+			Since:  since,
+			Until:  until,
+			Limit:  *histLimit,
+		}
+		if err := showHistory(agent.DefaultHistoryPath(*kbPath), *historyCmd, filter); err != nil {
+			fmt.Printf("查询报告历史失败: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	sshConfig := agent.SSHConfig{Target: *sshTarget, Port: *sshPort, KeyFile: *sshKey}
+	if *listDevices {
+		executor, err := agent.NewExecutor(agent.ExecutorConfig{
+			Backend:   *execBackend,
+			ADBPath:   *adbPath,
+			RemoteDir: *remoteDir,
+			SSH:       sshConfig,
+		})
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		devices, err := executor.Devices(context.Background())
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if len(devices) == 0 {
+			fmt.Println("没有连接的设备")
+		}
+		for _, d := range devices {
+			fmt.Println(d)
+		}
+		return
+	}
+
+	deviceFilter, err := agent.ParseDeviceFilter(*deviceSel)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if *recordOut != "" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		opts := recordOptions{
+			Output:    *recordOut,
+			Input:     *recordInput,
+			UIDump:    *recordUI,
+			Screen:    *recordSize,
+			Workspace: *workspace,
+			ADBPath:   *adbPath,
+			Devices:   deviceFilter,
+		}
+		if err := recordScript(ctx, opts); err != nil {
+			fmt.Printf("录制失败: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	evidenceMode, err := agent.ParseEvidenceMode(*evidence)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	reportFormats, err := agent.ParseReportFormats(*reportFmt)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	var llm agent.LLMBackend
 	if *useLLM || *autoExec {
-		ollamaClient = agent.NewOllamaClient(*ollamaBase, *ollamaModel, *ollamaEmbed)
+		llmCfg := agent.LLMConfig{
+			Backend:    *llmBackend,
+			BaseURL:    *ollamaBase,
+			Model:      *ollamaModel,
+			EmbedModel: *ollamaEmbed,
+		}
+		if *llmBackend == "openai" {
+			llmCfg.BaseURL = *openaiBase
+			llmCfg.Model = *openaiModel
+			llmCfg.EmbedModel = *openaiEmbed
+			llmCfg.APIKey = *openaiKey
+		}
+		llm, err = agent.NewLLMBackend(llmCfg)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
 	}
 
 	cfg := agent.AgentConfig{
-		UseLLM:       *useLLM,
-		AutoExecute:  *autoExec,
-		WorkspaceDir: *workspace,
-		ReportDir:    *reportDir,
-		ADBPath:      *adbPath,
-		RemoteDir:    *remoteDir,
+		UseLLM:            *useLLM,
+		AutoExecute:       *autoExec,
+		WorkspaceDir:      *workspace,
+		ReportDir:         *reportDir,
+		ADBPath:           *adbPath,
+		RemoteDir:         *remoteDir,
+		MaxRepairAttempts: maxRepair,
+		ReportFormats:     reportFormats,
+		PromptDir:         *promptDir,
+		DisableCache:      *noCache,
+		Devices:           deviceFilter,
+		AllDevices:        *allDevices,
+		Evidence:          evidenceMode,
+		KeepRemoteBinary:  *keepRemote,
+		Executor:          *execBackend,
+		SSH:               sshConfig,
+		MemoryPath:        *memoryPath,
+		MemoryBudget:      *memoryLimit,
+		MemoryMaxAge:      *memoryAge,
+		Build: agent.BuildProfile{
+			GOOS:       *buildGOOS,
+			GOARCH:     *buildGOARCH,
+			CGOEnabled: *buildCGO,
+			CC:         *ndkCC,
+			ABI:        *buildABI,
+			LDFlags:    *ldflags,
+		},
+		Timeouts: agent.PhaseTimeouts{
+			Embed:    *embedTO,
+			Generate: *generateTO,
+			Build:    *buildTO,
+			Push:     *pushTO,
+			Run:      *runTO,
+		},
+	}
+
+	if *autoGC {
+		cfg.Retention = &retention
 	}
 
-	ag, err := agent.NewAgentWithOptions(*kbPath, cfg, ollamaClient)
+	ag, err := agent.NewAgentWithOptions(*kbPath, cfg, llm)
 	if err != nil {
 		fmt.Printf("创建Agent失败: %v\n", err)
 		os.Exit(1)
 	}
 	defer ag.Close()
 
+	if *serveAddr != "" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		fmt.Printf("HTTP API 服务已启动: %s\n", *serveAddr)
+		if err := agent.NewServer(ag).ListenAndServe(ctx, *serveAddr); err != nil {
+			fmt.Printf("HTTP服务异常退出: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *suitePath != "" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if !runSuite(ctx, ag, *suitePath, *suiteTags, *parallel, *reportDir, reportFormats) {
+			os.Exit(1)
+		}
+		return
+	}
+
 	if *query != "" {
-		result, err := ag.ProcessQueryWithContext(*query, "")
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		result, err := ag.Run(ctx, *query, "")
 		if err != nil {
+			if result != nil {
+				fmt.Println(ag.FormatResult(result))
+			}
 			fmt.Printf("处理查询失败: %v\n", err)
 			os.Exit(1)
 		}
@@ -71,6 +324,167 @@ func main() {
 	dialogue.Start()
 }
 
+// runSuite 执行测试套件并保存汇总，全部用例符合预期时返回true
+func runSuite(ctx context.Context, ag *agent.Agent, path, tags string, parallel int, reportDir string, formats []agent.ReportFormat) bool {
+	cases, err := agent.LoadSuite(path)
+	if err != nil {
+		fmt.Printf("读取测试套件失败: %v\n", err)
+		return false
+	}
+
+	var filter []string
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			filter = append(filter, tag)
+		}
+	}
+	selected := cases[:0]
+	for _, c := range cases {
+		if c.HasAnyTag(filter) {
+			selected = append(selected, c)
+		}
+	}
+
+	summary := ag.RunSuite(ctx, filepath.Base(path), selected, parallel)
+	summaryPath, err := summary.Save(reportDir, formats...)
+	if err != nil {
+		fmt.Printf("保存套件汇总失败: %v\n", err)
+	}
+
+	fmt.Println(summary.Markdown())
+	if summaryPath != "" {
+		fmt.Printf("汇总: %s\n", summaryPath)
+	}
+	return summary.Failed == 0
+}
+
+// showHistory 输出报告历史、通过率趋势或不稳定的查询
+func showHistory(path, command string, filter agent.HistoryFilter) error {
+	history, err := agent.OpenReportHistory(path)
+	if err != nil {
+		return err
+	}
+	defer history.Close()
+
+	switch command {
+	case "list":
+		entries, err := history.List(filter)
+		if err != nil {
+			return err
+		}
+		fmt.Print(agent.FormatHistory(entries))
+	case "trends", "flaky":
+		var trends []agent.QueryTrend
+		if command == "flaky" {
+			trends, err = history.Flaky(filter)
+		} else {
+			trends, err = history.Trends(filter)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Print(agent.FormatTrends(trends))
+	default:
+		return fmt.Errorf("未知的历史命令: %s（可选 list, trends, flaky）", command)
+	}
+	return nil
+}
+
+// recordOptions 录制命令的参数
+type recordOptions struct {
+	Output    string // 生成的脚本路径
+	Input     string // 保存的getevent输出，为空时实时录制
+	UIDump    string // 回放日志时使用的界面控件树
+	Screen    string // 录制设备的屏幕尺寸
+	Workspace string
+	ADBPath   string
+	Devices   agent.DeviceFilter
+}
+
+// recordScript 录制或回放触摸操作并生成脚本。实时录制时getevent原始输出和界面控件树
+// 保存在 <workspace>/recordings/ 下，之后可通过-record-input重新生成脚本
+func recordScript(ctx context.Context, opts recordOptions) error {
+	var recordOpts agent.RecordOptions
+	if opts.Screen != "" {
+		screen, err := agent.ParseScreenSize(opts.Screen)
+		if err != nil {
+			return err
+		}
+		recordOpts.Screen = screen
+	}
+	recordOpts.OnGesture = func(g agent.Gesture) {
+		target := ""
+		if g.Selector != nil {
+			target = fmt.Sprintf(" %s=%q", g.Selector.By, g.Selector.Value)
+		}
+		fmt.Printf("  %s %s → %s %v%s\n", g.Kind, g.Start, g.End, g.Duration.Round(time.Millisecond), target)
+	}
+
+	var recording *agent.Recording
+	if opts.Input != "" {
+		if opts.UIDump != "" {
+			data, err := os.ReadFile(opts.UIDump)
+			if err != nil {
+				return err
+			}
+			if recordOpts.UIDump, err = agent.ParseUIDump(data); err != nil {
+				return err
+			}
+		}
+		f, err := os.Open(opts.Input)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if recording, err = agent.ReplayGetevent(f, recordOpts); err != nil {
+			return err
+		}
+	} else {
+		pool := agent.NewDevicePool(agent.NewAndroidExecutor(opts.ADBPath, ""), nil)
+		if err := pool.Refresh(ctx); err != nil {
+			return err
+		}
+		lease, err := pool.Acquire(ctx, opts.Devices)
+		if err != nil {
+			return err
+		}
+		defer lease.Release()
+
+		dir := filepath.Join(opts.Workspace, "recordings", time.Now().Format("20060102-150405"))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		logPath := filepath.Join(dir, "getevent.log")
+		log, err := os.Create(logPath)
+		if err != nil {
+			return err
+		}
+		defer log.Close()
+		recordOpts.Log = log
+		recordOpts.DumpDir = dir
+
+		fmt.Printf("正在录制设备 %s 上的操作，按 Ctrl+C 结束...\n", lease.Device.Serial)
+		recording, err = lease.Executor.(*agent.AndroidExecutor).Record(ctx, recordOpts)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("原始事件已保存: %s\n", logPath)
+	}
+
+	if len(recording.Gestures) == 0 {
+		return fmt.Errorf("没有录制到任何操作")
+	}
+	code, err := recording.Script()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(opts.Output, []byte(code), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("已录制 %d 个操作，脚本已保存: %s\n", len(recording.Gestures), opts.Output)
+	return nil
+}
+
 func initKnowledgeBase(path string) {
 	fmt.Println("正在初始化知识库...")
 	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
@@ -91,4 +505,4 @@ func initKnowledgeBase(path string) {
 	}
 
 	fmt.Println("知识库初始化完成！")
-}
\ No newline at end of file
+}
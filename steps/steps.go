@@ -0,0 +1,136 @@
+// Package steps 提供生成脚本与主机之间的步骤结果协议：每个事件输出为一行带前缀的JSON，
+// 主机从标准输出中解析出每个步骤的结果、断言和截图
+package steps
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// EventPrefix 事件行的前缀，主机据此从普通输出中区分事件
+const EventPrefix = "@@genie:"
+
+// 事件类型
+const (
+	EventStepStart  = "step_start"
+	EventStepEnd    = "step_end"
+	EventAssert     = "assert"
+	EventScreenshot = "screenshot"
+)
+
+// 步骤和断言的状态
+const (
+	StatusPass = "pass"
+	StatusFail = "fail"
+)
+
+// Event 脚本输出的一个事件
+type Event struct {
+	Type       string    `json:"type"`
+	Step       int       `json:"step,omitempty"`
+	Name       string    `json:"name,omitempty"`
+	Status     string    `json:"status,omitempty"`
+	Message    string    `json:"message,omitempty"`
+	Path       string    `json:"path,omitempty"`
+	Time       time.Time `json:"time"`
+	DurationMs int64     `json:"duration_ms,omitempty"`
+}
+
+// Step 一个测试步骤
+type Step struct {
+	Name string
+	Run  func() error
+}
+
+var (
+	mu      sync.Mutex
+	output  io.Writer = os.Stdout
+	current int
+	counter int
+)
+
+// SetOutput 设置事件的输出位置，w为nil时恢复为标准输出，同时重置步骤序号。
+func SetOutput(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+	if w == nil {
+		w = os.Stdout
+	}
+	output = w
+	current, counter = 0, 0
+}
+
+// emit 输出一个事件，未指定步骤时归属于当前步骤。
+func emit(event Event) {
+	mu.Lock()
+	defer mu.Unlock()
+	if event.Step == 0 {
+		event.Step = current
+	}
+	event.Time = time.Now()
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(output, "%s%s\n", EventPrefix, data)
+}
+
+// Run 执行一个步骤，输出开始和结束事件，返回fn的错误。fn中的panic视为步骤失败。
+func Run(name string, fn func() error) (err error) {
+	mu.Lock()
+	counter++
+	index := counter
+	current = index
+	mu.Unlock()
+
+	emit(Event{Type: EventStepStart, Step: index, Name: name})
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+		end := Event{Type: EventStepEnd, Step: index, Name: name, Status: StatusPass, DurationMs: time.Since(start).Milliseconds()}
+		if err != nil {
+			end.Status = StatusFail
+			end.Message = err.Error()
+		}
+		emit(end)
+		mu.Lock()
+		current = 0
+		mu.Unlock()
+	}()
+	return fn()
+}
+
+// RunAll 按顺序执行步骤，遇到第一个失败的步骤时停止并返回其错误。
+func RunAll(list []Step) error {
+	for _, s := range list {
+		if err := Run(s.Name, s.Run); err != nil {
+			return fmt.Errorf("步骤 %s 失败: %w", s.Name, err)
+		}
+	}
+	return nil
+}
+
+// Assert 输出断言事件，cond为false时返回描述断言的错误。
+func Assert(cond bool, format string, args ...interface{}) error {
+	message := fmt.Sprintf(format, args...)
+	event := Event{Type: EventAssert, Status: StatusPass, Message: message}
+	if !cond {
+		event.Status = StatusFail
+	}
+	emit(event)
+	if !cond {
+		return fmt.Errorf("断言失败: %s", message)
+	}
+	return nil
+}
+
+// Screenshot 记录当前步骤保存的截图路径。
+func Screenshot(path string) {
+	emit(Event{Type: EventScreenshot, Path: path})
+}